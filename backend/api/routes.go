@@ -9,9 +9,6 @@ import (
 
 // SetupRoutes 设置API路由
 func SetupRoutes(r *gin.Engine) {
-	// 静态文件服务
-	r.Static("/uploads", "./uploads")
-	
 	// 创建API路由组
 	api := r.Group("/api")
 	
@@ -28,6 +25,9 @@ func SetupRoutes(r *gin.Engine) {
 		auth.POST("/login", controllers.Login)
 		auth.GET("/user", middleware.AuthRequired(), controllers.GetCurrentUser)
 		auth.PUT("/user", middleware.AuthRequired(), controllers.UpdateUser)
+		auth.GET("/user/settings", middleware.AuthRequired(), controllers.GetUserSettings)
+		auth.PUT("/user/settings", middleware.AuthRequired(), controllers.UpdateUserSettings)
+		auth.GET("/user/storage", middleware.AuthRequired(), controllers.GetUserStorage)
 	}
 	
 	// 笔记相关路由
@@ -40,6 +40,13 @@ func SetupRoutes(r *gin.Engine) {
 		notes.DELETE("/:id", controllers.DeleteNote)
 		notes.GET("/search", controllers.SearchNotes)
 		notes.GET("/:id/attachments", controllers.GetNoteAttachments)
+		notes.GET("/:id/attachments/zip", controllers.DownloadNoteAttachments)
+		notes.GET("/:id/attachments/references", controllers.GetNoteAttachmentReferences)
+		notes.GET("/:id/export", controllers.ExportNote)
+		notes.GET("/:id/tag-suggestions", controllers.GetNoteTagSuggestions)
+		notes.POST("/:id/tag-suggestions", controllers.ReviewNoteTagSuggestions)
+		notes.GET("/:id/revisions", controllers.GetNoteRevisions)
+		notes.POST("/:id/revisions/:revisionId/restore", controllers.RestoreNoteRevision)
 	}
 	
 	// 标签相关路由
@@ -54,24 +61,73 @@ func SetupRoutes(r *gin.Engine) {
 		tags.DELETE("/:id/notes/:noteId", controllers.RemoveTagFromNote)
 	}
 	
+	// 附件下载（<img>等标签无法携带认证头，由控制器校验签名、令牌或公开笔记）
+	api.GET("/attachments/:id", controllers.GetAttachment)
+	api.HEAD("/attachments/:id", controllers.GetAttachment)
+	
 	// 附件相关路由
 	attachments := api.Group("/attachments", middleware.AuthRequired())
 	{
 		attachments.POST("", controllers.UploadAttachment)
-		attachments.GET("/:id", controllers.GetAttachment)
+		attachments.HEAD("/blobs/:hash", controllers.CheckAttachmentBlob)
+		attachments.GET("/blobs/:hash", controllers.CheckAttachmentBlob)
+		attachments.GET("/:id/url", controllers.GetAttachmentURL)
+		attachments.POST("/sign", controllers.SignAttachmentURLs)
+		attachments.PATCH("/:id", controllers.UpdateAttachment)
 		attachments.DELETE("/:id", controllers.DeleteAttachment)
 		attachments.GET("/library", controllers.GetAttachmentsByDate)
+		attachments.GET("/zip", controllers.DownloadAttachments)
 		
 		// 临时附件相关路由
 		attachments.POST("/temp", controllers.UploadTempAttachment)
 		attachments.POST("/temp/:id/associate", controllers.AssociateTempAttachment)
 	}
 	
+	// 导入笔记路由
+	imports := api.Group("/import", middleware.AuthRequired())
+	{
+		imports.POST("/markdown", controllers.ImportMarkdown)
+		imports.POST("/enex", controllers.ImportEnex)
+		imports.POST("/notion", controllers.ImportNotion)
+		imports.GET("/jobs", controllers.GetImportJobs)
+		imports.GET("/jobs/:id", controllers.GetImportJob)
+	}
+	
+	// 导出文件下载（浏览器直接打开下载链接时无法携带认证头，由控制器校验签名或令牌）
+	api.GET("/export/jobs/:id/download", controllers.DownloadExport)
+	
+	// 导出笔记路由
+	exports := api.Group("/export", middleware.AuthRequired())
+	{
+		exports.POST("/markdown", controllers.ExportMarkdown)
+		exports.GET("/jobs", controllers.GetExportJobs)
+		exports.GET("/jobs/:id", controllers.GetExportJob)
+	}
+	
+	// 断点续传（tus协议）路由，OPTIONS用于客户端探测服务器能力，无需认证
+	api.OPTIONS("/uploads", controllers.TusHeaders(), controllers.GetUploadOptions)
+	uploads := api.Group("/uploads", middleware.AuthRequired(), controllers.TusHeaders())
+	{
+		uploads.POST("", controllers.CreateUpload)
+		uploads.HEAD("/:id", controllers.GetUploadStatus)
+		uploads.PATCH("/:id", controllers.PatchUpload)
+		uploads.DELETE("/:id", controllers.DeleteUpload)
+	}
+	
 	// AI相关路由
 	ai := api.Group("/ai", middleware.AuthRequired())
 	{
 		ai.POST("/tags", controllers.GenerateTags)
+		ai.POST("/tag-suggestions", controllers.GenerateTagSuggestions)
 		ai.POST("/summary", controllers.GenerateSummary)
+		ai.POST("/ask", controllers.AskNotes)
+		ai.POST("/transform", controllers.TransformContent)
+		
+		// 后台任务
+		ai.POST("/jobs", controllers.CreateAIJob)
+		ai.GET("/jobs", controllers.GetAIJobs)
+		ai.GET("/jobs/:id", controllers.GetAIJob)
+		ai.GET("/quota", controllers.GetAIQuota)
 	}
 	
 	// 管理员路由
@@ -82,6 +138,16 @@ func SetupRoutes(r *gin.Engine) {
 		admin.GET("/users/:id", controllers.GetUser)
 		admin.POST("/users", controllers.CreateUser)
 		admin.PUT("/users/:id/role", controllers.UpdateUserRole)
+		admin.PUT("/users/:id/quota", controllers.UpdateUserQuota)
 		admin.DELETE("/users/:id", controllers.DeleteUserByAdmin)
+		
+		// 附件维护
+		admin.POST("/attachments/thumbnails", controllers.BackfillThumbnails)
+		admin.POST("/attachments/text", controllers.BackfillAttachmentText)
+		
+		// 写作助手提示词模板
+		admin.GET("/ai/prompts", controllers.GetPromptTemplates)
+		admin.PUT("/ai/prompts/:action", controllers.UpdatePromptTemplate)
+		admin.DELETE("/ai/prompts/:action", controllers.ResetPromptTemplate)
 	}
 } 
\ No newline at end of file
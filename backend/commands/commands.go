@@ -0,0 +1,168 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"cyi-note/backend/config"
+	"cyi-note/backend/jobs"
+	"cyi-note/backend/models"
+	"cyi-note/backend/storage"
+)
+
+// 命令行子命令
+var commands = map[string]func(cfg *config.Config, args []string) error{
+	"storage-migrate": migrateStorage,
+	"storage-gc":      collectStorageGarbage,
+}
+
+// runCommand 执行命令行子命令，例如 `cyi-note storage-migrate -from local -to s3`
+func runCommand(cfg *config.Config, name string, args []string) error {
+	command, ok := commands[name]
+	if !ok {
+		return fmt.Errorf("未知的命令: %s", name)
+	}
+	return command(cfg, args)
+}
+
+// migrateStorage 将数据库记录引用的所有文件从一个存储后端复制到另一个存储后端
+// 目标中已存在且大小一致的文件会被跳过，因此可以重复执行
+func migrateStorage(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("storage-migrate", flag.ExitOnError)
+	from := flags.String("from", "local", "源存储后端：local 或 s3")
+	to := flags.String("to", "s3", "目标存储后端：local 或 s3")
+	dryRun := flags.Bool("dry-run", false, "只列出需要迁移的文件，不实际复制")
+	deleteSource := flags.Bool("delete-source", false, "复制成功后删除源文件")
+	flags.Parse(args)
+
+	if *from == *to {
+		return errors.New("源存储后端和目标存储后端不能相同")
+	}
+
+	src, err := storage.New(cfg, *from)
+	if err != nil {
+		return err
+	}
+	dst, err := storage.New(cfg, *to)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	var copied, skipped, missing, failed int
+	err = models.ForEachStorageObject(100, func(object models.StorageObject) error {
+		key := object.Key
+
+		info, err := src.Stat(ctx, key)
+		if errors.Is(err, storage.ErrNotExist) {
+			log.Printf("%s 的源文件不存在: %s", object.Source, key)
+			missing++
+			return nil
+		}
+		if err != nil {
+			log.Printf("读取 %s 的文件失败: %v", object.Source, err)
+			failed++
+			return nil
+		}
+
+		if existing, err := dst.Stat(ctx, key); err == nil && existing.Size == info.Size {
+			skipped++
+			return nil
+		}
+
+		if *dryRun {
+			log.Printf("需要迁移 %s: %s (%d 字节)", object.Source, key, info.Size)
+			copied++
+			return nil
+		}
+
+		if err := copyObject(ctx, src, dst, key, info.Size, object.ContentType); err != nil {
+			log.Printf("迁移 %s 的文件失败: %v", object.Source, err)
+			failed++
+			return nil
+		}
+		copied++
+
+		if *deleteSource {
+			if err := src.Delete(ctx, key); err != nil {
+				log.Printf("删除 %s 的源文件失败: %v", object.Source, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("迁移完成: 复制 %d 个，跳过 %d 个，源文件缺失 %d 个，失败 %d 个", copied, skipped, missing, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d 个文件迁移失败", failed)
+	}
+	return nil
+}
+
+// collectStorageGarbage 清理过期的临时附件，并核对存储后端中的文件与数据库记录
+// 例如 `cyi-note storage-gc -dry-run` 只列出发现的问题
+func collectStorageGarbage(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("storage-gc", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "只列出发现的问题，不做任何修改")
+	tempTTL := flags.Int("temp-ttl", cfg.TempAttachmentTTL, "临时附件的保留时间（小时），0表示不清理临时附件")
+	force := flags.Bool("force", false, "文件丢失的记录比例过高时仍然删除这些记录")
+	flags.Parse(args)
+
+	if err := storage.Init(cfg); err != nil {
+		return err
+	}
+
+	opts := jobs.StorageGCOptions(cfg, *dryRun)
+	opts.TempTTL = time.Duration(*tempTTL) * time.Hour
+	opts.Force = *force
+	report, err := models.RunStorageGC(context.Background(), opts)
+	if err != nil {
+		return err
+	}
+
+	action := "已清理"
+	if *dryRun {
+		action = "发现"
+	}
+	log.Printf("%s: 过期临时附件 %d 个，孤儿文件 %d 个（%d 字节），文件丢失的记录 %d 个（去重文件 %d、早期附件 %d、缩略图 %d），引用计数异常 %d 个",
+		action, report.ExpiredTemp, report.OrphanFiles, report.OrphanBytes,
+		report.MissingBlobs+report.MissingLegacy+report.MissingThumbnail,
+		report.MissingBlobs, report.MissingLegacy, report.MissingThumbnail, report.RefCountFixed)
+	if report.MissingSkipped {
+		log.Printf("文件丢失的记录比例过高，未删除这些记录，请检查存储配置；确认无误后使用 -force 删除")
+	}
+	if report.Errors > 0 {
+		return fmt.Errorf("清理过程中有 %d 个错误", report.Errors)
+	}
+	return nil
+}
+
+// copyObject 将对象从src复制到dst
+func copyObject(ctx context.Context, src, dst storage.Storage, key string, size int64, contentType string) error {
+	reader, err := src.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	return dst.Put(ctx, key, reader, size, contentType)
+}
+
+// ExitOnCommand 如果命令行指定了子命令则执行并退出
+func ExitOnCommand(cfg *config.Config) {
+	if len(os.Args) < 2 {
+		return
+	}
+
+	if err := runCommand(cfg, os.Args[1], os.Args[2:]); err != nil {
+		log.Fatalf("命令执行失败: %v", err)
+	}
+	os.Exit(0)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	
 	"github.com/joho/godotenv"
 )
@@ -28,7 +29,38 @@ type Config struct {
 	AdminEmail    string
 
 	// 上传文件配置
-	UploadDir     string // 上传文件的根目录
+	UploadDir         string         // 上传文件的根目录
+	AttachmentURLTTL  int            // 附件签名URL的有效期（分钟）
+	StorageBackend    string         // 附件存储后端：local 或 s3
+	UploadPartialDir  string         // 断点续传未完成文件的保存目录
+	UploadExpiration  int            // 断点续传未完成上传的保留时间（小时）
+	UploadMaxSize     int64          // 单个文件的最大大小（MB）
+	ThumbnailSizes    map[string]int // 图片缩略图尺寸：名称 -> 最长边像素
+	ImageMaxSize      int            // 上传图片的最长边超过该值时缩小（像素），0表示不缩小
+	ImageQuality      int            // 上传图片重新压缩为JPEG时的质量（1-100）
+	UploadAllowed     []string       // 允许上传的文件类型，支持 image/* 形式的通配符，为空时允许所有类型
+	UploadDenied      []string       // 禁止上传的文件类型，优先于UploadAllowed
+	UploadTypeSizes   map[string]int // 按文件类型限制的最大大小（MB），未列出的类型使用UploadMaxSize
+	UserStorageQuota  int64          // 普通用户默认的存储空间配额（MB），0表示不限制
+	AdminStorageQuota int64          // 管理员默认的存储空间配额（MB），0表示不限制
+	TempAttachmentTTL int            // 未关联到笔记的临时附件的保留时间（小时）
+	StorageGCInterval int            // 定期清理存储的间隔（小时），0表示不自动清理
+	ExtractMaxSize    int64          // 提取文本的附件的最大大小（MB），0表示不限制
+	ImportMaxSize     int64          // 导入的ZIP解压后的最大总大小（MB）
+	ExportDir         string         // 导出的ZIP的保存目录
+	ExportTTL         int            // 导出的ZIP的保留时间（小时），0表示不自动删除
+	S3                S3Config
+	
+	// AI配置（OpenAI兼容的对话接口）
+	AIBaseURL string // 接口地址，例如 https://api.openai.com/v1
+	AIAPIKey  string // 接口密钥，为空时不启用大模型
+	AIModel   string // 对话模型名称
+	
+	// 后台任务配置
+	JobWorkers      int // 后台任务并发执行的worker数量
+	BulkJobWorkers  int // 执行导入、导出等批量任务的worker数量，与普通任务分开
+	AIDailyQuota    int // 每个用户每天可调用AI的次数
+	AIMaxConcurrent int // 每个用户同时执行的AI任务数量上限
 }
 
 // DatabaseConfig 数据库配置
@@ -42,6 +74,16 @@ type DatabaseConfig struct {
 	SSLMode  string
 }
 
+// S3Config S3兼容对象存储配置
+type S3Config struct {
+	Endpoint     string
+	Region       string
+	Bucket       string
+	AccessKey    string
+	SecretKey    string
+	UsePathStyle bool
+}
+
 // DSN 返回数据库连接字符串
 func (db *DatabaseConfig) DSN() string {
 	switch db.Type {
@@ -88,6 +130,38 @@ func LoadConfig() (*Config, error) {
 
 	// 上传文件配置
 	uploadDir := getEnv("UPLOAD_DIR", "uploads")
+	attachmentURLTTL, _ := strconv.Atoi(getEnv("ATTACHMENT_URL_TTL", "60"))
+	storageBackend := getEnv("STORAGE_BACKEND", "local")
+	uploadPartialDir := getEnv("UPLOAD_PARTIAL_DIR", "uploads_partial")
+	uploadExpiration, _ := strconv.Atoi(getEnv("UPLOAD_EXPIRATION", "24"))
+	uploadMaxSize, _ := strconv.ParseInt(getEnv("UPLOAD_MAX_SIZE", "512"), 10, 64)
+	thumbnailSizes := parseThumbnailSizes(getEnv("THUMBNAIL_SIZES", "thumb:256,medium:1024"))
+	imageMaxSize, _ := strconv.Atoi(getEnv("IMAGE_MAX_SIZE", "4096"))
+	imageQuality, _ := strconv.Atoi(getEnv("IMAGE_QUALITY", "85"))
+	uploadAllowed := parseList(getEnv("UPLOAD_ALLOWED_TYPES", ""))
+	uploadDenied := parseList(getEnv("UPLOAD_DENIED_TYPES",
+		"application/vnd.microsoft.portable-executable,application/x-elf,application/x-mach-binary,application/x-msdownload"))
+	uploadTypeSizes := parseNamedInts(getEnv("UPLOAD_TYPE_MAX_SIZES", "image/*:50"))
+	userStorageQuota, _ := strconv.ParseInt(getEnv("STORAGE_QUOTA_USER", "1024"), 10, 64)
+	adminStorageQuota, _ := strconv.ParseInt(getEnv("STORAGE_QUOTA_ADMIN", "0"), 10, 64)
+	tempAttachmentTTL, _ := strconv.Atoi(getEnv("TEMP_ATTACHMENT_TTL", "24"))
+	storageGCInterval, _ := strconv.Atoi(getEnv("STORAGE_GC_INTERVAL", "24"))
+	extractMaxSize, _ := strconv.ParseInt(getEnv("TEXT_EXTRACT_MAX_SIZE", "50"), 10, 64)
+	importMaxSize, _ := strconv.ParseInt(getEnv("IMPORT_MAX_SIZE", "2048"), 10, 64)
+	exportDir := getEnv("EXPORT_DIR", "exports")
+	exportTTL, _ := strconv.Atoi(getEnv("EXPORT_TTL", "24"))
+	s3PathStyle, _ := strconv.ParseBool(getEnv("S3_USE_PATH_STYLE", "true"))
+	
+	// AI配置
+	aiBaseURL := getEnv("AI_BASE_URL", "https://api.openai.com/v1")
+	aiAPIKey := getEnv("AI_API_KEY", "")
+	aiModel := getEnv("AI_MODEL", "gpt-3.5-turbo")
+	
+	// 后台任务配置
+	jobWorkers, _ := strconv.Atoi(getEnv("JOB_WORKERS", "4"))
+	bulkJobWorkers, _ := strconv.Atoi(getEnv("JOB_BULK_WORKERS", "1"))
+	aiDailyQuota, _ := strconv.Atoi(getEnv("AI_DAILY_QUOTA", "100"))
+	aiMaxConcurrent, _ := strconv.Atoi(getEnv("AI_MAX_CONCURRENT", "2"))
 	
 	return &Config{
 		ServerHost: serverHost,
@@ -111,7 +185,43 @@ func LoadConfig() (*Config, error) {
 		AdminPassword: adminPassword,
 		AdminEmail:    adminEmail,
 
-		UploadDir: uploadDir,
+		UploadDir:         uploadDir,
+		AttachmentURLTTL:  attachmentURLTTL,
+		StorageBackend:    storageBackend,
+		UploadPartialDir:  uploadPartialDir,
+		UploadExpiration:  uploadExpiration,
+		UploadMaxSize:     uploadMaxSize,
+		ThumbnailSizes:    thumbnailSizes,
+		ImageMaxSize:      imageMaxSize,
+		ImageQuality:      imageQuality,
+		UploadAllowed:     uploadAllowed,
+		UploadDenied:      uploadDenied,
+		UploadTypeSizes:   uploadTypeSizes,
+		UserStorageQuota:  userStorageQuota,
+		AdminStorageQuota: adminStorageQuota,
+		TempAttachmentTTL: tempAttachmentTTL,
+		StorageGCInterval: storageGCInterval,
+		ExtractMaxSize:    extractMaxSize,
+		ImportMaxSize:     importMaxSize,
+		ExportDir:         exportDir,
+		ExportTTL:         exportTTL,
+		S3: S3Config{
+			Endpoint:     getEnv("S3_ENDPOINT", ""),
+			Region:       getEnv("S3_REGION", "us-east-1"),
+			Bucket:       getEnv("S3_BUCKET", ""),
+			AccessKey:    getEnv("S3_ACCESS_KEY", ""),
+			SecretKey:    getEnv("S3_SECRET_KEY", ""),
+			UsePathStyle: s3PathStyle,
+		},
+		
+		AIBaseURL: aiBaseURL,
+		AIAPIKey:  aiAPIKey,
+		AIModel:   aiModel,
+		
+		JobWorkers:      jobWorkers,
+		BulkJobWorkers:  bulkJobWorkers,
+		AIDailyQuota:    aiDailyQuota,
+		AIMaxConcurrent: aiMaxConcurrent,
 	}, nil
 }
 
@@ -122,4 +232,42 @@ func getEnv(key, defaultValue string) string {
 		return defaultValue
 	}
 	return value
-} 
\ No newline at end of file
+}
+
+// parseThumbnailSizes 解析缩略图尺寸配置，格式为逗号分隔的“名称:像素”，例如 thumb:256,medium:1024
+// 缺少 thumb 时使用默认的256像素
+func parseThumbnailSizes(value string) map[string]int {
+	sizes := parseNamedInts(value)
+	if _, ok := sizes["thumb"]; !ok {
+		sizes["thumb"] = 256
+	}
+	return sizes
+}
+
+// parseNamedInts 解析逗号分隔的“名称:正整数”列表，无效的项会被忽略
+func parseNamedInts(value string) map[string]int {
+	values := make(map[string]int)
+	for _, item := range parseList(value) {
+		idx := strings.LastIndex(item, ":")
+		if idx <= 0 {
+			continue
+		}
+		number, err := strconv.Atoi(strings.TrimSpace(item[idx+1:]))
+		if err != nil || number <= 0 {
+			continue
+		}
+		values[strings.TrimSpace(item[:idx])] = number
+	}
+	return values
+}
+
+// parseList 解析逗号分隔的列表，忽略空项
+func parseList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	
+	"cyi-note/backend/jobs"
 	"cyi-note/backend/models"
 	"cyi-note/backend/utils"
 )
@@ -29,6 +30,12 @@ type UpdateUserRoleRequest struct {
 	Role string `json:"role" binding:"required,oneof=admin user"`
 }
 
+// UpdateUserQuotaRequest 更新用户存储空间配额请求
+// StorageQuota 单位为字节，为null时恢复为角色的默认配额，0表示不限制
+type UpdateUserQuotaRequest struct {
+	StorageQuota *int64 `json:"storage_quota" binding:"omitempty,min=0"`
+}
+
 // GetUsers 获取所有用户（分页）
 func GetUsers(c *gin.Context) {
 	var params UserListParams
@@ -169,6 +176,42 @@ func UpdateUserRole(c *gin.Context) {
 	utils.OkResponse(c, user, "更新用户角色成功")
 }
 
+// UpdateUserQuota 更新用户的存储空间配额
+func UpdateUserQuota(c *gin.Context) {
+	// 获取用户ID
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.BadRequestResponse(c, "无效的用户ID")
+		return
+	}
+	
+	var req UpdateUserQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, "无效的请求参数")
+		return
+	}
+	
+	// 获取要更新的用户以确保存在
+	if _, err := models.GetUserByID(uint(userID)); err != nil {
+		utils.NotFoundResponse(c, "用户不存在")
+		return
+	}
+	
+	if err := models.UpdateUserStorageQuota(uint(userID), req.StorageQuota); err != nil {
+		utils.ServerErrorResponse(c, "更新存储空间配额失败")
+		return
+	}
+	
+	// 返回更新后的使用情况
+	usage, err := models.GetStorageUsage(uint(userID))
+	if err != nil {
+		utils.ServerErrorResponse(c, "获取存储空间使用情况失败")
+		return
+	}
+	
+	utils.OkResponse(c, usage, "更新存储空间配额成功")
+}
+
 // DeleteUser 管理员删除用户
 func DeleteUserByAdmin(c *gin.Context) {
 	// 获取用户ID
@@ -202,4 +245,34 @@ func DeleteUserByAdmin(c *gin.Context) {
 	
 	// 返回成功消息
 	utils.OkResponse(c, nil, "用户已删除")
-} 
\ No newline at end of file
+}
+
+// BackfillThumbnails 创建为已有图片补全缩略图的后台任务
+// 任务进度可以通过 /api/ai/jobs/:id 查询
+func BackfillThumbnails(c *gin.Context) {
+	// 获取当前管理员ID
+	adminID, _ := c.Get("userID")
+	
+	job, err := jobs.Enqueue(adminID.(uint), jobs.TypeThumbnailBackfill, nil, struct{}{})
+	if err != nil {
+		utils.ServerErrorResponse(c, "创建任务失败")
+		return
+	}
+	
+	utils.AcceptedResponse(c, job, "缩略图补全任务已加入队列")
+}
+
+// BackfillAttachmentText 创建为已有附件提取文本的后台任务
+// 任务进度可以通过 /api/ai/jobs/:id 查询
+func BackfillAttachmentText(c *gin.Context) {
+	// 获取当前管理员ID
+	adminID, _ := c.Get("userID")
+	
+	job, err := jobs.Enqueue(adminID.(uint), jobs.TypeTextBackfill, nil, struct{}{})
+	if err != nil {
+		utils.ServerErrorResponse(c, "创建任务失败")
+		return
+	}
+	
+	utils.AcceptedResponse(c, job, "附件文本提取任务已加入队列")
+}
@@ -1,14 +1,31 @@
 package controllers
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
 	"strconv"
+	"strings"
+	"time"
 	
 	"github.com/gin-gonic/gin"
 	
+	"cyi-note/backend/config"
+	"cyi-note/backend/jobs"
 	"cyi-note/backend/models"
 	"cyi-note/backend/utils"
 )
 
+// 全局对话模型客户端
+var chatClient *utils.ChatClient
+
+// InitAIController 初始化AI控制器
+func InitAIController(cfg *config.Config) {
+	chatClient = utils.NewChatClient(cfg.AIBaseURL, cfg.AIAPIKey, cfg.AIModel)
+}
+
 // AI标签生成请求
 type GenerateTagsRequest struct {
 	Content string `json:"content" binding:"required"`
@@ -19,9 +36,28 @@ type GenerateSummaryRequest struct {
 	Content string `json:"content" binding:"required"`
 }
 
+// 笔记问答请求
+type AskRequest struct {
+	Question string `json:"question" binding:"required"`
+	TopK     int    `json:"top_k"`  // 检索的片段数量，默认5
+	Stream   *bool  `json:"stream"` // 是否以SSE流式返回，默认true
+}
+
+// 问答引用
+type AskCitation struct {
+	Index  int    `json:"index"` // 对应回答中的[n]标记
+	NoteID uint   `json:"note_id"`
+	Title  string `json:"title"`
+	Quote  string `json:"quote"` // 引用的原文片段
+	Start  int    `json:"start"` // 引用在笔记内容中的起始位置（按字符计）
+	End    int    `json:"end"`
+}
+
 // 生成标签建议请求
 type GenerateTagSuggestionsRequest struct {
 	Content string `json:"content" binding:"required"`
+	NoteID  *uint  `json:"note_id"` // 可选，提供时排除笔记已有的标签和被拒绝过的建议
+	Limit   int    `json:"limit"`   // 建议数量，默认10
 }
 
 // GenerateTags 生成标签
@@ -54,7 +90,7 @@ func GenerateTags(c *gin.Context) {
 	}, "标签生成成功")
 }
 
-// GenerateTagSuggestions 生成标签建议
+// GenerateTagSuggestions 生成标签建议，分为已有标签和新标签两组
 func GenerateTagSuggestions(c *gin.Context) {
 	var req GenerateTagSuggestionsRequest
 	
@@ -64,19 +100,56 @@ func GenerateTagSuggestions(c *gin.Context) {
 		return
 	}
 	
+	limit := req.Limit
+	if limit <= 0 || limit > 50 {
+		limit = 10
+	}
+	
+	// 获取当前用户ID
+	userID, _ := c.Get("userID")
+	
+	// 检查笔记所有权
+	if req.NoteID != nil {
+		note, err := models.GetNoteByID(*req.NoteID)
+		if err != nil {
+			utils.NotFoundResponse(c, "笔记未找到")
+			return
+		}
+		
+		if note.UserID != userID.(uint) {
+			utils.ForbiddenResponse(c, "无权访问此笔记")
+			return
+		}
+	}
+	
 	// 生成标签建议
-	tags, err := utils.GenerateTagSuggestions(req.Content)
+	suggestions, err := jobs.SuggestTags(userID.(uint), req.NoteID, req.Content, limit)
 	if err != nil {
 		utils.ServerErrorResponse(c, "生成标签建议失败")
 		return
 	}
 	
+	existing := []utils.TagSuggestion{}
+	created := []utils.TagSuggestion{}
+	for _, suggestion := range suggestions {
+		if suggestion.Existing {
+			existing = append(existing, suggestion)
+		} else {
+			created = append(created, suggestion)
+		}
+	}
+	
 	utils.OkResponse(c, gin.H{
-		"tags": tags,
+		"existing_tags": existing,
+		"new_tags":      created,
 	}, "标签建议生成成功")
 }
 
+// 同步接口等待后台任务完成的最长时间
+const summaryWaitTimeout = 10 * time.Second
+
 // GenerateSummary 生成内容摘要
+// 摘要在后台任务中生成，短时间内完成时直接返回结果，否则返回任务信息供客户端轮询
 func GenerateSummary(c *gin.Context) {
 	var req GenerateSummaryRequest
 	
@@ -86,60 +159,346 @@ func GenerateSummary(c *gin.Context) {
 		return
 	}
 	
-	// 检查是否提供了笔记ID
-	noteIDStr := c.Query("note_id")
-	if noteIDStr == "" {
-		// 如果没有提供笔记ID，只返回生成的摘要
-		summary, err := utils.GenerateSummary(req.Content)
+	// 获取当前用户ID
+	userID, _ := c.Get("userID")
+	
+	// 如果提供了笔记ID，检查笔记所有权，摘要生成后会写回笔记
+	var noteID *uint
+	if noteIDStr := c.Query("note_id"); noteIDStr != "" {
+		id, err := strconv.ParseUint(noteIDStr, 10, 64)
+		if err != nil {
+			utils.BadRequestResponse(c, "无效的笔记ID")
+			return
+		}
+		
+		note, err := models.GetNoteByID(uint(id))
 		if err != nil {
-			utils.ServerErrorResponse(c, "生成摘要失败")
+			utils.NotFoundResponse(c, "笔记未找到")
+			return
+		}
+		
+		if note.UserID != userID.(uint) {
+			utils.ForbiddenResponse(c, "无权修改此笔记")
 			return
 		}
 		
+		noteIDValue := note.ID
+		noteID = &noteIDValue
+	}
+	
+	// 创建摘要任务
+	job, err := jobs.Enqueue(userID.(uint), jobs.TypeSummary, noteID, jobs.ContentInput{Content: req.Content})
+	if err != nil {
+		jobErrorResponse(c, err, "生成摘要失败")
+		return
+	}
+	
+	// 短暂等待任务完成
+	job, err = jobs.Wait(c.Request.Context(), job.ID, summaryWaitTimeout)
+	if err != nil {
+		utils.ServerErrorResponse(c, "获取摘要任务失败")
+		return
+	}
+	
+	switch job.Status {
+	case models.JobStatusDone:
+		var result jobs.SummaryResult
+		json.Unmarshal(job.Output, &result)
+		
+		message := "摘要生成成功"
+		if noteID != nil {
+			message = "摘要生成并更新成功"
+		}
 		utils.OkResponse(c, gin.H{
-			"summary": summary,
-		}, "摘要生成成功")
+			"summary": result.Summary,
+			"job_id":  job.ID,
+			"cached":  job.Cached,
+		}, message)
+	case models.JobStatusFailed:
+		utils.ServerErrorResponse(c, "生成摘要失败: "+job.Error)
+	default:
+		utils.AcceptedResponse(c, job, "摘要正在生成，请稍后查询任务结果")
+	}
+}
+
+// AI任务请求
+type CreateAIJobRequest struct {
+	Type    string `json:"type" binding:"required"`
+	Content string `json:"content" binding:"required"`
+	NoteID  *uint  `json:"note_id"`
+}
+
+// CreateAIJob 创建AI后台任务
+func CreateAIJob(c *gin.Context) {
+	var req CreateAIJobRequest
+	
+	// 验证请求
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, "无效的请求参数")
+		return
+	}
+	
+	// 获取当前用户ID
+	userID, _ := c.Get("userID")
+	
+	// 检查笔记所有权
+	if req.NoteID != nil {
+		note, err := models.GetNoteByID(*req.NoteID)
+		if err != nil {
+			utils.NotFoundResponse(c, "笔记未找到")
+			return
+		}
+		
+		if note.UserID != userID.(uint) {
+			utils.ForbiddenResponse(c, "无权修改此笔记")
+			return
+		}
+	}
+	
+	job, err := jobs.Enqueue(userID.(uint), req.Type, req.NoteID, jobs.ContentInput{Content: req.Content})
+	if err != nil {
+		jobErrorResponse(c, err, "创建任务失败")
+		return
+	}
+	
+	if job.Status == models.JobStatusDone {
+		utils.OkResponse(c, job, "任务已完成")
+		return
+	}
+	
+	utils.AcceptedResponse(c, job, "任务已加入队列")
+}
+
+// GetAIJob 获取AI任务状态和结果
+func GetAIJob(c *gin.Context) {
+	// 获取任务ID
+	jobID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.BadRequestResponse(c, "无效的任务ID")
 		return
 	}
 	
-	// 如果提供了笔记ID，更新笔记的摘要
-	noteID, err := strconv.ParseUint(noteIDStr, 10, 64)
+	// 获取任务
+	job, err := models.GetJobByID(uint(jobID))
 	if err != nil {
-		utils.BadRequestResponse(c, "无效的笔记ID")
+		utils.NotFoundResponse(c, "任务未找到")
+		return
+	}
+	
+	// 检查任务所有权
+	userID, _ := c.Get("userID")
+	if job.UserID != userID.(uint) {
+		utils.ForbiddenResponse(c, "无权访问此任务")
 		return
 	}
 	
+	utils.OkResponse(c, job, "获取任务成功")
+}
+
+// GetAIJobs 获取当前用户最近的AI任务
+func GetAIJobs(c *gin.Context) {
 	// 获取当前用户ID
 	userID, _ := c.Get("userID")
 	
-	// 获取笔记
-	note, err := models.GetNoteByID(uint(noteID))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	
+	var jobTypes []string
+	if jobType := c.Query("type"); jobType != "" {
+		jobTypes = []string{jobType}
+	}
+	jobList, err := models.GetJobsByUserID(userID.(uint), jobTypes, limit)
 	if err != nil {
-		utils.NotFoundResponse(c, "笔记未找到")
+		utils.ServerErrorResponse(c, "获取任务列表失败")
 		return
 	}
 	
-	// 检查笔记所有权
-	if note.UserID != userID.(uint) {
-		utils.ForbiddenResponse(c, "无权修改此笔记")
+	utils.OkResponse(c, jobList, "获取任务列表成功")
+}
+
+// GetAIQuota 获取当前用户的AI配额使用情况
+func GetAIQuota(c *gin.Context) {
+	// 获取当前用户ID
+	userID, _ := c.Get("userID")
+	
+	status, err := jobs.GetQuotaStatus(userID.(uint))
+	if err != nil {
+		utils.ServerErrorResponse(c, "获取AI配额失败")
 		return
 	}
 	
-	// 生成摘要
-	summary, err := utils.GenerateSummary(req.Content)
+	utils.OkResponse(c, status, "获取AI配额成功")
+}
+
+// jobErrorResponse 将创建任务的错误转换为响应
+func jobErrorResponse(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, models.ErrAIQuotaExceeded), errors.Is(err, models.ErrTooManyRunningJobs):
+		utils.TooManyRequestsResponse(c, err.Error())
+	case errors.Is(err, jobs.ErrUnknownJobType):
+		utils.BadRequestResponse(c, err.Error())
+	default:
+		utils.ServerErrorResponse(c, message)
+	}
+}
+
+// 问答检索参数
+const (
+	askCandidateNotes = 50  // 参与检索的候选笔记数量上限
+	askChunkRunes     = 500 // 单个片段的最大字符数
+	askDefaultTopK    = 5
+	askMaxTopK        = 10
+)
+
+// 回答中的引用标记，例如[1]
+var citationPattern = regexp.MustCompile(`\[(\d+)\]`)
+
+// AskNotes 基于当前用户的笔记回答问题
+func AskNotes(c *gin.Context) {
+	var req AskRequest
+	
+	// 验证请求
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Question) == "" {
+		utils.BadRequestResponse(c, "无效的请求参数")
+		return
+	}
+	
+	if !chatClient.Enabled() {
+		utils.ErrorResponse(c, http.StatusServiceUnavailable, "未配置AI对话模型")
+		return
+	}
+	
+	topK := req.TopK
+	if topK <= 0 {
+		topK = askDefaultTopK
+	} else if topK > askMaxTopK {
+		topK = askMaxTopK
+	}
+	
+	// 获取当前用户ID
+	userID, _ := c.Get("userID")
+	
+	// 检索相关笔记片段
+	notes, err := models.GetNotesForRetrieval(userID.(uint), utils.Tokenize(req.Question), askCandidateNotes)
 	if err != nil {
-		utils.ServerErrorResponse(c, "生成摘要失败")
+		utils.ServerErrorResponse(c, "检索笔记失败")
 		return
 	}
 	
-	// 更新笔记摘要
-	note.Summary = summary
-	if err := models.UpdateNote(note); err != nil {
-		utils.ServerErrorResponse(c, "更新笔记摘要失败")
+	var chunks []utils.TextChunk
+	for _, note := range notes {
+		chunks = append(chunks, utils.SplitChunks(note.ID, note.Title, note.Content, askChunkRunes)...)
+	}
+	sources := utils.RankChunks(req.Question, chunks, topK)
+	
+	// 构建引用列表，序号从1开始
+	citations := make([]AskCitation, 0, len(sources))
+	for i, source := range sources {
+		quote, start, end := utils.QuoteSpan(source.TextChunk, req.Question)
+		citations = append(citations, AskCitation{
+			Index:  i + 1,
+			NoteID: source.NoteID,
+			Title:  source.Title,
+			Quote:  quote,
+			Start:  start,
+			End:    end,
+		})
+	}
+	
+	messages := buildAskPrompt(req.Question, sources)
+	
+	// 消耗AI调用次数并占用一个AI任务并发数，调用失败时退还次数
+	job, err := jobs.Begin(userID.(uint), jobs.TypeAsk, nil, gin.H{"question": req.Question})
+	if err != nil {
+		jobErrorResponse(c, err, "检查AI配额失败")
 		return
 	}
 	
-	utils.OkResponse(c, gin.H{
-		"summary": summary,
-	}, "摘要生成并更新成功")
-} 
\ No newline at end of file
+	// 非流式：直接返回完整回答
+	if req.Stream != nil && !*req.Stream {
+		answer, err := chatClient.Complete(c.Request.Context(), messages)
+		if err != nil {
+			jobs.Fail(job, err)
+			utils.ServerErrorResponse(c, "生成回答失败")
+			return
+		}
+		
+		result := gin.H{
+			"answer":    answer,
+			"citations": citedOnly(answer, citations),
+		}
+		jobs.Finish(job, result)
+		utils.OkResponse(c, result, "回答生成成功")
+		return
+	}
+	
+	// 流式：先推送检索到的片段，再逐段推送回答
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	
+	c.SSEvent("sources", citations)
+	c.Writer.Flush()
+	
+	answer, err := chatClient.Stream(c.Request.Context(), messages, func(delta string) error {
+		c.SSEvent("token", gin.H{"content": delta})
+		c.Writer.Flush()
+		return nil
+	})
+	if err != nil {
+		jobs.Fail(job, err)
+		c.SSEvent("error", gin.H{"error": "生成回答失败"})
+		c.Writer.Flush()
+		return
+	}
+	
+	result := gin.H{
+		"answer":    answer,
+		"citations": citedOnly(answer, citations),
+	}
+	jobs.Finish(job, result)
+	c.SSEvent("done", result)
+	c.Writer.Flush()
+}
+
+// buildAskPrompt 构建基于笔记片段的问答提示词
+func buildAskPrompt(question string, sources []utils.ScoredChunk) []utils.ChatMessage {
+	var context strings.Builder
+	if len(sources) == 0 {
+		context.WriteString("（没有找到相关的笔记内容）\n")
+	}
+	for i, source := range sources {
+		context.WriteString(fmt.Sprintf("[%d] 《%s》\n%s\n\n", i+1, source.Title, source.Text))
+	}
+	
+	system := "你是一个笔记助手，只能根据用户提供的笔记片段回答问题。" +
+		"回答时在引用的句子后用[编号]标注来源，例如[1]。" +
+		"如果笔记片段中没有足够的信息，请直接说明无法从笔记中找到答案，不要编造内容。" +
+		"使用与问题相同的语言回答。"
+	
+	return []utils.ChatMessage{
+		{Role: "system", Content: system},
+		{Role: "user", Content: "笔记片段：\n" + context.String() + "问题：" + question},
+	}
+}
+
+// citedOnly 只保留回答中实际引用到的片段
+func citedOnly(answer string, citations []AskCitation) []AskCitation {
+	cited := make(map[int]bool)
+	for _, match := range citationPattern.FindAllStringSubmatch(answer, -1) {
+		if index, err := strconv.Atoi(match[1]); err == nil {
+			cited[index] = true
+		}
+	}
+	
+	result := make([]AskCitation, 0, len(cited))
+	for _, citation := range citations {
+		if cited[citation.Index] {
+			result = append(result, citation)
+		}
+	}
+	return result
+}
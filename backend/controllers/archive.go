@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"cyi-note/backend/models"
+	"cyi-note/backend/storage"
+	"cyi-note/backend/utils"
+)
+
+// DownloadNoteAttachments 将笔记的所有附件打包为ZIP下载
+func DownloadNoteAttachments(c *gin.Context) {
+	// 获取笔记ID
+	noteID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.BadRequestResponse(c, "无效的笔记ID")
+		return
+	}
+
+	// 获取当前用户ID
+	userID, _ := c.Get("userID")
+
+	// 检查笔记是否属于当前用户
+	note, err := models.GetNoteByID(uint(noteID))
+	if err != nil {
+		utils.NotFoundResponse(c, "笔记未找到")
+		return
+	}
+	if note.UserID != userID.(uint) {
+		utils.ForbiddenResponse(c, "无权访问此笔记的附件")
+		return
+	}
+
+	attachments, err := models.GetAttachmentsByNoteID(note.ID)
+	if err != nil {
+		utils.ServerErrorResponse(c, "获取附件失败")
+		return
+	}
+	if len(attachments) == 0 {
+		utils.NotFoundResponse(c, "笔记没有附件")
+		return
+	}
+
+	writeAttachmentsZip(c, note.Title+".zip", attachments)
+}
+
+// DownloadAttachments 将选中的附件打包为ZIP下载
+// 使用 ids=1,2,3 指定附件，或使用 start_date、end_date（YYYY-MM-DD，包含结束日期）和可选的 filetype 按上传日期选择资源库中的附件
+func DownloadAttachments(c *gin.Context) {
+	// 获取当前用户ID
+	userID, _ := c.Get("userID")
+
+	var attachments []models.Attachment
+	var archiveName string
+
+	if ids := c.Query("ids"); ids != "" {
+		// 按ID选择
+		var attachmentIDs []uint
+		for _, value := range strings.Split(ids, ",") {
+			id, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+			if err != nil {
+				utils.BadRequestResponse(c, "无效的附件ID")
+				return
+			}
+			attachmentIDs = append(attachmentIDs, uint(id))
+		}
+
+		var err error
+		attachments, err = models.GetAttachmentsByIDs(attachmentIDs)
+		if err != nil {
+			utils.ServerErrorResponse(c, "获取附件失败")
+			return
+		}
+		if len(attachments) == 0 {
+			utils.NotFoundResponse(c, "附件未找到")
+			return
+		}
+		for i := range attachments {
+			if !canAccessAttachment(&attachments[i], userID.(uint)) {
+				utils.ForbiddenResponse(c, "无权访问此附件")
+				return
+			}
+		}
+		archiveName = "attachments.zip"
+	} else {
+		// 按上传日期选择
+		start, err := time.ParseInLocation("2006-01-02", c.Query("start_date"), time.Local)
+		if err != nil {
+			utils.BadRequestResponse(c, "请提供附件ID或有效的开始日期")
+			return
+		}
+		end, err := time.ParseInLocation("2006-01-02", c.DefaultQuery("end_date", c.Query("start_date")), time.Local)
+		if err != nil || end.Before(start) {
+			utils.BadRequestResponse(c, "无效的结束日期")
+			return
+		}
+
+		attachments, err = models.GetAttachmentsInDateRange(userID.(uint), start, end.AddDate(0, 0, 1), c.Query("filetype"))
+		if err != nil {
+			utils.ServerErrorResponse(c, "获取附件失败")
+			return
+		}
+		if len(attachments) == 0 {
+			utils.NotFoundResponse(c, "该日期范围内没有附件")
+			return
+		}
+		archiveName = fmt.Sprintf("attachments-%s-%s.zip", start.Format("2006-01-02"), end.Format("2006-01-02"))
+	}
+
+	writeAttachmentsZip(c, archiveName, attachments)
+}
+
+// writeAttachmentsZip 将附件逐个从存储后端读取并写入ZIP响应，不会把整个压缩包放在内存中
+// 文件名保留附件的原始名称，重名时自动添加序号；文件已丢失的附件会被跳过
+func writeAttachmentsZip(c *gin.Context, archiveName string, attachments []models.Attachment) {
+	archiveName = utils.SafeArchiveName(archiveName)
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"; filename*=UTF-8''%s`,
+		archiveName, url.QueryEscape(archiveName)))
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	ctx := c.Request.Context()
+	zipWriter := zip.NewWriter(c.Writer)
+	namer := utils.NewArchiveNamer()
+
+	for i := range attachments {
+		attachment := &attachments[i]
+		if err := writeZipEntry(c, zipWriter, namer, attachment); err != nil {
+			if errors.Is(err, storage.ErrNotExist) {
+				log.Printf("打包附件 %d 时文件不存在，已跳过", attachment.ID)
+				continue
+			}
+			// 响应已经开始发送，只能中止
+			log.Printf("打包附件 %d 失败: %v", attachment.ID, err)
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+
+	if err := zipWriter.Close(); err != nil {
+		log.Printf("写入ZIP失败: %v", err)
+	}
+}
+
+// writeZipEntry 将单个附件写入ZIP，已压缩的格式直接存储
+func writeZipEntry(c *gin.Context, zipWriter *zip.Writer, namer *utils.ArchiveNamer, attachment *models.Attachment) error {
+	reader, err := storage.Current().Get(c.Request.Context(), attachment.StorageKey())
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	header := &zip.FileHeader{
+		Name:     namer.Name(attachment.Filename),
+		Method:   zip.Deflate,
+		Modified: attachment.CreatedAt,
+	}
+	if utils.IsCompressedType(attachment.Filetype) {
+		header.Method = zip.Store
+	}
+
+	entry, err := zipWriter.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, reader)
+	return err
+}
@@ -1,34 +1,76 @@
 package controllers
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 	
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 	
 	"cyi-note/backend/config"
+	"cyi-note/backend/jobs"
+	"cyi-note/backend/middleware"
 	"cyi-note/backend/models"
+	"cyi-note/backend/storage"
 	"cyi-note/backend/utils"
 )
 
-// 全局变量存储上传目录
-var uploadBaseDir string
-
 // InitAttachmentController 初始化附件控制器
 func InitAttachmentController(cfg *config.Config) {
-	// 使用配置中的上传目录
-	uploadBaseDir = cfg.UploadDir
+	// 初始化附件存储后端
+	if err := storage.Init(cfg); err != nil {
+		panic(fmt.Sprintf("无法初始化附件存储: %v", err))
+	}
+	
+	// 初始化附件URL签名
+	utils.InitURLSigner(cfg.JWTSecret, time.Duration(cfg.AttachmentURLTTL)*time.Minute)
+	
+	// 设置上传文件的类型和大小限制
+	typeSizes := make(map[string]int64, len(cfg.UploadTypeSizes))
+	for contentType, size := range cfg.UploadTypeSizes {
+		typeSizes[contentType] = int64(size) * 1024 * 1024
+	}
+	models.SetUploadPolicy(utils.UploadPolicy{
+		Allowed:  cfg.UploadAllowed,
+		Denied:   cfg.UploadDenied,
+		MaxSizes: typeSizes,
+		MaxSize:  cfg.UploadMaxSize * 1024 * 1024,
+	})
 	
-	// 确保上传目录存在
-	if err := os.MkdirAll(uploadBaseDir, 0755); err != nil {
-		panic(fmt.Sprintf("无法创建上传目录 %s: %v", uploadBaseDir, err))
+	// 设置各角色默认的存储空间配额，并根据附件记录校正已使用的空间
+	models.SetRoleStorageQuotas(map[string]int64{
+		"user":  cfg.UserStorageQuota * 1024 * 1024,
+		"admin": cfg.AdminStorageQuota * 1024 * 1024,
+	})
+	if err := models.RecalculateStorageUsage(); err != nil {
+		log.Printf("统计用户已使用的存储空间失败: %v", err)
 	}
+	
+	// 为已有笔记建立附件引用记录
+	if err := models.RebuildAttachmentReferences(); err != nil {
+		log.Printf("建立附件引用记录失败: %v", err)
+	}
+	
+	// 设置图片缩略图尺寸和上传图片的规范化参数
+	models.SetThumbnailSizes(cfg.ThumbnailSizes)
+	models.SetImageOptions(utils.ImageOptions{
+		MaxDimension: cfg.ImageMaxSize,
+		JPEGQuality:  cfg.ImageQuality,
+	})
+	
+	// 设置提取文本的附件的最大大小
+	models.SetTextExtractMaxSize(cfg.ExtractMaxSize * 1024 * 1024)
 }
 
 // UploadAttachment 上传附件
@@ -62,18 +104,56 @@ func UploadAttachment(c *gin.Context) {
 		return
 	}
 	
-	// 获取上传的文件
+	// 保存上传的文件
+	attachment, ok := saveUploadedFile(c, uint(noteID), userID.(uint), false)
+	if !ok {
+		return
+	}
+	
+	utils.CreatedResponse(c, attachment, "附件上传成功")
+}
+
+// saveUploadedFile 保存上传的文件并创建附件记录，失败时写入错误响应并返回false
+// 客户端可以通过hash字段提供文件的SHA-256：已上传过相同内容时无需再次提交文件，
+// 同时提交文件时用于校验内容完整性
+func saveUploadedFile(c *gin.Context, noteID uint, userID uint, isTemp bool) (*models.Attachment, bool) {
+	hash := strings.ToLower(strings.TrimSpace(c.PostForm("hash")))
+	if hash != "" && !models.IsValidBlobHash(hash) {
+		utils.BadRequestResponse(c, "无效的文件哈希")
+		return nil, false
+	}
+	
 	file, err := c.FormFile("file")
 	if err != nil {
-		utils.BadRequestResponse(c, "获取上传文件失败")
-		return
+		if hash == "" {
+			utils.BadRequestResponse(c, "获取上传文件失败")
+			return nil, false
+		}
+		
+		// 未提交文件内容时，使用已上传过的相同文件
+		filename := c.PostForm("filename")
+		if filename == "" {
+			utils.BadRequestResponse(c, "请提供文件名")
+			return nil, false
+		}
+		attachment, err := models.CreateAttachmentFromHash(hash, filename, noteID, userID, isTemp)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.NotFoundResponse(c, "文件不存在，请上传文件内容")
+			return nil, false
+		}
+		if err != nil {
+			saveFileErrorResponse(c, err)
+			return nil, false
+		}
+		jobs.AttachmentSaved(attachment)
+		return attachment, true
 	}
 	
 	// 打开上传的文件
 	src, err := file.Open()
 	if err != nil {
 		utils.ServerErrorResponse(c, "打开上传文件失败")
-		return
+		return nil, false
 	}
 	defer src.Close()
 	
@@ -82,7 +162,7 @@ func UploadAttachment(c *gin.Context) {
 	tempFile, err := os.Create(tempFilePath)
 	if err != nil {
 		utils.ServerErrorResponse(c, "创建临时文件失败")
-		return
+		return nil, false
 	}
 	defer func() {
 		tempFile.Close()
@@ -92,34 +172,80 @@ func UploadAttachment(c *gin.Context) {
 	// 将上传文件内容复制到临时文件
 	if _, err = io.Copy(tempFile, src); err != nil {
 		utils.ServerErrorResponse(c, "保存上传文件失败")
-		return
+		return nil, false
 	}
 	
 	// 重置文件指针到文件开始
 	if _, err = tempFile.Seek(0, 0); err != nil {
 		utils.ServerErrorResponse(c, "重置文件指针失败")
-		return
+		return nil, false
 	}
 	
-	// 使用SaveFile函数保存附件
+	// 使用SaveFile函数保存附件，文件类型根据内容检测
 	attachment, err := models.SaveFile(
 		tempFile,
 		file.Filename,
-		uint(noteID),
-		file.Header.Get("Content-Type"),
-		userID.(uint),
-		false, // 非临时附件
+		noteID,
+		userID,
+		isTemp,
 	)
-	
 	if err != nil {
-		utils.ServerErrorResponse(c, "创建附件记录失败: " + err.Error())
+		saveFileErrorResponse(c, err)
+		return nil, false
+	}
+	
+	// 校验客户端提供的哈希
+	if hash != "" && attachment.Hash != hash {
+		models.DeleteAttachment(attachment.ID)
+		utils.BadRequestResponse(c, "文件内容与哈希不匹配")
+		return nil, false
+	}
+	
+	// 后台生成图片缩略图
+	jobs.AttachmentSaved(attachment)
+	
+	return attachment, true
+}
+
+// saveFileErrorResponse 根据保存附件失败的原因写入错误响应
+func saveFileErrorResponse(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, utils.ErrFileTypeNotAllowed):
+		utils.ErrorResponse(c, http.StatusUnsupportedMediaType, err.Error())
+	case errors.Is(err, utils.ErrFileTooLarge), errors.Is(err, models.ErrStorageQuotaExceeded):
+		utils.ErrorResponse(c, http.StatusRequestEntityTooLarge, err.Error())
+	case errors.Is(err, utils.ErrInvalidImage):
+		utils.BadRequestResponse(c, err.Error())
+	default:
+		// 其他错误可能包含存储后端的地址等内部信息，只写入日志
+		log.Printf("保存附件失败: %v", err)
+		utils.ServerErrorResponse(c, "创建附件记录失败")
+	}
+}
+
+// CheckAttachmentBlob 检查当前用户是否已上传过指定SHA-256的文件
+// 支持HEAD请求：200表示可以直接使用hash创建附件，404表示需要上传文件内容
+func CheckAttachmentBlob(c *gin.Context) {
+	hash := strings.ToLower(c.Param("hash"))
+	if !models.IsValidBlobHash(hash) {
+		utils.BadRequestResponse(c, "无效的文件哈希")
 		return
 	}
 	
-	// 设置文件URL，使用ID而不是文件路径，避免安全问题
-	attachment.FileURL = "/api/attachments/" + strconv.FormatUint(uint64(attachment.ID), 10)
+	// 获取当前用户ID
+	userID, _ := c.Get("userID")
 	
-	utils.CreatedResponse(c, attachment, "附件上传成功")
+	blob, err := models.GetUserBlobByHash(userID.(uint), hash)
+	if err != nil {
+		utils.NotFoundResponse(c, "文件不存在")
+		return
+	}
+	
+	utils.OkResponse(c, gin.H{
+		"hash":         blob.Hash,
+		"size":         blob.Size,
+		"content_type": blob.ContentType,
+	}, "文件已存在")
 }
 
 // GetAttachment 获取附件
@@ -138,58 +264,324 @@ func GetAttachment(c *gin.Context) {
 		return
 	}
 	
-	// 临时移除认证校验，方便测试图片显示
-	// 注意：如果需要认证，可以从URL参数获取token
-	token := c.Query("token")
-	fmt.Printf("从URL接收到的令牌: %s\n", token)
+	// 检查访问权限：有效的签名URL、附件所有者或公开笔记的附件
+	public, ok := authorizeAttachmentAccess(c, attachment)
+	if !ok {
+		return
+	}
+	
+	key := attachment.StorageKey()
+	contentType := attachment.Filetype
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	// ETag使用文件内容的哈希，未使用去重存储的早期附件没有哈希，稍后使用大小和修改时间生成弱ETag
+	etag := ""
+	if attachment.Hash != "" {
+		etag = fmt.Sprintf(`"%s"`, attachment.Hash)
+	}
+	
+	// 保留的原图可能包含GPS等隐私信息，只允许附件所有者访问
+	if c.Query("original") != "" {
+		userID, loggedIn := middleware.UserIDFromRequest(c)
+		if !loggedIn || !canAccessAttachment(attachment, userID) {
+			utils.ForbiddenResponse(c, "无权访问原图")
+			return
+		}
+		
+		original, err := attachment.GetOriginal()
+		if err != nil {
+			utils.NotFoundResponse(c, "未保留原图")
+			return
+		}
+		key = original.StorageKey
+		contentType = original.ContentType
+		etag = fmt.Sprintf(`"%s"`, original.Hash)
+	} else if size := c.Query("size"); size != "" {
+		// 请求缩略图时返回对应尺寸的图片，无法生成缩略图时返回原文件
+		if _, ok := models.ThumbnailSize(size); !ok {
+			utils.BadRequestResponse(c, "无效的缩略图尺寸")
+			return
+		}
+		if utils.IsThumbnailable(attachment.Filetype) {
+			// 早期上传的附件没有内容哈希，第一次请求缩略图时计算
+			err := models.EnsureAttachmentHash(attachment)
+			var thumbnail *models.Thumbnail
+			if err == nil {
+				thumbnail, err = models.EnsureThumbnail(attachment.Hash, key, size)
+			}
+			if err == nil {
+				key = thumbnail.StorageKey
+				contentType = thumbnail.ContentType
+				// 缩略图重新生成后内容可能不同，ETag包含记录ID
+				etag = fmt.Sprintf(`"%s-%s-%d"`, attachment.Hash, size, thumbnail.ID)
+			} else {
+				log.Printf("生成附件 %d 的缩略图失败: %v", attachment.ID, err)
+			}
+		}
+	}
 	
 	// 检查文件是否存在
-	if _, err := os.Stat(attachment.Filepath); os.IsNotExist(err) {
-		// 日志记录
-		fmt.Printf("文件路径不存在: %s\n", attachment.Filepath)
-		utils.NotFoundResponse(c, "文件不存在")
+	info, err := storage.Current().Stat(c.Request.Context(), key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotExist) {
+			utils.NotFoundResponse(c, "文件不存在")
+		} else {
+			utils.ServerErrorResponse(c, "读取文件失败")
+		}
 		return
 	}
+	if etag == "" {
+		etag = fmt.Sprintf(`W/"%x-%x"`, info.Size, info.ModTime.Unix())
+	}
 	
 	// 根据文件类型决定是内联显示还是作为附件下载
+	// 只有常见的位图格式内联显示，SVG、HTML等可以执行脚本的类型强制下载并禁止执行
 	contentDisposition := "attachment"
-	if strings.HasPrefix(attachment.Filetype, "image/") {
-		// 图片文件内联显示
+	if utils.IsInlineSafe(contentType) {
 		contentDisposition = "inline"
-		// 确保图片文件类型正确
-		c.Header("Content-Type", attachment.Filetype)
+	} else {
+		c.Header("Content-Security-Policy", "sandbox; default-src 'none'")
 	}
 	
 	// 文件名编码，处理非ASCII字符
 	encodedFilename := url.QueryEscape(attachment.Filename)
 	
 	// 提供文件下载或显示
-	c.Header("Content-Description", "File Transfer")
+	c.Header("Content-Type", contentType)
 	c.Header("Content-Disposition", fmt.Sprintf(`%s; filename="%s"; filename*=UTF-8''%s`, 
 		contentDisposition, attachment.Filename, encodedFilename))
 	
 	// 设置更多响应头来解决跨域问题
 	c.Header("Access-Control-Allow-Origin", "*")
-	c.Header("Access-Control-Allow-Methods", "GET, OPTIONS")
-	c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
-	
-	// 设置缓存头
-	c.Header("Content-Transfer-Encoding", "binary")
-	c.Header("Expires", "0")
-	if strings.HasPrefix(attachment.Filetype, "image/") {
-		c.Header("Cache-Control", "max-age=31536000, public") // 图片缓存1年
+	c.Header("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+	c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, Range, If-None-Match, If-Modified-Since, If-Range")
+	c.Header("Access-Control-Expose-Headers", "Accept-Ranges, Content-Range, Content-Length, Content-Disposition, ETag, Last-Modified")
+	
+	// 设置缓存头：文件内容不会改变，浏览器可以缓存并使用ETag重新验证
+	if public {
+		c.Header("Cache-Control", "max-age=31536000, public") // 公开笔记的附件缓存1年
 	} else {
-		c.Header("Cache-Control", "private, no-transform, no-store, must-revalidate")
+		c.Header("Cache-Control", "max-age=3600, private") // 私有附件只允许浏览器缓存
 	}
-	c.Header("Accept-Ranges", "bytes")
 	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("ETag", etag)
+	
+	// 由http.ServeContent处理HEAD、Range（包括多段Range）、If-Range以及If-None-Match/If-Modified-Since，
+	// 存储后端的内容按需通过Range读取，不会把整个文件读入内存
+	content := storage.NewReadSeeker(c.Request.Context(), storage.Current(), key, info.Size)
+	defer content.Close()
+	http.ServeContent(c.Writer, c.Request, "", info.ModTime, content)
+}
+
+// authorizeAttachmentAccess 检查当前请求是否可以访问附件
+// 允许有效的签名URL、附件所有者（Authorization头）以及公开笔记的附件，
+// 无权访问时写入错误响应并返回false；public表示附件属于公开笔记
+func authorizeAttachmentAccess(c *gin.Context, attachment *models.Attachment) (public bool, ok bool) {
+	// 签名URL
+	if signature := c.Query("signature"); signature != "" {
+		if !utils.VerifyAttachmentSignature(attachment.ID, c.Query("expires"), signature) {
+			utils.ForbiddenResponse(c, "链接无效或已过期")
+			return false, false
+		}
+		return false, true
+	}
+	
+	// 附件所有者
+	if userID, loggedIn := middleware.UserIDFromRequest(c); loggedIn && canAccessAttachment(attachment, userID) {
+		return false, true
+	}
+	
+	// 公开笔记的附件
+	if attachment.NoteID != nil {
+		if note, err := models.GetNoteByID(*attachment.NoteID); err == nil && note.IsPublic {
+			return true, true
+		}
+	}
+	
+	if _, loggedIn := middleware.UserIDFromRequest(c); loggedIn {
+		utils.ForbiddenResponse(c, "无权访问此附件")
+	} else {
+		utils.UnauthorizedResponse(c)
+	}
+	return false, false
+}
+
+// canAccessAttachment 检查用户是否为附件所有者
+// 关联到笔记的附件以笔记所有者为准，临时附件以上传者为准
+func canAccessAttachment(attachment *models.Attachment, userID uint) bool {
+	if attachment.NoteID == nil {
+		return attachment.UserID == userID
+	}
+	
+	note, err := models.GetNoteByID(*attachment.NoteID)
+	return err == nil && note.UserID == userID
+}
+
+// GetAttachmentURL 生成附件的签名访问URL
+func GetAttachmentURL(c *gin.Context) {
+	// 获取附件ID
+	attachmentID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.BadRequestResponse(c, "无效的附件ID")
+		return
+	}
+	
+	// 获取附件
+	attachment, err := models.GetAttachmentByID(uint(attachmentID))
+	if err != nil {
+		utils.NotFoundResponse(c, "附件未找到")
+		return
+	}
+	
+	// 检查附件所有权
+	userID, _ := c.Get("userID")
+	if !canAccessAttachment(attachment, userID.(uint)) {
+		utils.ForbiddenResponse(c, "无权访问此附件")
+		return
+	}
+	
+	signedURL, expiresAt := utils.SignAttachmentURL(attachment.ID)
+	utils.OkResponse(c, gin.H{
+		"id":         attachment.ID,
+		"url":        signedURL,
+		"expires_at": expiresAt,
+	}, "生成附件链接成功")
+}
+
+// 批量签名请求
+type SignAttachmentURLsRequest struct {
+	IDs []uint `json:"ids" binding:"required"`
+}
+
+// SignAttachmentURLs 批量生成附件的签名访问URL，跳过不存在或无权访问的附件
+func SignAttachmentURLs(c *gin.Context) {
+	var req SignAttachmentURLsRequest
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.IDs) > 200 {
+		utils.BadRequestResponse(c, "无效的请求参数")
+		return
+	}
+	
+	// 获取当前用户ID
+	userID, _ := c.Get("userID")
+	
+	urls := make(map[string]string, len(req.IDs))
+	var expiresAt time.Time
+	for _, id := range req.IDs {
+		attachment, err := models.GetAttachmentByID(id)
+		if err != nil || !canAccessAttachment(attachment, userID.(uint)) {
+			continue
+		}
+		urls[strconv.FormatUint(uint64(id), 10)], expiresAt = utils.SignAttachmentURL(id)
+	}
+	
+	utils.OkResponse(c, gin.H{
+		"urls":       urls,
+		"expires_at": expiresAt,
+	}, "生成附件链接成功")
+}
+
+// 修改附件请求，未提供的字段保持不变
+type UpdateAttachmentRequest struct {
+	Filename *string `json:"filename"`
+	AltText  *string `json:"alt_text"`
+	Caption  *string `json:"caption"`
+	NoteID   *uint   `json:"note_id"` // 移动到指定笔记
+}
+
+// UpdateAttachment 修改附件的文件名、替代文本、说明文字，或将附件移动到其他笔记
+func UpdateAttachment(c *gin.Context) {
+	// 获取附件ID
+	attachmentID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.BadRequestResponse(c, "无效的附件ID")
+		return
+	}
+	
+	var req UpdateAttachmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, "无效的请求参数")
+		return
+	}
+	
+	// 获取附件
+	attachment, err := models.GetAttachmentByID(uint(attachmentID))
+	if err != nil {
+		utils.NotFoundResponse(c, "附件未找到")
+		return
+	}
 	
-	// 打印调试信息
-	fmt.Printf("提供文件: %s (类型: %s, 路径: %s)\n", 
-		attachment.Filename, attachment.Filetype, attachment.Filepath)
+	// 检查附件所有权
+	userID, _ := c.Get("userID")
+	if !canAccessAttachment(attachment, userID.(uint)) {
+		utils.ForbiddenResponse(c, "无权修改此附件")
+		return
+	}
+	
+	if req.Filename != nil {
+		filename, ok := renameAttachmentFile(attachment.Filename, *req.Filename)
+		if !ok {
+			utils.BadRequestResponse(c, "无效的文件名")
+			return
+		}
+		attachment.Filename = filename
+	}
+	if req.AltText != nil {
+		if utf8.RuneCountInString(*req.AltText) > 500 {
+			utils.BadRequestResponse(c, "替代文本不能超过500个字符")
+			return
+		}
+		attachment.AltText = strings.TrimSpace(*req.AltText)
+	}
+	if req.Caption != nil {
+		if utf8.RuneCountInString(*req.Caption) > 1000 {
+			utils.BadRequestResponse(c, "说明文字不能超过1000个字符")
+			return
+		}
+		attachment.Caption = strings.TrimSpace(*req.Caption)
+	}
 	
-	// 使用Gin的文件发送功能
-	c.File(attachment.Filepath)
+	// 移动到其他笔记，目标笔记也必须属于当前用户
+	if req.NoteID != nil {
+		note, err := models.GetNoteByID(*req.NoteID)
+		if err != nil {
+			utils.NotFoundResponse(c, "目标笔记未找到")
+			return
+		}
+		if note.UserID != userID.(uint) {
+			utils.ForbiddenResponse(c, "无权将附件移动到此笔记")
+			return
+		}
+		noteID := note.ID
+		attachment.NoteID = &noteID
+		attachment.IsTemp = false
+	}
+	
+	if err := models.UpdateAttachment(attachment); err != nil {
+		utils.ServerErrorResponse(c, "修改附件失败")
+		return
+	}
+	
+	utils.OkResponse(c, attachment, "附件已修改")
+}
+
+// renameAttachmentFile 校验新文件名，扩展名与原文件名不同时保留原扩展名，
+// 避免文件以与内容不符的类型下载
+func renameAttachmentFile(current, filename string) (string, bool) {
+	filename = strings.TrimSpace(filename)
+	if filename == "" || utf8.RuneCountInString(filename) > 200 || strings.Trim(filename, ".") == "" {
+		return "", false
+	}
+	for _, r := range filename {
+		if r == '/' || r == '\\' || unicode.IsControl(r) {
+			return "", false
+		}
+	}
+	
+	if ext := filepath.Ext(current); ext != "" && !strings.EqualFold(filepath.Ext(filename), ext) {
+		filename += ext
+	}
+	return filename, true
 }
 
 // DeleteAttachment 删除附件
@@ -227,15 +619,9 @@ func DeleteAttachment(c *gin.Context) {
 		}
 	}
 	
-	// 删除文件
-	if err := os.Remove(attachment.Filepath); err != nil && !os.IsNotExist(err) {
-		utils.ServerErrorResponse(c, "删除文件失败")
-		return
-	}
-	
-	// 删除附件记录
+	// 删除附件记录和文件
 	if err := models.DeleteAttachment(uint(attachmentID)); err != nil {
-		utils.ServerErrorResponse(c, "删除附件记录失败")
+		utils.ServerErrorResponse(c, "删除附件失败")
 		return
 	}
 	
@@ -276,92 +662,170 @@ func GetNoteAttachments(c *gin.Context) {
 	utils.OkResponse(c, attachments, "获取笔记附件成功")
 }
 
-// GetAttachmentsByDate 获取按日期分组的附件列表
-func GetAttachmentsByDate(c *gin.Context) {
+// GetNoteAttachmentReferences 获取笔记内容引用的附件、未被引用的附件以及失效的引用
+func GetNoteAttachmentReferences(c *gin.Context) {
+	// 获取笔记ID
+	noteID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.BadRequestResponse(c, "无效的笔记ID")
+		return
+	}
+	
 	// 获取当前用户ID
 	userID, _ := c.Get("userID")
 	
-	// 获取分页参数
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "20"))
+	// 检查笔记是否属于当前用户
+	note, err := models.GetNoteByID(uint(noteID))
+	if err != nil {
+		utils.NotFoundResponse(c, "笔记未找到")
+		return
+	}
 	
-	// 获取可选的文件类型过滤参数
-	fileType := c.Query("filetype")
+	if note.UserID != userID.(uint) {
+		utils.ForbiddenResponse(c, "无权访问此笔记的附件")
+		return
+	}
 	
-	// 从数据库获取按日期分组的附件
-	attachments, dateGroups, total, err := models.GetAttachmentsByDate(userID.(uint), page, pageSize, fileType)
+	report, err := models.GetAttachmentReferenceReport(note)
 	if err != nil {
-		utils.ServerErrorResponse(c, "获取资源库文件失败")
+		utils.ServerErrorResponse(c, "获取附件引用失败")
 		return
 	}
 	
-	// 返回数据
-	utils.OkResponse(c, gin.H{
-		"attachments": attachments,
-		"dateGroups": dateGroups,
-		"total": total,
-		"page": page,
-		"pageSize": pageSize,
-	}, "获取资源库文件成功")
+	utils.OkResponse(c, report, "获取附件引用成功")
 }
 
-// UploadTempAttachment 上传临时附件
-func UploadTempAttachment(c *gin.Context) {
+// GetAttachmentsByDate 获取资源库附件列表，包括临时附件
+// 支持按上传日期、文件大小、笔记、标签、文件名和文件类型筛选，按上传时间、文件名或大小排序
+// 第一页按页码返回并附带按日期（tz指定的时区）的分组统计，后续页面使用返回的 next_cursor 获取
+func GetAttachmentsByDate(c *gin.Context) {
 	// 获取当前用户ID
 	userID, _ := c.Get("userID")
 	
-	// 获取上传的文件
-	file, err := c.FormFile("file")
-	if err != nil {
-		utils.BadRequestResponse(c, "获取上传文件失败")
-		return
+	// 获取分页参数
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
 	}
 	
-	// 打开上传的文件
-	src, err := file.Open()
-	if err != nil {
-		utils.ServerErrorResponse(c, "打开上传文件失败")
+	query := models.LibraryQuery{
+		FileType: c.Query("filetype"),
+		Filename: strings.TrimSpace(c.Query("q")),
+		Sort:     c.DefaultQuery("sort", "created_at"),
+		Asc:      c.Query("order") == "asc",
+		Cursor:   c.Query("cursor"),
+		Page:     page,
+		PageSize: pageSize,
+		Location: time.Local,
+	}
+	if query.Sort != "created_at" && query.Sort != "filename" && query.Sort != "filesize" {
+		utils.BadRequestResponse(c, "排序字段只能是 created_at、filename 或 filesize")
 		return
 	}
-	defer src.Close()
 	
-	// 创建临时文件
-	tempFilePath := filepath.Join(os.TempDir(), fmt.Sprintf("upload_%d", time.Now().UnixNano()))
-	tempFile, err := os.Create(tempFilePath)
+	// 日期范围和日期分组使用客户端时区
+	if tz := c.Query("tz"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			utils.BadRequestResponse(c, "无效的时区")
+			return
+		}
+		query.Location = loc
+	}
+	if value := c.Query("start_date"); value != "" {
+		start, err := time.ParseInLocation("2006-01-02", value, query.Location)
+		if err != nil {
+			utils.BadRequestResponse(c, "无效的开始日期，格式应为YYYY-MM-DD")
+			return
+		}
+		query.Start = start
+	}
+	if value := c.Query("end_date"); value != "" {
+		end, err := time.ParseInLocation("2006-01-02", value, query.Location)
+		if err != nil {
+			utils.BadRequestResponse(c, "无效的结束日期，格式应为YYYY-MM-DD")
+			return
+		}
+		// 包含结束日期当天
+		query.End = end.AddDate(0, 0, 1)
+	}
+	
+	var err error
+	if query.MinSize, err = parseOptionalInt64(c, "min_size"); err != nil {
+		utils.BadRequestResponse(c, "无效的最小文件大小")
+		return
+	}
+	if query.MaxSize, err = parseOptionalInt64(c, "max_size"); err != nil {
+		utils.BadRequestResponse(c, "无效的最大文件大小")
+		return
+	}
+	noteID, err := parseOptionalInt64(c, "note_id")
 	if err != nil {
-		utils.ServerErrorResponse(c, "创建临时文件失败")
+		utils.BadRequestResponse(c, "无效的笔记ID")
 		return
 	}
-	defer func() {
-		tempFile.Close()
-		os.Remove(tempFilePath) // 清理临时文件
-	}()
-	
-	// 将上传文件内容复制到临时文件
-	if _, err = io.Copy(tempFile, src); err != nil {
-		utils.ServerErrorResponse(c, "保存上传文件失败")
+	tagID, err := parseOptionalInt64(c, "tag_id")
+	if err != nil {
+		utils.BadRequestResponse(c, "无效的标签ID")
 		return
 	}
+	query.NoteID, query.TagID = uint(noteID), uint(tagID)
+	if value := c.Query("temp"); value != "" {
+		temp, err := strconv.ParseBool(value)
+		if err != nil {
+			utils.BadRequestResponse(c, "temp参数只能是true或false")
+			return
+		}
+		query.Temp = &temp
+	}
 	
-	// 重置文件指针到文件开始
-	if _, err = tempFile.Seek(0, 0); err != nil {
-		utils.ServerErrorResponse(c, "重置文件指针失败")
+	// 从数据库获取资源库附件
+	result, err := models.QueryLibrary(userID.(uint), query)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCursor) {
+			utils.BadRequestResponse(c, err.Error())
+			return
+		}
+		utils.ServerErrorResponse(c, "获取资源库文件失败")
 		return
 	}
 	
-	// 使用SaveFile函数保存临时附件
-	// noteID为0（无关联笔记），isTemp为true（标记为临时附件）
-	attachment, err := models.SaveFile(
-		tempFile,
-		file.Filename,
-		0,                      // noteID为0表示无关联笔记
-		file.Header.Get("Content-Type"),
-		userID.(uint),          // 用户ID
-		true,                   // 是临时附件
-	)
+	// 返回数据
+	utils.OkResponse(c, gin.H{
+		"attachments": result.Attachments,
+		"dateGroups": result.DateGroups,
+		"total": result.Total,
+		"page": page,
+		"pageSize": pageSize,
+		"next_cursor": result.NextCursor,
+	}, "获取资源库文件成功")
+}
+
+// parseOptionalInt64 解析可选的非负整数查询参数，未提供时返回0
+func parseOptionalInt64(c *gin.Context, key string) (int64, error) {
+	value := c.Query(key)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err == nil && n < 0 {
+		err = fmt.Errorf("%s不能为负数", key)
+	}
+	return n, err
+}
+
+// UploadTempAttachment 上传临时附件
+func UploadTempAttachment(c *gin.Context) {
+	// 获取当前用户ID
+	userID, _ := c.Get("userID")
 	
-	if err != nil {
-		utils.ServerErrorResponse(c, "创建临时附件记录失败: " + err.Error())
+	// 保存上传的文件，noteID为0表示无关联笔记
+	attachment, ok := saveUploadedFile(c, 0, userID.(uint), true)
+	if !ok {
 		return
 	}
 	
@@ -375,6 +839,8 @@ func UploadTempAttachment(c *gin.Context) {
 		"filename": attachment.Filename,
 		"filetype": attachment.Filetype,
 		"filesize": attachment.Filesize,
+		"hash": attachment.Hash,
+		"deduplicated": attachment.Deduplicated,
 		"success": true, // 添加success字段以便前端识别
 	}, "临时附件上传成功")
 }
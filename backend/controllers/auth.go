@@ -29,6 +29,14 @@ type UpdateUserRequest struct {
 	NewPassword     string `json:"newPassword"`
 }
 
+// 用户设置更新请求，未提供的字段保持不变
+type UpdateSettingsRequest struct {
+	AutoSummary              *bool `json:"auto_summary"`
+	AutoTagSuggestions       *bool `json:"auto_tag_suggestions"`
+	KeepOriginalImages       *bool `json:"keep_original_images"`
+	AutoAssociateAttachments *bool `json:"auto_associate_attachments"`
+}
+
 // Register 用户注册
 func Register(c *gin.Context) {
 	var req RegisterRequest
@@ -213,4 +221,71 @@ func UpdateUser(c *gin.Context) {
 		"user": user,
 		"passwordChanged": passwordChanged,
 	}, message)
-} 
\ No newline at end of file
+}
+
+// GetUserSettings 获取当前用户的设置
+func GetUserSettings(c *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, _ := c.Get("userID")
+	
+	settings, err := models.GetUserSettings(userID.(uint))
+	if err != nil {
+		utils.ServerErrorResponse(c, "获取用户设置失败")
+		return
+	}
+	
+	utils.OkResponse(c, settings, "获取用户设置成功")
+}
+
+// UpdateUserSettings 更新当前用户的设置
+func UpdateUserSettings(c *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, _ := c.Get("userID")
+	
+	// 解析请求
+	var req UpdateSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, "无效的请求参数")
+		return
+	}
+	
+	settings, err := models.GetUserSettings(userID.(uint))
+	if err != nil {
+		utils.ServerErrorResponse(c, "获取用户设置失败")
+		return
+	}
+	
+	if req.AutoSummary != nil {
+		settings.AutoSummary = *req.AutoSummary
+	}
+	if req.AutoTagSuggestions != nil {
+		settings.AutoTagSuggestions = *req.AutoTagSuggestions
+	}
+	if req.KeepOriginalImages != nil {
+		settings.KeepOriginalImages = *req.KeepOriginalImages
+	}
+	if req.AutoAssociateAttachments != nil {
+		settings.AutoAssociateAttachments = *req.AutoAssociateAttachments
+	}
+	
+	if err := models.SaveUserSettings(settings); err != nil {
+		utils.ServerErrorResponse(c, "保存用户设置失败")
+		return
+	}
+	
+	utils.OkResponse(c, settings, "用户设置已更新")
+}
+
+// GetUserStorage 获取当前用户的存储空间使用情况
+func GetUserStorage(c *gin.Context) {
+	// 从上下文中获取用户ID
+	userID, _ := c.Get("userID")
+	
+	usage, err := models.GetStorageUsage(userID.(uint))
+	if err != nil {
+		utils.ServerErrorResponse(c, "获取存储空间使用情况失败")
+		return
+	}
+	
+	utils.OkResponse(c, usage, "获取存储空间使用情况成功")
+}
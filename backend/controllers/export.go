@@ -0,0 +1,266 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"cyi-note/backend/jobs"
+	"cyi-note/backend/middleware"
+	"cyi-note/backend/models"
+	"cyi-note/backend/storage"
+	"cyi-note/backend/utils"
+)
+
+// noteExportImageMaxSize 导出单篇笔记时内联的图片的最大大小，更大的图片保留原地址
+const noteExportImageMaxSize = 20 << 20
+
+// exportJobResponse 导出任务，完成且文件未过期时附带签名的下载链接
+type exportJobResponse struct {
+	*models.Job
+	DownloadURL string     `json:"download_url,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"` // 导出文件的过期时间
+}
+
+// ExportMarkdown 创建将当前用户的所有笔记导出为Markdown ZIP的后台任务
+// 任务完成后可以通过 /api/export/jobs/:id 获取下载链接
+func ExportMarkdown(c *gin.Context) {
+	// 获取当前用户ID
+	userID, _ := c.Get("userID")
+
+	job, err := jobs.Enqueue(userID.(uint), jobs.TypeExportMarkdown, nil, struct{}{})
+	if err != nil {
+		utils.ServerErrorResponse(c, "创建导出任务失败")
+		return
+	}
+
+	utils.AcceptedResponse(c, newExportJobResponse(job), "导出任务已加入队列")
+}
+
+// GetExportJobs 获取当前用户最近的导出任务
+func GetExportJobs(c *gin.Context) {
+	// 获取当前用户ID
+	userID, _ := c.Get("userID")
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	jobList, err := models.GetJobsByUserID(userID.(uint), []string{jobs.TypeExportMarkdown}, limit)
+	if err != nil {
+		utils.ServerErrorResponse(c, "获取导出任务列表失败")
+		return
+	}
+
+	responses := make([]exportJobResponse, 0, len(jobList))
+	for i := range jobList {
+		responses = append(responses, newExportJobResponse(&jobList[i]))
+	}
+	utils.OkResponse(c, responses, "获取导出任务列表成功")
+}
+
+// GetExportJob 获取导出任务的进度，完成后返回签名的下载链接
+func GetExportJob(c *gin.Context) {
+	job, ok := getExportJob(c)
+	if !ok {
+		return
+	}
+
+	// 检查任务所有权
+	userID, _ := c.Get("userID")
+	if job.UserID != userID.(uint) {
+		utils.ForbiddenResponse(c, "无权访问此任务")
+		return
+	}
+
+	utils.OkResponse(c, newExportJobResponse(job), "获取导出任务成功")
+}
+
+// DownloadExport 下载导出的ZIP
+// 支持签名的下载链接，以及任务所有者（Authorization头）
+func DownloadExport(c *gin.Context) {
+	job, ok := getExportJob(c)
+	if !ok {
+		return
+	}
+
+	if signature := c.Query("signature"); signature != "" {
+		if !utils.VerifyExportSignature(job.ID, c.Query("expires"), signature) {
+			utils.ForbiddenResponse(c, "链接无效或已过期")
+			return
+		}
+	} else if userID, loggedIn := middleware.UserIDFromRequest(c); !loggedIn {
+		utils.UnauthorizedResponse(c)
+		return
+	} else if job.UserID != userID {
+		utils.ForbiddenResponse(c, "无权访问此任务")
+		return
+	}
+
+	if job.Status != models.JobStatusDone {
+		utils.NotFoundResponse(c, "导出尚未完成")
+		return
+	}
+	if exportExpired(job) {
+		utils.ErrorResponse(c, http.StatusGone, "导出文件已过期，请重新导出")
+		return
+	}
+
+	var result jobs.ExportResult
+	if err := json.Unmarshal([]byte(job.Result), &result); err != nil {
+		utils.ServerErrorResponse(c, "读取导出结果失败")
+		return
+	}
+	path := jobs.ExportPath(job.ID)
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		utils.ErrorResponse(c, http.StatusGone, "导出文件已过期，请重新导出")
+		return
+	}
+
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.FileAttachment(path, result.Filename)
+}
+
+// getExportJob 按路径参数获取导出任务，其他类型的任务视为不存在
+func getExportJob(c *gin.Context) (*models.Job, bool) {
+	jobID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.BadRequestResponse(c, "无效的任务ID")
+		return nil, false
+	}
+
+	job, err := models.GetJobByID(uint(jobID))
+	if err != nil || job.Type != jobs.TypeExportMarkdown {
+		utils.NotFoundResponse(c, "任务未找到")
+		return nil, false
+	}
+	return job, true
+}
+
+// newExportJobResponse 为完成且未过期的导出任务生成签名的下载链接
+func newExportJobResponse(job *models.Job) exportJobResponse {
+	response := exportJobResponse{Job: job}
+	if job.Status != models.JobStatusDone || exportExpired(job) {
+		return response
+	}
+
+	response.DownloadURL, _ = utils.SignExportURL(job.ID)
+	if expiresAt := jobs.ExportExpiresAt(job); !expiresAt.IsZero() {
+		response.ExpiresAt = &expiresAt
+	}
+	return response
+}
+
+// exportExpired 检查导出文件是否已过期
+func exportExpired(job *models.Job) bool {
+	expiresAt := jobs.ExportExpiresAt(job)
+	return !expiresAt.IsZero() && time.Now().After(expiresAt)
+}
+
+// ExportNote 将单篇笔记导出为独立的HTML文档或PDF
+// format 为 html（默认）或 pdf；笔记引用的图片附件以data URI内联，代码块语法高亮
+func ExportNote(c *gin.Context) {
+	// 获取笔记ID
+	noteID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.BadRequestResponse(c, "无效的笔记ID")
+		return
+	}
+
+	format := c.DefaultQuery("format", "html")
+	if format != "html" && format != "pdf" {
+		utils.BadRequestResponse(c, "不支持的导出格式，可选 html 或 pdf")
+		return
+	}
+
+	// 获取笔记
+	note, err := models.GetNoteByID(uint(noteID))
+	if err != nil {
+		utils.NotFoundResponse(c, "笔记未找到")
+		return
+	}
+
+	// 检查笔记所有权
+	userID, _ := c.Get("userID")
+	if note.UserID != userID.(uint) {
+		utils.ForbiddenResponse(c, "无权访问此笔记")
+		return
+	}
+
+	body, err := utils.RenderMarkdown(note.Content, noteImageAltText(note))
+	if err == nil {
+		body, err = utils.InlineImages(body, func(src string) ([]byte, string, bool) {
+			return loadNoteImage(c, userID.(uint), src)
+		})
+	}
+	if err != nil {
+		utils.ServerErrorResponse(c, "渲染笔记失败")
+		return
+	}
+
+	doc := &utils.NoteDocument{
+		Title:     note.Title,
+		CreatedAt: note.CreatedAt,
+		UpdatedAt: note.UpdatedAt,
+		Body:      body,
+	}
+	for _, tag := range note.Tags {
+		doc.Tags = append(doc.Tags, tag.Name)
+	}
+
+	var data []byte
+	contentType := "text/html; charset=utf-8"
+	if format == "pdf" {
+		data, err = utils.NotePDF(doc)
+		contentType = "application/pdf"
+	} else {
+		data, err = utils.NoteHTML(doc)
+		// 导出的文档只包含内联的样式和图片，禁止脚本和其他外部资源
+		c.Header("Content-Security-Policy", "default-src 'none'; img-src data: http: https:; style-src 'unsafe-inline'")
+	}
+	if err != nil {
+		utils.ServerErrorResponse(c, "导出笔记失败")
+		return
+	}
+
+	filename := utils.SafeArchiveName(note.Title) + "." + format
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"; filename*=UTF-8''%s`,
+		filename, url.QueryEscape(filename)))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// loadNoteImage 读取笔记中引用的图片附件，用于内联到导出的文档
+// 只读取当前用户有权访问的图片，其他地址保留原样
+func loadNoteImage(c *gin.Context, userID uint, src string) ([]byte, string, bool) {
+	ids := utils.ParseAttachmentReferences(src)
+	if len(ids) != 1 {
+		return nil, "", false
+	}
+	attachment, err := models.GetAttachmentByID(ids[0])
+	if err != nil || !canAccessAttachment(attachment, userID) ||
+		!strings.HasPrefix(attachment.Filetype, "image/") || attachment.Filesize > noteExportImageMaxSize {
+		return nil, "", false
+	}
+
+	reader, err := storage.Current().Get(c.Request.Context(), attachment.StorageKey())
+	if err != nil {
+		return nil, "", false
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(io.LimitReader(reader, noteExportImageMaxSize+1))
+	if err != nil || len(data) > noteExportImageMaxSize {
+		return nil, "", false
+	}
+	return data, attachment.Filetype, true
+}
@@ -0,0 +1,267 @@
+package controllers
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"cyi-note/backend/config"
+	"cyi-note/backend/jobs"
+	"cyi-note/backend/models"
+	"cyi-note/backend/utils"
+)
+
+// importMaxSize 导入的ZIP解压后的最大总大小（字节）
+var importMaxSize int64
+
+// InitImportController 初始化导入控制器，需在InitUploadController之后调用
+// ENEX和Notion的导入文件先保存在断点续传目录的imports子目录中，由后台任务处理后删除
+func InitImportController(cfg *config.Config) {
+	importMaxSize = cfg.ImportMaxSize * 1024 * 1024
+
+	if err := os.MkdirAll(filepath.Join(uploadPartialDir, "imports"), 0755); err != nil {
+		panic(fmt.Sprintf("无法创建导入文件目录: %v", err))
+	}
+}
+
+// ImportMarkdown 从Markdown文件夹或Obsidian库的ZIP导入笔记
+// dry_run=true 时只返回将要创建的笔记、标签和附件，不做任何修改
+func ImportMarkdown(c *gin.Context) {
+	zr, closer, ok := openImportArchive(c)
+	if !ok {
+		return
+	}
+	defer closer.Close()
+
+	notes, issues, err := utils.ParseMarkdownArchive(zr)
+	if err != nil {
+		if errors.Is(err, utils.ErrNothingToImport) {
+			utils.BadRequestResponse(c, "ZIP中没有找到Markdown文件")
+			return
+		}
+		utils.ServerErrorResponse(c, "解析导入文件失败")
+		return
+	}
+
+	importNotes(c, notes, issues)
+}
+
+// ImportEnex 创建导入印象笔记/Evernote导出的ENEX文件的后台任务
+// 任务进度和导入报告可以通过 /api/import/jobs/:id 查询
+func ImportEnex(c *gin.Context) {
+	path, filename, ok := stageImportFile(c, ".enex")
+	if !ok {
+		return
+	}
+	enqueueImport(c, jobs.TypeImportEnex, path, filename)
+}
+
+// ImportNotion 创建导入Notion导出的ZIP（Markdown & CSV格式）的后台任务
+// 任务进度和导入报告可以通过 /api/import/jobs/:id 查询
+func ImportNotion(c *gin.Context) {
+	path, filename, ok := stageImportFile(c, ".zip")
+	if !ok {
+		return
+	}
+
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		os.Remove(path)
+		utils.BadRequestResponse(c, "无效的ZIP文件")
+		return
+	}
+	valid := checkImportArchiveSize(c, &zr.Reader)
+	zr.Close()
+	if !valid {
+		os.Remove(path)
+		return
+	}
+	enqueueImport(c, jobs.TypeImportNotion, path, filename)
+}
+
+// GetImportJobs 获取当前用户最近的导入任务
+func GetImportJobs(c *gin.Context) {
+	// 获取当前用户ID
+	userID, _ := c.Get("userID")
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	jobList, err := models.GetJobsByUserID(userID.(uint), importJobTypes, limit)
+	if err != nil {
+		utils.ServerErrorResponse(c, "获取导入任务列表失败")
+		return
+	}
+
+	utils.OkResponse(c, jobList, "获取导入任务列表成功")
+}
+
+// GetImportJob 获取导入任务的进度和导入报告
+// 任务完成后 result 为导入报告，其中的 issues 记录跳过的文件和无法转换的内容
+func GetImportJob(c *gin.Context) {
+	// 获取任务ID
+	jobID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.BadRequestResponse(c, "无效的任务ID")
+		return
+	}
+
+	// 获取任务，其他类型的任务视为不存在
+	job, err := models.GetJobByID(uint(jobID))
+	if err != nil || !isImportJob(job.Type) {
+		utils.NotFoundResponse(c, "任务未找到")
+		return
+	}
+
+	// 检查任务所有权
+	userID, _ := c.Get("userID")
+	if job.UserID != userID.(uint) {
+		utils.ForbiddenResponse(c, "无权访问此任务")
+		return
+	}
+
+	utils.OkResponse(c, job, "获取导入任务成功")
+}
+
+// importJobTypes 导入任务的类型
+var importJobTypes = []string{jobs.TypeImportEnex, jobs.TypeImportNotion}
+
+// isImportJob 检查任务是否为导入任务
+func isImportJob(jobType string) bool {
+	for _, t := range importJobTypes {
+		if t == jobType {
+			return true
+		}
+	}
+	return false
+}
+
+// stageImportFile 将上传的导入文件保存到临时目录，交给后台任务处理；ext为要求的扩展名
+func stageImportFile(c *gin.Context, ext string) (string, string, bool) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		utils.BadRequestResponse(c, "获取上传文件失败")
+		return "", "", false
+	}
+	if !strings.EqualFold(filepath.Ext(file.Filename), ext) {
+		utils.BadRequestResponse(c, fmt.Sprintf("请上传 %s 文件", ext))
+		return "", "", false
+	}
+	if uploadMaxSize > 0 && file.Size > uploadMaxSize {
+		utils.ErrorResponse(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("导入文件不能超过 %d MB", uploadMaxSize/1024/1024))
+		return "", "", false
+	}
+
+	id, err := newUploadID()
+	if err != nil {
+		utils.ServerErrorResponse(c, "保存上传文件失败")
+		return "", "", false
+	}
+	path := filepath.Join(uploadPartialDir, "imports", id+ext)
+	if err := c.SaveUploadedFile(file, path); err != nil {
+		utils.ServerErrorResponse(c, "保存上传文件失败")
+		return "", "", false
+	}
+	return path, file.Filename, true
+}
+
+// enqueueImport 创建导入任务，创建失败时删除保存的导入文件
+func enqueueImport(c *gin.Context, jobType, path, filename string) {
+	// 获取当前用户ID
+	userID, _ := c.Get("userID")
+	dryRun, _ := strconv.ParseBool(c.DefaultPostForm("dry_run", c.Query("dry_run")))
+
+	job, err := jobs.Enqueue(userID.(uint), jobType, nil, jobs.ImportInput{Path: path, Filename: filename, DryRun: dryRun})
+	if err != nil {
+		os.Remove(path)
+		utils.ServerErrorResponse(c, "创建导入任务失败")
+		return
+	}
+
+	utils.AcceptedResponse(c, job, "导入任务已加入队列")
+}
+
+// openImportArchive 打开上传的ZIP，检查上传大小和解压后的总大小，使用完后需要关闭返回的文件
+func openImportArchive(c *gin.Context) (*zip.Reader, io.Closer, bool) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		utils.BadRequestResponse(c, "获取上传文件失败")
+		return nil, nil, false
+	}
+	if uploadMaxSize > 0 && file.Size > uploadMaxSize {
+		utils.ErrorResponse(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("导入文件不能超过 %d MB", uploadMaxSize/1024/1024))
+		return nil, nil, false
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		utils.ServerErrorResponse(c, "打开上传文件失败")
+		return nil, nil, false
+	}
+
+	zr, err := zip.NewReader(src, file.Size)
+	if err != nil {
+		src.Close()
+		utils.BadRequestResponse(c, "无效的ZIP文件")
+		return nil, nil, false
+	}
+	if !checkImportArchiveSize(c, zr) {
+		src.Close()
+		return nil, nil, false
+	}
+	return zr, src, true
+}
+
+// checkImportArchiveSize 检查ZIP解压后的总大小
+// 条目的实际大小超过声明的大小时读取会失败，因此可以按声明的大小限制解压后的总大小
+func checkImportArchiveSize(c *gin.Context, zr *zip.Reader) bool {
+	var total uint64
+	for _, f := range zr.File {
+		total += f.UncompressedSize64
+	}
+	if importMaxSize > 0 && total > uint64(importMaxSize) {
+		utils.ErrorResponse(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("导入文件解压后不能超过 %d MB", importMaxSize/1024/1024))
+		return false
+	}
+	return true
+}
+
+// importNotes 导入解析出的笔记并返回导入报告，dry_run=true 时只返回报告
+func importNotes(c *gin.Context, notes []utils.ImportedNote, issues []utils.ImportIssue) {
+	// 获取当前用户ID
+	userID, _ := c.Get("userID")
+	dryRun, _ := strconv.ParseBool(c.DefaultPostForm("dry_run", c.Query("dry_run")))
+
+	report, attachments, err := models.ImportNotes(userID.(uint), notes, issues, models.ImportOptions{DryRun: dryRun})
+	if err != nil {
+		if errors.Is(err, models.ErrStorageQuotaExceeded) {
+			utils.ErrorResponse(c, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
+		log.Printf("用户 %d 导入笔记失败: %v", userID.(uint), err)
+		utils.ServerErrorResponse(c, "导入笔记失败")
+		return
+	}
+
+	if dryRun {
+		utils.OkResponse(c, report, "导入预览")
+		return
+	}
+
+	// 为导入的附件生成缩略图、提取文本
+	for i := range attachments {
+		jobs.AttachmentSaved(&attachments[i])
+	}
+	utils.CreatedResponse(c, report, fmt.Sprintf("成功导入 %d 篇笔记", len(report.Notes)))
+}
@@ -1,10 +1,12 @@
 package controllers
 
 import (
+	"log"
 	"strconv"
 	
 	"github.com/gin-gonic/gin"
 	
+	"cyi-note/backend/jobs"
 	"cyi-note/backend/models"
 	"cyi-note/backend/utils"
 )
@@ -61,6 +63,9 @@ func CreateNote(c *gin.Context) {
 		}
 	}
 	
+	// 记录内容中引用的附件
+	syncAttachmentReferences(&note)
+	
 	// 查询带有标签的笔记
 	createdNote, err := models.GetNoteByID(note.ID)
 	if err != nil {
@@ -68,6 +73,13 @@ func CreateNote(c *gin.Context) {
 		return
 	}
 	
+	// 按用户设置自动生成摘要和标签建议
+	jobs.NoteSaved(createdNote, "", true)
+	
+	if wantRenderedHTML(c) {
+		renderNoteHTML(createdNote)
+	}
+	
 	utils.CreatedResponse(c, createdNote, "笔记创建成功")
 }
 
@@ -94,6 +106,10 @@ func GetNote(c *gin.Context) {
 		return
 	}
 	
+	if wantRenderedHTML(c) {
+		renderNoteHTML(note)
+	}
+	
 	utils.OkResponse(c, note, "获取笔记成功")
 }
 
@@ -127,6 +143,12 @@ func GetNotes(c *gin.Context) {
 		return
 	}
 	
+	if wantRenderedHTML(c) {
+		for i := range notes {
+			renderNoteHTML(&notes[i])
+		}
+	}
+	
 	utils.OkResponse(c, gin.H{
 		"notes": notes,
 		"total": total,
@@ -168,6 +190,9 @@ func UpdateNote(c *gin.Context) {
 		return
 	}
 	
+	// 记录修改前的内容，用于判断是否需要重新生成摘要
+	previousContent := note.Content
+	
 	// 更新笔记
 	note.Title = req.Title
 	note.Content = req.Content
@@ -206,6 +231,9 @@ func UpdateNote(c *gin.Context) {
 		}
 	}
 	
+	// 记录内容中引用的附件
+	syncAttachmentReferences(note)
+	
 	// 获取更新后的笔记
 	updatedNote, err := models.GetNoteByID(note.ID)
 	if err != nil {
@@ -213,6 +241,13 @@ func UpdateNote(c *gin.Context) {
 		return
 	}
 	
+	// 内容有实质变化时按用户设置重新生成摘要和标签建议
+	jobs.NoteSaved(updatedNote, previousContent, false)
+	
+	if wantRenderedHTML(c) {
+		renderNoteHTML(updatedNote)
+	}
+	
 	utils.OkResponse(c, updatedNote, "笔记更新成功")
 }
 
@@ -273,6 +308,12 @@ func SearchNotes(c *gin.Context) {
 		return
 	}
 	
+	if wantRenderedHTML(c) {
+		for i := range notes {
+			renderNoteHTML(&notes[i])
+		}
+	}
+	
 	utils.OkResponse(c, gin.H{
 		"notes": notes,
 		"total": total,
@@ -294,10 +335,149 @@ func GetPublicNotes(c *gin.Context) {
 		return
 	}
 	
+	// 公开笔记总是返回清理后的HTML，访问者的页面不需要自行渲染不受信任的内容
+	for i := range notes {
+		renderNoteHTML(&notes[i])
+	}
+	
 	utils.OkResponse(c, gin.H{
 		"notes": notes,
 		"total": total,
 		"page":  page,
 		"size":  pageSize,
 	}, "获取公开笔记成功")
-} 
\ No newline at end of file
+}
+
+// GetNoteRevisions 获取笔记的修订版本
+func GetNoteRevisions(c *gin.Context) {
+	// 获取笔记ID
+	noteID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.BadRequestResponse(c, "无效的笔记ID")
+		return
+	}
+	
+	// 获取笔记
+	note, err := models.GetNoteByID(uint(noteID))
+	if err != nil {
+		utils.NotFoundResponse(c, "笔记未找到")
+		return
+	}
+	
+	// 检查笔记所有权
+	userID, _ := c.Get("userID")
+	if note.UserID != userID.(uint) {
+		utils.ForbiddenResponse(c, "无权访问此笔记")
+		return
+	}
+	
+	revisions, err := models.GetNoteRevisions(note.ID)
+	if err != nil {
+		utils.ServerErrorResponse(c, "获取修订版本失败")
+		return
+	}
+	
+	utils.OkResponse(c, revisions, "获取修订版本成功")
+}
+
+// RestoreNoteRevision 将笔记恢复为指定的修订版本
+func RestoreNoteRevision(c *gin.Context) {
+	// 获取笔记ID和修订版本ID
+	noteID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.BadRequestResponse(c, "无效的笔记ID")
+		return
+	}
+	
+	revisionID, err := strconv.ParseUint(c.Param("revisionId"), 10, 64)
+	if err != nil {
+		utils.BadRequestResponse(c, "无效的修订版本ID")
+		return
+	}
+	
+	// 获取笔记
+	note, err := models.GetNoteByID(uint(noteID))
+	if err != nil {
+		utils.NotFoundResponse(c, "笔记未找到")
+		return
+	}
+	
+	// 检查笔记所有权
+	userID, _ := c.Get("userID")
+	if note.UserID != userID.(uint) {
+		utils.ForbiddenResponse(c, "无权修改此笔记")
+		return
+	}
+	
+	revision, err := models.GetNoteRevisionByID(uint(revisionID))
+	if err != nil || revision.NoteID != note.ID {
+		utils.NotFoundResponse(c, "修订版本未找到")
+		return
+	}
+	
+	// 恢复前保存当前内容，恢复操作本身也可以撤销
+	previousContent := note.Content
+	if err := models.RestoreNoteRevision(note, revision); err != nil {
+		utils.ServerErrorResponse(c, "恢复修订版本失败")
+		return
+	}
+	
+	// 记录内容中引用的附件
+	syncAttachmentReferences(note)
+	
+	// 获取更新后的笔记
+	updatedNote, err := models.GetNoteByID(note.ID)
+	if err != nil {
+		utils.ServerErrorResponse(c, "获取更新后的笔记失败")
+		return
+	}
+	
+	// 内容有实质变化时按用户设置重新生成摘要和标签建议
+	jobs.NoteSaved(updatedNote, previousContent, false)
+	
+	if wantRenderedHTML(c) {
+		renderNoteHTML(updatedNote)
+	}
+	
+	utils.OkResponse(c, updatedNote, "已恢复修订版本")
+}
+
+// syncAttachmentReferences 根据笔记内容更新引用的附件，失败时只记录日志，不影响笔记的保存
+func syncAttachmentReferences(note *models.Note) {
+	if _, err := models.SyncAttachmentReferences(note); err != nil {
+		log.Printf("更新笔记 %d 的附件引用失败: %v", note.ID, err)
+	}
+}
+
+// wantRenderedHTML 检查请求是否需要返回服务端渲染的HTML（rendered_html=true）
+func wantRenderedHTML(c *gin.Context) bool {
+	render, _ := strconv.ParseBool(c.Query("rendered_html"))
+	return render
+}
+
+// renderNoteHTML 将笔记内容渲染为清理后的HTML，失败时只记录日志
+func renderNoteHTML(note *models.Note) {
+	rendered, err := utils.RenderMarkdown(note.Content, noteImageAltText(note))
+	if err != nil {
+		log.Printf("渲染笔记 %d 失败: %v", note.ID, err)
+		return
+	}
+	note.RenderedHTML = rendered
+}
+
+// noteImageAltText 返回笔记中附件图片的替代文本，用于渲染时补全没有写alt的图片
+// 只使用笔记所有者自己的附件，查询失败时只记录日志
+func noteImageAltText(note *models.Note) utils.ImageAltText {
+	ids := utils.ParseAttachmentReferences(note.Content)
+	if len(ids) == 0 {
+		return nil
+	}
+	altTexts, err := models.GetAttachmentAltTexts(note.UserID, ids)
+	if err != nil {
+		log.Printf("获取笔记 %d 的图片替代文本失败: %v", note.ID, err)
+		return nil
+	}
+	return func(id uint) string {
+		return altTexts[id]
+	}
+}
@@ -14,6 +14,12 @@ type TagRequest struct {
 	Name string `json:"name" binding:"required"`
 }
 
+// 标签建议处理请求
+type ReviewTagSuggestionsRequest struct {
+	Accept []uint `json:"accept"` // 采纳的建议ID
+	Reject []uint `json:"reject"` // 拒绝的建议ID
+}
+
 // GetTags 获取所有标签
 func GetTags(c *gin.Context) {
 	// 获取当前用户ID
@@ -168,4 +174,131 @@ func RemoveTagFromNote(c *gin.Context) {
 	}
 	
 	utils.OkResponse(c, nil, "标签已从笔记中移除")
-} 
\ No newline at end of file
+}
+
+// GetNoteTagSuggestions 获取笔记待处理的标签建议
+func GetNoteTagSuggestions(c *gin.Context) {
+	// 获取笔记ID
+	noteID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.BadRequestResponse(c, "无效的笔记ID")
+		return
+	}
+	
+	// 获取当前用户ID
+	userID, _ := c.Get("userID")
+	
+	// 获取笔记，检查笔记所有权
+	note, err := models.GetNoteByID(uint(noteID))
+	if err != nil {
+		utils.NotFoundResponse(c, "笔记未找到")
+		return
+	}
+	
+	if note.UserID != userID.(uint) {
+		utils.ForbiddenResponse(c, "无权访问此笔记")
+		return
+	}
+	
+	suggestions, err := models.GetTagSuggestionsByNoteID(note.ID, c.DefaultQuery("status", models.SuggestionPending))
+	if err != nil {
+		utils.ServerErrorResponse(c, "获取标签建议失败")
+		return
+	}
+	
+	utils.OkResponse(c, suggestions, "获取标签建议成功")
+}
+
+// ReviewNoteTagSuggestions 采纳或拒绝笔记的标签建议，采纳的建议会添加为笔记标签
+func ReviewNoteTagSuggestions(c *gin.Context) {
+	// 获取笔记ID
+	noteID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.BadRequestResponse(c, "无效的笔记ID")
+		return
+	}
+	
+	var req ReviewTagSuggestionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, "无效的请求参数")
+		return
+	}
+	
+	// 获取当前用户ID
+	userID, _ := c.Get("userID")
+	
+	// 获取笔记，检查笔记所有权
+	note, err := models.GetNoteByID(uint(noteID))
+	if err != nil {
+		utils.NotFoundResponse(c, "笔记未找到")
+		return
+	}
+	
+	if note.UserID != userID.(uint) {
+		utils.ForbiddenResponse(c, "无权修改此笔记")
+		return
+	}
+	
+	// 只处理属于该笔记的待处理建议
+	pending, err := models.GetTagSuggestionsByNoteID(note.ID, models.SuggestionPending)
+	if err != nil {
+		utils.ServerErrorResponse(c, "获取标签建议失败")
+		return
+	}
+	suggestions := make(map[uint]models.TagSuggestion, len(pending))
+	for _, suggestion := range pending {
+		suggestions[suggestion.ID] = suggestion
+	}
+	
+	// 笔记已有的标签
+	hasTag := make(map[uint]bool, len(note.Tags))
+	for _, tag := range note.Tags {
+		hasTag[tag.ID] = true
+	}
+	
+	for _, id := range req.Accept {
+		suggestion, ok := suggestions[id]
+		if !ok {
+			continue
+		}
+		
+		tag, err := models.GetOrCreateTag(suggestion.Name)
+		if err != nil {
+			utils.ServerErrorResponse(c, "处理标签失败")
+			return
+		}
+		
+		if !hasTag[tag.ID] {
+			if err := models.AddTagToNote(note.ID, tag.ID); err != nil {
+				utils.ServerErrorResponse(c, "添加标签失败")
+				return
+			}
+			hasTag[tag.ID] = true
+		}
+		
+		if err := models.UpdateTagSuggestionStatus(id, models.SuggestionAccepted); err != nil {
+			utils.ServerErrorResponse(c, "更新标签建议失败")
+			return
+		}
+	}
+	
+	for _, id := range req.Reject {
+		if _, ok := suggestions[id]; !ok {
+			continue
+		}
+		
+		if err := models.UpdateTagSuggestionStatus(id, models.SuggestionRejected); err != nil {
+			utils.ServerErrorResponse(c, "更新标签建议失败")
+			return
+		}
+	}
+	
+	// 返回更新后的笔记
+	updatedNote, err := models.GetNoteByID(note.ID)
+	if err != nil {
+		utils.ServerErrorResponse(c, "获取更新后的笔记失败")
+		return
+	}
+	
+	utils.OkResponse(c, updatedNote, "标签建议已处理")
+}
@@ -0,0 +1,361 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+
+	"cyi-note/backend/jobs"
+	"cyi-note/backend/models"
+	"cyi-note/backend/utils"
+)
+
+// 写作助手请求
+type TransformRequest struct {
+	Action         string `json:"action" binding:"required"` // rewrite, continue, translate, fix_grammar, title
+	NoteID         *uint  `json:"note_id"`                   // 处理的笔记，未提供时处理content
+	Content        string `json:"content"`
+	SelectionStart *int   `json:"selection_start"` // 选中范围（按字符计），未提供时处理全文
+	SelectionEnd   *int   `json:"selection_end"`
+	TargetLang     string `json:"target_lang"` // 翻译目标语言：zh 或 en，为空时自动判断
+	SaveAs         string `json:"save_as"`     // 保存方式：revision（笔记修订版本）、note（新笔记），为空时不保存
+	Stream         *bool  `json:"stream"`      // 是否以SSE流式返回，默认true
+}
+
+// 提示词模板变量
+type promptData struct {
+	TargetLang string
+	Title      string
+}
+
+// 写作助手处理结果
+type transformOutput struct {
+	Action  string `json:"action"`
+	Result  string `json:"result"`  // 模型生成的文本
+	Title   string `json:"title"`   // 应用结果后的标题
+	Content string `json:"content"` // 应用结果后的完整内容
+	Saved   gin.H  `json:"saved,omitempty"`
+}
+
+// TransformContent 使用AI改写、续写、翻译、修正语法或生成标题
+func TransformContent(c *gin.Context) {
+	var req TransformRequest
+
+	// 验证请求
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, "无效的请求参数")
+		return
+	}
+
+	if !models.IsTransformAction(req.Action) {
+		utils.BadRequestResponse(c, "不支持的操作类型")
+		return
+	}
+	if req.SaveAs != "" && req.SaveAs != "revision" && req.SaveAs != "note" {
+		utils.BadRequestResponse(c, "无效的保存方式")
+		return
+	}
+	if req.SaveAs == "revision" && req.NoteID == nil {
+		utils.BadRequestResponse(c, "保存为修订版本需要提供笔记ID")
+		return
+	}
+
+	if !chatClient.Enabled() {
+		utils.ErrorResponse(c, http.StatusServiceUnavailable, "未配置AI对话模型")
+		return
+	}
+
+	// 获取当前用户ID
+	userID, _ := c.Get("userID")
+
+	// 确定要处理的标题和内容
+	title := ""
+	content := req.Content
+	if req.NoteID != nil {
+		note, err := models.GetNoteByID(*req.NoteID)
+		if err != nil {
+			utils.NotFoundResponse(c, "笔记未找到")
+			return
+		}
+
+		if note.UserID != userID.(uint) {
+			utils.ForbiddenResponse(c, "无权访问此笔记")
+			return
+		}
+
+		title = note.Title
+		content = note.Content
+	}
+
+	// 确定选中范围
+	runes := []rune(content)
+	start, end := 0, len(runes)
+	if req.SelectionStart != nil || req.SelectionEnd != nil {
+		if req.SelectionStart != nil {
+			start = *req.SelectionStart
+		}
+		if req.SelectionEnd != nil {
+			end = *req.SelectionEnd
+		}
+		if start < 0 || end > len(runes) || start > end {
+			utils.BadRequestResponse(c, "无效的选中范围")
+			return
+		}
+	}
+
+	text := string(runes[start:end])
+	if strings.TrimSpace(text) == "" {
+		utils.BadRequestResponse(c, "没有需要处理的内容")
+		return
+	}
+
+	// 渲染提示词模板
+	targetLang := req.TargetLang
+	if targetLang == "" {
+		targetLang = detectTargetLang(text)
+	}
+	systemPrompt, err := renderPromptTemplate(req.Action, promptData{
+		TargetLang: languageName(targetLang),
+		Title:      title,
+	})
+	if err != nil {
+		utils.ServerErrorResponse(c, "渲染提示词模板失败")
+		return
+	}
+
+	// 消耗AI调用次数并占用一个AI任务并发数，调用失败时退还次数
+	job, err := jobs.Begin(userID.(uint), jobs.TypeTransform, req.NoteID, gin.H{"action": req.Action, "content": text})
+	if err != nil {
+		jobErrorResponse(c, err, "检查AI配额失败")
+		return
+	}
+
+	messages := []utils.ChatMessage{
+		{Role: "system", Content: systemPrompt},
+		{Role: "user", Content: text},
+	}
+
+	// 生成结果后应用到标题或内容，并按需保存
+	finish := func(result string) (*transformOutput, error) {
+		result = strings.TrimSpace(result)
+		output := &transformOutput{Action: req.Action, Result: result, Title: title, Content: content}
+
+		switch req.Action {
+		case models.TransformTitle:
+			output.Title = strings.Trim(strings.SplitN(result, "\n", 2)[0], "\"“”《》# ")
+		case models.TransformContinue:
+			output.Content = string(runes[:end]) + "\n\n" + result + string(runes[end:])
+		default:
+			output.Content = string(runes[:start]) + result + string(runes[end:])
+		}
+		if output.Title == "" {
+			output.Title = "AI生成的笔记"
+		}
+
+		saved, err := saveTransformResult(userID.(uint), req, output)
+		if err != nil {
+			return nil, err
+		}
+		output.Saved = saved
+		return output, nil
+	}
+
+	// 非流式：直接返回完整结果
+	if req.Stream != nil && !*req.Stream {
+		result, err := chatClient.Complete(c.Request.Context(), messages)
+		if err != nil {
+			jobs.Fail(job, err)
+			utils.ServerErrorResponse(c, "AI处理失败")
+			return
+		}
+
+		output, err := finish(result)
+		if err != nil {
+			jobs.Fail(job, err)
+			utils.ServerErrorResponse(c, "保存结果失败")
+			return
+		}
+
+		jobs.Finish(job, output)
+		utils.OkResponse(c, output, "AI处理成功")
+		return
+	}
+
+	// 流式：逐段推送生成的文本，结束后推送完整结果
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	result, err := chatClient.Stream(c.Request.Context(), messages, func(delta string) error {
+		c.SSEvent("token", gin.H{"content": delta})
+		c.Writer.Flush()
+		return nil
+	})
+	if err != nil {
+		jobs.Fail(job, err)
+		c.SSEvent("error", gin.H{"error": "AI处理失败"})
+		c.Writer.Flush()
+		return
+	}
+
+	output, err := finish(result)
+	if err != nil {
+		jobs.Fail(job, err)
+		c.SSEvent("error", gin.H{"error": "保存结果失败"})
+		c.Writer.Flush()
+		return
+	}
+
+	jobs.Finish(job, output)
+	c.SSEvent("done", output)
+	c.Writer.Flush()
+}
+
+// saveTransformResult 按请求将结果保存为笔记修订版本或新笔记
+func saveTransformResult(userID uint, req TransformRequest, output *transformOutput) (gin.H, error) {
+	switch req.SaveAs {
+	case "revision":
+		revision := models.NoteRevision{
+			NoteID:  *req.NoteID,
+			UserID:  userID,
+			Title:   output.Title,
+			Content: output.Content,
+			Source:  "ai:" + req.Action,
+		}
+		if err := models.CreateNoteRevision(&revision); err != nil {
+			return nil, err
+		}
+		return gin.H{"type": "revision", "id": revision.ID}, nil
+	case "note":
+		note := models.Note{
+			UserID:  userID,
+			Title:   output.Title,
+			Content: output.Content,
+		}
+		if err := models.CreateNote(&note); err != nil {
+			return nil, err
+		}
+		syncAttachmentReferences(&note)
+		return gin.H{"type": "note", "id": note.ID}, nil
+	}
+	return nil, nil
+}
+
+// renderPromptTemplate 渲染动作对应的提示词模板
+func renderPromptTemplate(action string, data promptData) (string, error) {
+	promptTemplate, err := models.GetPromptTemplate(action)
+	if err != nil {
+		return "", err
+	}
+
+	tmpl, err := template.New(action).Parse(promptTemplate.Template)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// detectTargetLang 自动判断翻译目标语言：中文内容译为英文，其他内容译为中文
+func detectTargetLang(text string) string {
+	han, letters := 0, 0
+	for _, r := range text {
+		if unicode.Is(unicode.Han, r) {
+			han++
+		} else if unicode.IsLetter(r) {
+			letters++
+		}
+	}
+	if han > 0 && han*2 >= letters {
+		return "en"
+	}
+	return "zh"
+}
+
+// languageName 语言代码对应的名称
+func languageName(lang string) string {
+	if strings.HasPrefix(strings.ToLower(lang), "en") {
+		return "英文"
+	}
+	return "中文"
+}
+
+// GetPromptTemplates 管理员获取写作助手的提示词模板
+func GetPromptTemplates(c *gin.Context) {
+	templates, err := models.GetPromptTemplates()
+	if err != nil {
+		utils.ServerErrorResponse(c, "获取提示词模板失败")
+		return
+	}
+
+	utils.OkResponse(c, templates, "获取提示词模板成功")
+}
+
+// 提示词模板更新请求
+type UpdatePromptTemplateRequest struct {
+	Template string `json:"template" binding:"required"`
+}
+
+// UpdatePromptTemplate 管理员更新写作助手的提示词模板
+func UpdatePromptTemplate(c *gin.Context) {
+	action := c.Param("action")
+	if !models.IsTransformAction(action) {
+		utils.NotFoundResponse(c, "不支持的操作类型")
+		return
+	}
+
+	var req UpdatePromptTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, "无效的请求参数")
+		return
+	}
+
+	// 检查模板语法
+	tmpl, err := template.New(action).Parse(req.Template)
+	if err == nil {
+		err = tmpl.Execute(&bytes.Buffer{}, promptData{TargetLang: "英文", Title: "标题"})
+	}
+	if err != nil {
+		utils.BadRequestResponse(c, "模板语法错误: "+err.Error())
+		return
+	}
+
+	promptTemplate := models.PromptTemplate{Action: action, Template: req.Template}
+	if err := models.SavePromptTemplate(&promptTemplate); err != nil {
+		utils.ServerErrorResponse(c, "保存提示词模板失败")
+		return
+	}
+
+	utils.OkResponse(c, promptTemplate, "提示词模板已更新")
+}
+
+// ResetPromptTemplate 管理员将提示词模板恢复为默认值
+func ResetPromptTemplate(c *gin.Context) {
+	action := c.Param("action")
+	if !models.IsTransformAction(action) {
+		utils.NotFoundResponse(c, "不支持的操作类型")
+		return
+	}
+
+	if err := models.ResetPromptTemplate(action); err != nil {
+		utils.ServerErrorResponse(c, "恢复默认模板失败")
+		return
+	}
+
+	promptTemplate, err := models.GetPromptTemplate(action)
+	if err != nil {
+		utils.ServerErrorResponse(c, "获取提示词模板失败")
+		return
+	}
+
+	utils.OkResponse(c, promptTemplate, "已恢复默认模板")
+}
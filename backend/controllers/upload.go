@@ -0,0 +1,478 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"cyi-note/backend/config"
+	"cyi-note/backend/jobs"
+	"cyi-note/backend/models"
+	"cyi-note/backend/utils"
+)
+
+// tus协议版本及支持的扩展
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,creation-with-upload,expiration,checksum,termination"
+	tusChecksums  = "sha1,sha256,md5"
+)
+
+// statusChecksumMismatch tus协议规定的校验和不匹配状态码
+const statusChecksumMismatch = 460
+
+var (
+	uploadPartialDir string
+	uploadExpiration time.Duration
+	uploadMaxSize    int64
+
+	// uploadLocks 每个上传会话一把锁，避免同一会话的PATCH请求并发写入
+	uploadLocks sync.Map
+)
+
+// InitUploadController 初始化断点续传控制器，并定期清理过期的上传会话
+func InitUploadController(cfg *config.Config) {
+	uploadPartialDir = cfg.UploadPartialDir
+	uploadExpiration = time.Duration(cfg.UploadExpiration) * time.Hour
+	uploadMaxSize = cfg.UploadMaxSize * 1024 * 1024
+
+	if err := os.MkdirAll(uploadPartialDir, 0755); err != nil {
+		panic(fmt.Sprintf("无法创建断点续传目录 %s: %v", uploadPartialDir, err))
+	}
+
+	go func() {
+		for {
+			cleanupExpiredUploads()
+			time.Sleep(time.Hour)
+		}
+	}()
+}
+
+// TusHeaders 为所有断点续传响应设置协议版本，并拒绝不兼容的客户端版本
+func TusHeaders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Tus-Resumable", tusVersion)
+
+		if c.Request.Method != http.MethodOptions && c.GetHeader("Tus-Resumable") != tusVersion {
+			c.Header("Tus-Version", tusVersion)
+			utils.ErrorResponse(c, http.StatusPreconditionFailed, "不支持的tus协议版本")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// GetUploadOptions 返回服务器支持的tus协议版本和扩展
+func GetUploadOptions(c *gin.Context) {
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	c.Header("Tus-Checksum-Algorithm", tusChecksums)
+	c.Header("Tus-Max-Size", strconv.FormatInt(uploadMaxSize, 10))
+	c.Status(http.StatusNoContent)
+}
+
+// CreateUpload 创建上传会话
+// Upload-Metadata 支持 filename、filetype、note_id 和 temp，未提供 note_id 时上传为临时附件
+func CreateUpload(c *gin.Context) {
+	// 获取当前用户ID
+	userID, _ := c.Get("userID")
+
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		utils.BadRequestResponse(c, "无效的Upload-Length")
+		return
+	}
+	if length > uploadMaxSize {
+		utils.ErrorResponse(c, http.StatusRequestEntityTooLarge, "文件大小超过限制")
+		return
+	}
+	if err := models.CheckStorageQuota(userID.(uint), length); err != nil {
+		saveFileErrorResponse(c, err)
+		return
+	}
+
+	metadata, err := parseUploadMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		utils.BadRequestResponse(c, "无效的Upload-Metadata")
+		return
+	}
+
+	upload := models.Upload{
+		UserID:    userID.(uint),
+		Length:    length,
+		Metadata:  c.GetHeader("Upload-Metadata"),
+		Filename:  metadata["filename"],
+		Filetype:  metadata["filetype"],
+		IsTemp:    metadata["temp"] == "true",
+		ExpiresAt: time.Now().Add(uploadExpiration),
+	}
+	if upload.Filename == "" {
+		upload.Filename = "upload"
+	}
+	if upload.Filetype == "" {
+		upload.Filetype = "application/octet-stream"
+	}
+
+	// 检查笔记是否存在且属于当前用户
+	if value := metadata["note_id"]; value != "" && !upload.IsTemp {
+		noteID, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			utils.BadRequestResponse(c, "无效的笔记ID")
+			return
+		}
+
+		note, err := models.GetNoteByID(uint(noteID))
+		if err != nil {
+			utils.NotFoundResponse(c, "笔记未找到")
+			return
+		}
+		if note.UserID != userID.(uint) {
+			utils.ForbiddenResponse(c, "无权为此笔记上传附件")
+			return
+		}
+
+		id := uint(noteID)
+		upload.NoteID = &id
+	}
+	if upload.NoteID == nil {
+		upload.IsTemp = true
+	}
+
+	// 生成会话ID并创建空文件
+	upload.ID, err = newUploadID()
+	if err != nil {
+		utils.ServerErrorResponse(c, "创建上传会话失败")
+		return
+	}
+	file, err := os.Create(partialPath(upload.ID))
+	if err != nil {
+		utils.ServerErrorResponse(c, "创建上传会话失败")
+		return
+	}
+	file.Close()
+
+	if err := models.CreateUpload(&upload); err != nil {
+		os.Remove(partialPath(upload.ID))
+		utils.ServerErrorResponse(c, "创建上传会话失败")
+		return
+	}
+
+	c.Header("Location", "/api/uploads/"+upload.ID)
+
+	// creation-with-upload：创建请求可以直接携带第一段数据
+	if c.GetHeader("Content-Type") == "application/offset+octet-stream" && c.Request.ContentLength != 0 {
+		if !writeUploadChunk(c, &upload) {
+			return
+		}
+	} else if upload.Length == 0 {
+		// 空文件无需再上传数据
+		if err := finishUpload(&upload); err != nil {
+			saveFileErrorResponse(c, err)
+			return
+		}
+	}
+	setUploadHeaders(c, &upload)
+
+	c.Status(http.StatusCreated)
+}
+
+// GetUploadStatus 查询上传会话的进度（tus HEAD请求）
+func GetUploadStatus(c *gin.Context) {
+	upload, ok := getOwnUpload(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	if upload.Metadata != "" {
+		c.Header("Upload-Metadata", upload.Metadata)
+	}
+	c.Header("Cache-Control", "no-store")
+	setUploadHeaders(c, upload)
+	c.Status(http.StatusOK)
+}
+
+// PatchUpload 从指定偏移量继续上传数据
+func PatchUpload(c *gin.Context) {
+	if c.GetHeader("Content-Type") != "application/offset+octet-stream" {
+		utils.ErrorResponse(c, http.StatusUnsupportedMediaType, "Content-Type必须为application/offset+octet-stream")
+		return
+	}
+
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		utils.BadRequestResponse(c, "无效的Upload-Offset")
+		return
+	}
+
+	// 同一会话的写入串行执行
+	lock, _ := uploadLocks.LoadOrStore(c.Param("id"), &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	upload, ok := getOwnUpload(c)
+	if !ok {
+		return
+	}
+	if upload.AttachmentID != nil || upload.Offset != offset {
+		utils.ErrorResponse(c, http.StatusConflict, "Upload-Offset与服务器记录不一致")
+		return
+	}
+
+	if !writeUploadChunk(c, upload) {
+		return
+	}
+
+	setUploadHeaders(c, upload)
+	c.Status(http.StatusNoContent)
+}
+
+// DeleteUpload 终止上传会话并删除已上传的数据
+func DeleteUpload(c *gin.Context) {
+	upload, ok := getOwnUpload(c)
+	if !ok {
+		return
+	}
+
+	if err := models.DeleteUpload(upload.ID); err != nil {
+		utils.ServerErrorResponse(c, "删除上传会话失败")
+		return
+	}
+	os.Remove(partialPath(upload.ID))
+	uploadLocks.Delete(upload.ID)
+
+	c.Status(http.StatusNoContent)
+}
+
+// writeUploadChunk 将请求体追加到上传文件，数据接收完整后创建附件
+// 失败时写入错误响应并返回false
+func writeUploadChunk(c *gin.Context, upload *models.Upload) bool {
+	// 解析校验和：Upload-Checksum: <算法> <Base64编码的摘要>
+	var checksum hash.Hash
+	var expected []byte
+	if header := c.GetHeader("Upload-Checksum"); header != "" {
+		parts := strings.SplitN(header, " ", 2)
+		if len(parts) != 2 {
+			utils.BadRequestResponse(c, "无效的Upload-Checksum")
+			return false
+		}
+
+		switch parts[0] {
+		case "sha1":
+			checksum = sha1.New()
+		case "sha256":
+			checksum = sha256.New()
+		case "md5":
+			checksum = md5.New()
+		default:
+			utils.BadRequestResponse(c, "不支持的校验算法")
+			return false
+		}
+
+		var err error
+		if expected, err = base64.StdEncoding.DecodeString(parts[1]); err != nil {
+			utils.BadRequestResponse(c, "无效的Upload-Checksum")
+			return false
+		}
+	}
+
+	file, err := os.OpenFile(partialPath(upload.ID), os.O_WRONLY, 0644)
+	if err != nil {
+		utils.ServerErrorResponse(c, "打开上传文件失败")
+		return false
+	}
+	defer file.Close()
+	if _, err := file.Seek(upload.Offset, io.SeekStart); err != nil {
+		utils.ServerErrorResponse(c, "打开上传文件失败")
+		return false
+	}
+
+	// 最多接收到文件总大小，多读一个字节用于判断是否超出
+	var writer io.Writer = file
+	if checksum != nil {
+		writer = io.MultiWriter(file, checksum)
+	}
+	remaining := upload.Length - upload.Offset
+	written, copyErr := io.Copy(writer, io.LimitReader(c.Request.Body, remaining+1))
+
+	// 超出文件总大小或校验失败时丢弃本次写入的数据
+	discard := func() {
+		file.Truncate(upload.Offset)
+	}
+	if written > remaining {
+		discard()
+		utils.ErrorResponse(c, http.StatusRequestEntityTooLarge, "上传数据超过Upload-Length")
+		return false
+	}
+	if checksum != nil {
+		if copyErr != nil {
+			// 数据不完整时无法校验，丢弃本次数据，客户端从原偏移量重试
+			discard()
+			utils.BadRequestResponse(c, "读取上传数据失败")
+			return false
+		}
+		if !bytes.Equal(checksum.Sum(nil), expected) {
+			discard()
+			utils.ErrorResponse(c, statusChecksumMismatch, "校验和不匹配")
+			return false
+		}
+	}
+
+	// 连接中断时保留已接收的数据，客户端可以通过HEAD请求获取偏移量后继续上传
+	upload.Offset += written
+	upload.ExpiresAt = time.Now().Add(uploadExpiration)
+	if err := models.UpdateUploadOffset(upload.ID, upload.Offset, upload.ExpiresAt); err != nil {
+		utils.ServerErrorResponse(c, "更新上传进度失败")
+		return false
+	}
+	if copyErr != nil {
+		utils.BadRequestResponse(c, "读取上传数据失败")
+		return false
+	}
+
+	if upload.Offset == upload.Length {
+		if err := finishUpload(upload); err != nil {
+			saveFileErrorResponse(c, err)
+			return false
+		}
+	}
+	return true
+}
+
+// finishUpload 上传完成后创建附件并删除未完成文件
+func finishUpload(upload *models.Upload) error {
+	file, err := os.Open(partialPath(upload.ID))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		file.Close()
+		os.Remove(partialPath(upload.ID))
+	}()
+
+	var noteID uint
+	if upload.NoteID != nil {
+		noteID = *upload.NoteID
+	}
+
+	attachment, err := models.SaveFile(file, upload.Filename, noteID, upload.UserID, upload.IsTemp)
+	if err != nil {
+		// 未完成文件已被删除，会话无法继续
+		models.DeleteUpload(upload.ID)
+		uploadLocks.Delete(upload.ID)
+		return err
+	}
+
+	if err := models.CompleteUpload(upload.ID, attachment.ID); err != nil {
+		return err
+	}
+	upload.AttachmentID = &attachment.ID
+
+	// 后台生成图片缩略图
+	jobs.AttachmentSaved(attachment)
+	return nil
+}
+
+// getOwnUpload 获取当前用户的上传会话，不存在或已过期时写入错误响应并返回false
+func getOwnUpload(c *gin.Context) (*models.Upload, bool) {
+	userID, _ := c.Get("userID")
+
+	upload, err := models.GetUploadByID(c.Param("id"))
+	if err != nil || upload.UserID != userID.(uint) {
+		utils.NotFoundResponse(c, "上传会话未找到")
+		return nil, false
+	}
+	if upload.AttachmentID == nil && time.Now().After(upload.ExpiresAt) {
+		utils.ErrorResponse(c, http.StatusGone, "上传会话已过期")
+		return nil, false
+	}
+
+	return upload, true
+}
+
+// setUploadHeaders 设置上传进度相关的响应头
+func setUploadHeaders(c *gin.Context, upload *models.Upload) {
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	if upload.AttachmentID != nil {
+		c.Header("X-Attachment-Id", strconv.FormatUint(uint64(*upload.AttachmentID), 10))
+	} else {
+		c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+}
+
+// parseUploadMetadata 解析Upload-Metadata：以逗号分隔的“键 Base64值”列表，值可以省略
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, " ", 2)
+		value := ""
+		if len(parts) == 2 {
+			decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(parts[1]))
+			if err != nil {
+				return nil, err
+			}
+			value = string(decoded)
+		}
+		metadata[parts[0]] = value
+	}
+	return metadata, nil
+}
+
+// cleanupExpiredUploads 删除过期且未完成的上传会话，以及已完成会话的记录
+func cleanupExpiredUploads() {
+	uploads, err := models.GetExpiredUploads(time.Now())
+	if err != nil {
+		log.Printf("查询过期上传会话失败: %v", err)
+		return
+	}
+
+	for _, upload := range uploads {
+		if err := models.DeleteUpload(upload.ID); err != nil {
+			log.Printf("删除上传会话 %s 失败: %v", upload.ID, err)
+			continue
+		}
+		if err := os.Remove(partialPath(upload.ID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("删除上传文件 %s 失败: %v", upload.ID, err)
+		}
+		uploadLocks.Delete(upload.ID)
+	}
+}
+
+// newUploadID 生成随机的上传会话ID
+func newUploadID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// partialPath 上传会话未完成文件的路径
+func partialPath(id string) string {
+	return filepath.Join(uploadPartialDir, id)
+}
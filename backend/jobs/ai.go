@@ -0,0 +1,213 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"cyi-note/backend/models"
+	"cyi-note/backend/utils"
+)
+
+// AI任务类型
+const (
+	TypeSummary = "summary" // 生成摘要
+	TypeTags    = "tags"    // 提取标签
+
+	TypeTagSuggestions = "tag_suggestions" // 为笔记生成待确认的标签建议
+
+	TypeAsk       = "ask"       // 笔记问答，在请求中同步执行
+	TypeTransform = "transform" // 写作助手，在请求中同步执行
+)
+
+// ContentInput 以文本内容为参数的任务输入
+type ContentInput struct {
+	Content string `json:"content"`
+}
+
+// SummaryResult 摘要任务结果
+type SummaryResult struct {
+	Summary string `json:"summary"`
+}
+
+// TagsResult 标签任务结果
+type TagsResult struct {
+	Tags []string `json:"tags"`
+}
+
+// TagSuggestionsResult 标签建议任务结果
+type TagSuggestionsResult struct {
+	Suggestions []utils.TagSuggestion `json:"suggestions"`
+}
+
+func init() {
+	Register(TypeSummary, &Handler{
+		Run:        runSummary,
+		Apply:      applySummary,
+		CacheKey:   contentCacheKey,
+		UseAIQuota: true,
+		AI:         true,
+	})
+	Register(TypeTags, &Handler{
+		Run:      runTags,
+		CacheKey: contentCacheKey,
+		AI:       true,
+	})
+	// 标签建议依赖用户已有的标签，不按内容缓存
+	Register(TypeTagSuggestions, &Handler{
+		Run:   runTagSuggestions,
+		Apply: applyTagSuggestions,
+		AI:    true,
+	})
+	Register(TypeAsk, &Handler{
+		UseAIQuota: true,
+		AI:         true,
+		Inline:     true,
+	})
+	Register(TypeTransform, &Handler{
+		UseAIQuota: true,
+		AI:         true,
+		Inline:     true,
+	})
+}
+
+// contentCacheKey 按用户、任务类型和文本内容计算缓存键，内容不变时复用结果
+// 缓存不在用户之间共享，避免通过命中缓存得知其他用户提交过相同的内容
+func contentCacheKey(job *models.Job) string {
+	var input ContentInput
+	json.Unmarshal([]byte(job.Input), &input)
+	return HashContent(job.Type, strconv.FormatUint(uint64(job.UserID), 10), input.Content)
+}
+
+// runSummary 生成摘要
+func runSummary(ctx context.Context, job *models.Job) (interface{}, error) {
+	var input ContentInput
+	if err := json.Unmarshal([]byte(job.Input), &input); err != nil {
+		return nil, err
+	}
+
+	summary, err := utils.SummarizeWithModel(ctx, chatClient, input.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	return SummaryResult{Summary: summary}, nil
+}
+
+// applySummary 将摘要写回关联的笔记
+func applySummary(job *models.Job, result []byte) error {
+	if job.NoteID == nil {
+		return nil
+	}
+
+	var output SummaryResult
+	if err := json.Unmarshal(result, &output); err != nil {
+		return err
+	}
+
+	return models.UpdateNoteSummary(*job.NoteID, output.Summary)
+}
+
+// runTags 提取标签
+func runTags(ctx context.Context, job *models.Job) (interface{}, error) {
+	var input ContentInput
+	if err := json.Unmarshal([]byte(job.Input), &input); err != nil {
+		return nil, err
+	}
+
+	tags, err := utils.ExtractKeywords(input.Content)
+	if err != nil {
+		return nil, err
+	}
+	if tags == nil {
+		tags = []string{}
+	}
+
+	return TagsResult{Tags: tags}, nil
+}
+
+// SuggestTags 为用户的内容生成标签建议
+// 提供noteID时排除笔记已有的标签和此前被拒绝的建议
+func SuggestTags(userID uint, noteID *uint, content string, limit int) ([]utils.TagSuggestion, error) {
+	tagsWithCount, err := models.GetAllTagsWithCount(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	excluded := make(map[string]bool)
+	if noteID != nil {
+		tags, err := models.GetTagsByNoteID(*noteID)
+		if err != nil {
+			return nil, err
+		}
+		for _, tag := range tags {
+			excluded[strings.ToLower(tag.Name)] = true
+		}
+
+		rejected, err := models.GetTagSuggestionsByNoteID(*noteID, models.SuggestionRejected)
+		if err != nil {
+			return nil, err
+		}
+		for _, suggestion := range rejected {
+			excluded[strings.ToLower(suggestion.Name)] = true
+		}
+	}
+
+	existingTags := make([]utils.ExistingTag, 0, len(tagsWithCount))
+	for _, tag := range tagsWithCount {
+		if excluded[strings.ToLower(tag.Name)] {
+			continue
+		}
+		existingTags = append(existingTags, utils.ExistingTag{ID: tag.ID, Name: tag.Name, NoteCount: tag.NoteCount})
+	}
+
+	// 多取一些建议，过滤后再截取
+	suggestions := utils.GenerateTagSuggestions(content, existingTags, limit+len(excluded))
+	result := make([]utils.TagSuggestion, 0, limit)
+	for _, suggestion := range suggestions {
+		if excluded[strings.ToLower(suggestion.Name)] {
+			continue
+		}
+		result = append(result, suggestion)
+		if len(result) == limit {
+			break
+		}
+	}
+
+	return result, nil
+}
+
+// runTagSuggestions 从笔记内容中提取标签建议
+func runTagSuggestions(ctx context.Context, job *models.Job) (interface{}, error) {
+	var input ContentInput
+	if err := json.Unmarshal([]byte(job.Input), &input); err != nil {
+		return nil, err
+	}
+
+	suggestions, err := SuggestTags(job.UserID, job.NoteID, input.Content, 10)
+	if err != nil {
+		return nil, err
+	}
+
+	return TagSuggestionsResult{Suggestions: suggestions}, nil
+}
+
+// applyTagSuggestions 将标签建议保存为笔记的待处理建议
+func applyTagSuggestions(job *models.Job, result []byte) error {
+	if job.NoteID == nil {
+		return nil
+	}
+
+	var output TagSuggestionsResult
+	if err := json.Unmarshal(result, &output); err != nil {
+		return err
+	}
+
+	suggestions := make([]models.TagSuggestion, 0, len(output.Suggestions))
+	for _, suggestion := range output.Suggestions {
+		suggestions = append(suggestions, models.TagSuggestion{Name: suggestion.Name, Score: suggestion.Score})
+	}
+
+	return models.ReplacePendingTagSuggestions(*job.NoteID, suggestions)
+}
@@ -0,0 +1,250 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"cyi-note/backend/models"
+	"cyi-note/backend/utils"
+)
+
+// 附件任务类型
+const (
+	TypeThumbnails        = "thumbnails"         // 为单个图片附件生成缩略图
+	TypeThumbnailBackfill = "thumbnail_backfill" // 为已有的图片补全缩略图
+	TypeTextExtraction    = "text_extraction"    // 提取单个附件中的文本
+	TypeTextBackfill      = "text_backfill"      // 为已有的附件补全提取的文本
+)
+
+// ThumbnailsInput 缩略图任务输入
+type ThumbnailsInput struct {
+	AttachmentID uint `json:"attachment_id"`
+}
+
+// ThumbnailsResult 缩略图任务结果
+type ThumbnailsResult struct {
+	Generated int `json:"generated"`
+}
+
+// TextExtractionInput 文本提取任务输入
+type TextExtractionInput struct {
+	AttachmentID uint `json:"attachment_id"`
+}
+
+// TextExtractionResult 文本提取任务结果
+type TextExtractionResult struct {
+	Length    int  `json:"length"`    // 提取的文本长度（字节）
+	Truncated bool `json:"truncated"` // 文本是否被截断
+}
+
+// TextBackfillResult 补全文本任务结果
+type TextBackfillResult struct {
+	Attachments int `json:"attachments"` // 处理的附件数量
+	Extracted   int `json:"extracted"`   // 成功提取的数量
+	Failed      int `json:"failed"`      // 提取失败的数量
+}
+
+// ThumbnailBackfillResult 补全缩略图任务结果
+type ThumbnailBackfillResult struct {
+	Images    int `json:"images"`    // 检查的图片数量
+	Generated int `json:"generated"` // 新生成的缩略图数量
+	Failed    int `json:"failed"`    // 生成失败的图片数量
+}
+
+func init() {
+	Register(TypeThumbnails, &Handler{
+		Run: runThumbnails,
+	})
+	Register(TypeThumbnailBackfill, &Handler{
+		Run:     runThumbnailBackfill,
+		Timeout: 2 * time.Hour,
+		Bulk:    true,
+	})
+	Register(TypeTextExtraction, &Handler{
+		Run: runTextExtraction,
+	})
+	Register(TypeTextBackfill, &Handler{
+		Run:     runTextBackfill,
+		Timeout: 2 * time.Hour,
+		Bulk:    true,
+	})
+}
+
+// AttachmentSaved 附件保存后在后台生成图片缩略图、提取文档中的文本
+func AttachmentSaved(attachment *models.Attachment) {
+	if utils.IsThumbnailable(attachment.Filetype) {
+		if _, err := Enqueue(attachment.UserID, TypeThumbnails, nil, ThumbnailsInput{AttachmentID: attachment.ID}); err != nil {
+			log.Printf("创建附件 %d 的缩略图任务失败: %v", attachment.ID, err)
+		}
+	}
+
+	if utils.IsTextExtractable(attachment.Filetype) {
+		if _, err := Enqueue(attachment.UserID, TypeTextExtraction, nil, TextExtractionInput{AttachmentID: attachment.ID}); err != nil {
+			log.Printf("创建附件 %d 的文本提取任务失败: %v", attachment.ID, err)
+		}
+	}
+}
+
+// runThumbnails 为附件生成所有尺寸的缩略图，已存在的尺寸会被跳过
+func runThumbnails(ctx context.Context, job *models.Job) (interface{}, error) {
+	var input ThumbnailsInput
+	if err := json.Unmarshal([]byte(job.Input), &input); err != nil {
+		return nil, err
+	}
+
+	attachment, err := models.GetAttachmentByID(input.AttachmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 早期上传的附件没有内容哈希，先计算哈希
+	if err := models.EnsureAttachmentHash(attachment); err != nil {
+		return nil, err
+	}
+	generated, err := models.EnsureThumbnails(attachment.Hash, attachment.StorageKey())
+	if err != nil {
+		return nil, err
+	}
+	return ThumbnailsResult{Generated: generated}, nil
+}
+
+// runThumbnailBackfill 遍历所有图片文件和早期上传的图片附件，补全缺少的缩略图
+// 单张图片失败不会中断任务，重复执行时只会生成仍然缺少的缩略图
+func runThumbnailBackfill(ctx context.Context, job *models.Job) (interface{}, error) {
+	var result ThumbnailBackfillResult
+	if err := backfillBlobThumbnails(ctx, &result); err != nil {
+		return nil, err
+	}
+	if err := backfillLegacyThumbnails(ctx, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// backfillBlobThumbnails 为去重存储的图片文件补全缩略图
+func backfillBlobThumbnails(ctx context.Context, result *ThumbnailBackfillResult) error {
+	var lastID uint
+	for {
+		blobs, err := models.GetImageBlobs(lastID, 100)
+		if err != nil {
+			return err
+		}
+		if len(blobs) == 0 {
+			return nil
+		}
+
+		for _, blob := range blobs {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			lastID = blob.ID
+			result.Images++
+
+			generated, err := models.EnsureThumbnails(blob.Hash, blob.StorageKey)
+			result.Generated += generated
+			if err != nil {
+				log.Printf("生成文件 %s 的缩略图失败: %v", blob.Hash, err)
+				result.Failed++
+			}
+		}
+	}
+}
+
+// backfillLegacyThumbnails 为未使用去重存储的早期图片附件计算内容哈希并补全缩略图
+func backfillLegacyThumbnails(ctx context.Context, result *ThumbnailBackfillResult) error {
+	var lastID uint
+	for {
+		attachments, err := models.GetLegacyImageAttachments(lastID, 100)
+		if err != nil {
+			return err
+		}
+		if len(attachments) == 0 {
+			return nil
+		}
+
+		for i := range attachments {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			attachment := &attachments[i]
+			lastID = attachment.ID
+			if !utils.IsThumbnailable(attachment.Filetype) {
+				continue
+			}
+			result.Images++
+
+			if err := models.EnsureAttachmentHash(attachment); err != nil {
+				log.Printf("计算附件 %d 的内容哈希失败: %v", attachment.ID, err)
+				result.Failed++
+				continue
+			}
+			generated, err := models.EnsureThumbnails(attachment.Hash, attachment.StorageKey())
+			result.Generated += generated
+			if err != nil {
+				log.Printf("生成附件 %d 的缩略图失败: %v", attachment.ID, err)
+				result.Failed++
+			}
+		}
+	}
+}
+
+// runTextExtraction 提取附件中的文本，用于搜索
+func runTextExtraction(ctx context.Context, job *models.Job) (interface{}, error) {
+	var input TextExtractionInput
+	if err := json.Unmarshal([]byte(job.Input), &input); err != nil {
+		return nil, err
+	}
+
+	attachment, err := models.GetAttachmentByID(input.AttachmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	text, err := models.ExtractAttachmentText(attachment)
+	if err != nil {
+		return nil, err
+	}
+	return TextExtractionResult{Length: len(text.Content), Truncated: text.Truncated}, nil
+}
+
+// runTextBackfill 遍历尚未提取文本的附件，提取其中的文本
+// 提取失败的附件会记录失败原因，重复执行时不会再次处理
+func runTextBackfill(ctx context.Context, job *models.Job) (interface{}, error) {
+	var result TextBackfillResult
+	var lastID uint
+	for {
+		attachments, err := models.GetAttachmentsWithoutText(lastID, 100)
+		if err != nil {
+			return nil, err
+		}
+		if len(attachments) == 0 {
+			break
+		}
+
+		for i := range attachments {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			attachment := &attachments[i]
+			lastID = attachment.ID
+			if !utils.IsTextExtractable(attachment.Filetype) {
+				continue
+			}
+			result.Attachments++
+
+			if _, err := models.ExtractAttachmentText(attachment); err != nil {
+				log.Printf("提取附件 %d 的文本失败: %v", attachment.ID, err)
+				result.Failed++
+			} else {
+				result.Extracted++
+			}
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,276 @@
+package jobs
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"cyi-note/backend/config"
+	"cyi-note/backend/models"
+	"cyi-note/backend/storage"
+	"cyi-note/backend/utils"
+)
+
+// 导出任务类型
+const (
+	TypeExportMarkdown = "export_markdown" // 将用户的所有笔记导出为Markdown ZIP
+)
+
+// ExportResult 导出任务结果
+type ExportResult struct {
+	Filename    string `json:"filename"`    // 下载时使用的文件名
+	Size        int64  `json:"size"`        // ZIP的大小（字节）
+	Notes       int    `json:"notes"`       // 导出的笔记数量
+	Attachments int    `json:"attachments"` // 导出的附件数量
+	Missing     []uint `json:"missing"`     // 文件已丢失、没有导出的附件ID，笔记中保留原来的链接
+}
+
+// 每批读取的笔记数量
+const exportBatchSize = 100
+
+func init() {
+	Register(TypeExportMarkdown, &Handler{
+		Run:     runExportMarkdown,
+		Timeout: 2 * time.Hour,
+		Bulk:    true,
+	})
+}
+
+// ExportPath 导出任务生成的ZIP的路径
+func ExportPath(jobID uint) string {
+	return filepath.Join(settings.ExportDir, fmt.Sprintf("%d.zip", jobID))
+}
+
+// ExportExpiresAt 导出的ZIP的过期时间，过期后文件会被删除；不自动删除时返回零值
+func ExportExpiresAt(job *models.Job) time.Time {
+	if job.FinishedAt == nil || settings.ExportTTL <= 0 {
+		return time.Time{}
+	}
+	return job.FinishedAt.Add(time.Duration(settings.ExportTTL) * time.Hour)
+}
+
+// runExportMarkdown 将用户的每篇笔记导出为带有YAML front matter的 .md 文件，附件保存在 assets 目录中，
+// 笔记中的附件链接改写为相对地址；先写入临时文件，完成后重命名，避免下载到不完整的文件
+func runExportMarkdown(ctx context.Context, job *models.Job) (interface{}, error) {
+	total, err := models.CountNotesByUserID(job.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(settings.ExportDir, 0755); err != nil {
+		return nil, fmt.Errorf("创建导出目录失败: %v", err)
+	}
+	path := ExportPath(job.ID)
+	temp, err := os.CreateTemp(settings.ExportDir, "export_*.part")
+	if err != nil {
+		return nil, fmt.Errorf("创建导出文件失败: %v", err)
+	}
+	defer os.Remove(temp.Name())
+	defer temp.Close()
+
+	exporter := &markdownExporter{
+		ctx:        ctx,
+		userID:     job.UserID,
+		zip:        zip.NewWriter(temp),
+		notes:      utils.NewArchiveNamer(),
+		assets:     utils.NewArchiveNamer(),
+		assetNames: make(map[uint]string),
+		missing:    make(map[uint]bool),
+		result:     &ExportResult{Filename: fmt.Sprintf("notes-%s.zip", time.Now().Format("20060102-150405")), Missing: []uint{}},
+	}
+
+	var lastUpdate time.Time
+	err = models.FindNotesInBatches(job.UserID, exportBatchSize, func(notes []models.Note) error {
+		for i := range notes {
+			if err := exporter.writeNote(&notes[i]); err != nil {
+				return err
+			}
+			if time.Since(lastUpdate) >= progressInterval && total > 0 {
+				lastUpdate = time.Now()
+				done := exporter.result.Notes
+				models.UpdateJobProgress(job.ID, done*100/int(total), fmt.Sprintf("导出笔记（%d/%d）", done, total))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := exporter.zip.Close(); err != nil {
+		return nil, fmt.Errorf("写入导出文件失败: %v", err)
+	}
+	info, err := temp.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if err := temp.Close(); err != nil {
+		return nil, fmt.Errorf("写入导出文件失败: %v", err)
+	}
+	if err := os.Rename(temp.Name(), path); err != nil {
+		return nil, fmt.Errorf("保存导出文件失败: %v", err)
+	}
+	exporter.result.Size = info.Size()
+	return exporter.result, nil
+}
+
+// markdownExporter 将笔记和附件写入导出的ZIP
+type markdownExporter struct {
+	ctx        context.Context
+	userID     uint
+	zip        *zip.Writer
+	notes      *utils.ArchiveNamer // 笔记的文件名
+	assets     *utils.ArchiveNamer // 附件的文件名
+	assetNames map[uint]string     // 已导出的附件ID -> 文件名，多篇笔记引用同一附件时只导出一次
+	missing    map[uint]bool       // 文件已丢失的附件
+	result     *ExportResult
+}
+
+// writeNote 导出一篇笔记及其附件，包括内容中引用的其他笔记的附件
+func (e *markdownExporter) writeNote(note *models.Note) error {
+	if err := e.ctx.Err(); err != nil {
+		return err
+	}
+
+	attachments := note.Attachments
+	var others []uint
+	for _, id := range utils.ParseAttachmentReferences(note.Content) {
+		if _, ok := e.assetNames[id]; ok || e.missing[id] || hasAttachment(attachments, id) {
+			continue
+		}
+		others = append(others, id)
+	}
+	if len(others) > 0 {
+		referenced, err := models.GetUserAttachmentsByIDs(e.userID, others)
+		if err != nil {
+			return err
+		}
+		attachments = append(attachments, referenced...)
+	}
+	for i := range attachments {
+		if err := e.writeAsset(&attachments[i]); err != nil {
+			return err
+		}
+	}
+
+	content := utils.ReplaceAttachmentLinks(note.Content, func(id uint) (string, bool) {
+		name, ok := e.assetNames[id]
+		if !ok {
+			return "", false
+		}
+		return utils.ExportAssetLink(name), true
+	})
+
+	tags := make([]string, 0, len(note.Tags))
+	for _, tag := range note.Tags {
+		tags = append(tags, tag.Name)
+	}
+	markdown, err := utils.MarkdownWithFrontMatter(utils.ExportFrontMatter{
+		ID:        note.ID,
+		Title:     note.Title,
+		Tags:      tags,
+		CreatedAt: note.CreatedAt,
+		UpdatedAt: note.UpdatedAt,
+		IsPublic:  note.IsPublic,
+		Summary:   note.Summary,
+	}, content)
+	if err != nil {
+		return err
+	}
+
+	entry, err := e.zip.CreateHeader(&zip.FileHeader{
+		Name:     e.notes.Name(note.Title + ".md"),
+		Method:   zip.Deflate,
+		Modified: note.UpdatedAt,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(entry, markdown); err != nil {
+		return err
+	}
+	e.result.Notes++
+	return nil
+}
+
+// writeAsset 将附件写入 assets 目录，已导出或文件已丢失的附件跳过
+func (e *markdownExporter) writeAsset(attachment *models.Attachment) error {
+	if _, ok := e.assetNames[attachment.ID]; ok || e.missing[attachment.ID] {
+		return nil
+	}
+
+	reader, err := storage.Current().Get(e.ctx, attachment.StorageKey())
+	if errors.Is(err, storage.ErrNotExist) {
+		log.Printf("导出附件 %d 时文件不存在，已跳过", attachment.ID)
+		e.missing[attachment.ID] = true
+		e.result.Missing = append(e.result.Missing, attachment.ID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	name := e.assets.Name(attachment.Filename)
+	header := &zip.FileHeader{
+		Name:     utils.ExportAssetDir + "/" + name,
+		Method:   zip.Deflate,
+		Modified: attachment.CreatedAt,
+	}
+	if utils.IsCompressedType(attachment.Filetype) {
+		header.Method = zip.Store
+	}
+	entry, err := e.zip.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(entry, reader); err != nil {
+		return err
+	}
+	e.assetNames[attachment.ID] = name
+	e.result.Attachments++
+	return nil
+}
+
+// hasAttachment 检查附件列表中是否包含指定ID的附件
+func hasAttachment(attachments []models.Attachment, id uint) bool {
+	for i := range attachments {
+		if attachments[i].ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// startExportCleanup 每小时删除过期的导出文件以及中断的导出留下的临时文件
+func startExportCleanup(cfg *config.Config) {
+	if cfg.ExportTTL <= 0 {
+		return
+	}
+	ttl := time.Duration(cfg.ExportTTL) * time.Hour
+
+	go func() {
+		for {
+			entries, err := os.ReadDir(cfg.ExportDir)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				log.Printf("读取导出目录失败: %v", err)
+			}
+			for _, entry := range entries {
+				info, err := entry.Info()
+				if err != nil || entry.IsDir() || time.Since(info.ModTime()) < ttl {
+					continue
+				}
+				if err := os.Remove(filepath.Join(cfg.ExportDir, entry.Name())); err != nil {
+					log.Printf("删除过期的导出文件 %s 失败: %v", entry.Name(), err)
+				}
+			}
+			time.Sleep(time.Hour)
+		}
+	}()
+}
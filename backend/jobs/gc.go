@@ -0,0 +1,49 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"cyi-note/backend/config"
+	"cyi-note/backend/models"
+)
+
+// storageGCGracePeriod 最近写入的文件和记录可能正处于上传流程中，清理时跳过
+const storageGCGracePeriod = time.Hour
+
+// StorageGCOptions 按配置生成存储清理参数
+func StorageGCOptions(cfg *config.Config, dryRun bool) models.StorageGCOptions {
+	return models.StorageGCOptions{
+		DryRun:      dryRun,
+		TempTTL:     time.Duration(cfg.TempAttachmentTTL) * time.Hour,
+		GracePeriod: storageGCGracePeriod,
+	}
+}
+
+// startStorageGC 按配置的间隔定期清理存储
+func startStorageGC(cfg *config.Config) {
+	if cfg.StorageGCInterval <= 0 {
+		return
+	}
+	interval := time.Duration(cfg.StorageGCInterval) * time.Hour
+
+	go func() {
+		for {
+			// 启动后先等待一段时间，避免与启动时的其他任务争抢资源
+			time.Sleep(interval)
+
+			report, err := models.RunStorageGC(context.Background(), StorageGCOptions(cfg, false))
+			if err != nil {
+				log.Printf("清理存储失败: %v", err)
+				continue
+			}
+			log.Printf("存储清理完成: 过期临时附件 %d 个，孤儿文件 %d 个（%d 字节），丢失文件的记录 %d 个，校正引用计数 %d 个，错误 %d 个",
+				report.ExpiredTemp, report.OrphanFiles, report.OrphanBytes,
+				report.MissingBlobs+report.MissingLegacy+report.MissingThumbnail, report.RefCountFixed, report.Errors)
+			if report.MissingSkipped {
+				log.Printf("文件丢失的记录比例过高，未删除这些记录，请检查存储配置后使用 storage-gc -force 清理")
+			}
+		}
+	}()
+}
@@ -0,0 +1,174 @@
+package jobs
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"cyi-note/backend/models"
+	"cyi-note/backend/utils"
+)
+
+// 导入任务类型
+const (
+	TypeImportEnex   = "import_enex"   // 导入印象笔记/Evernote导出的ENEX文件
+	TypeImportNotion = "import_notion" // 导入Notion导出的Markdown & CSV格式ZIP
+)
+
+// ImportInput 导入任务输入
+type ImportInput struct {
+	Path     string `json:"path"`     // 上传的导入文件，任务结束后删除
+	Filename string `json:"filename"` // 原始文件名
+	DryRun   bool   `json:"dry_run"`  // 只返回将要创建的内容
+}
+
+// 进度的更新间隔，避免频繁写入任务表
+const progressInterval = time.Second
+
+// importStages 导入各阶段的进度范围和说明，解析阶段占 0-10
+var importStages = map[string]struct {
+	start, end int
+	label      string
+}{
+	models.ImportStagePrepare: {10, 50, "检查引用的文件"},
+	models.ImportStageStore:   {50, 80, "写入附件"},
+	models.ImportStageSave:    {80, 100, "创建笔记"},
+}
+
+func init() {
+	Register(TypeImportEnex, &Handler{
+		Run:     runImport,
+		Timeout: 2 * time.Hour,
+		Bulk:    true,
+	})
+	Register(TypeImportNotion, &Handler{
+		Run:     runImport,
+		Timeout: 2 * time.Hour,
+		Bulk:    true,
+	})
+}
+
+// runImport 解析导入文件并导入笔记，结果为导入报告，其中的 issues 记录跳过的文件和内容
+func runImport(ctx context.Context, job *models.Job) (interface{}, error) {
+	var input ImportInput
+	if err := json.Unmarshal([]byte(job.Input), &input); err != nil {
+		return nil, fmt.Errorf("无效的任务参数: %v", err)
+	}
+	defer os.Remove(input.Path)
+
+	// 解码的资源和解压的分卷保存在临时目录中
+	dir, err := os.MkdirTemp("", "import_*")
+	if err != nil {
+		return nil, fmt.Errorf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	models.UpdateJobProgress(job.ID, 0, "解析导入文件")
+	var notes []utils.ImportedNote
+	var issues []utils.ImportIssue
+	switch job.Type {
+	case TypeImportEnex:
+		notes, issues, err = parseEnexFile(input.Path, dir)
+	case TypeImportNotion:
+		// 附件在导入时才从ZIP中读取，导入完成后再关闭
+		var closer io.Closer
+		notes, issues, closer, err = parseNotionFile(input.Path, dir)
+		if closer != nil {
+			defer closer.Close()
+		}
+	default:
+		return nil, ErrUnknownJobType
+	}
+	if errors.Is(err, utils.ErrNothingToImport) {
+		return nil, errors.New("导入文件中没有找到笔记")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	report, attachments, err := models.ImportNotes(job.UserID, notes, issues, models.ImportOptions{
+		DryRun:   input.DryRun,
+		Progress: importProgress(job.ID),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 为导入的附件生成缩略图、提取文本
+	for i := range attachments {
+		AttachmentSaved(&attachments[i])
+	}
+	return report, nil
+}
+
+// parseEnexFile 解析ENEX文件
+func parseEnexFile(path, dir string) ([]utils.ImportedNote, []utils.ImportIssue, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("打开导入文件失败: %v", err)
+	}
+	defer file.Close()
+	return utils.ParseEnex(file, dir)
+}
+
+// parseNotionFile 解析Notion导出的ZIP，导入完成后需要关闭返回的closer
+func parseNotionFile(path, dir string) ([]utils.ImportedNote, []utils.ImportIssue, io.Closer, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, nil, nil, errors.New("无效的ZIP文件")
+	}
+
+	export, err := utils.OpenNotionExport(&zr.Reader, dir, settings.ImportMaxSize*1024*1024)
+	if err != nil {
+		zr.Close()
+		return nil, nil, nil, err
+	}
+
+	notes, issues, err := export.Parse()
+	return notes, issues, closerFunc(func() error {
+		export.Close()
+		return zr.Close()
+	}), err
+}
+
+// closerFunc 将函数作为io.Closer使用
+type closerFunc func() error
+
+// Close 调用函数
+func (f closerFunc) Close() error {
+	return f()
+}
+
+// importProgress 返回将导入各阶段的进度写入任务的函数
+func importProgress(jobID uint) func(stage string, done, total int) {
+	var lastStage string
+	var lastUpdate time.Time
+	return func(stage string, done, total int) {
+		if stage == lastStage && time.Since(lastUpdate) < progressInterval {
+			return
+		}
+		lastStage, lastUpdate = stage, time.Now()
+
+		info := importStages[stage]
+		progress := info.start
+		if total > 0 {
+			progress += (info.end - info.start) * done / total
+		}
+		label := info.label
+		if stage != models.ImportStageSave {
+			label = fmt.Sprintf("%s（%d/%d）", info.label, done, total)
+		}
+		if err := models.UpdateJobProgress(jobID, progress, label); err != nil {
+			log.Printf("更新任务 %d 的进度失败: %v", jobID, err)
+		}
+	}
+}
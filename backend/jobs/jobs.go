@@ -0,0 +1,408 @@
+package jobs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"cyi-note/backend/config"
+	"cyi-note/backend/models"
+	"cyi-note/backend/utils"
+)
+
+// Handler 任务处理器
+type Handler struct {
+	// Run 执行任务，返回可序列化为JSON的结果
+	Run func(ctx context.Context, job *models.Job) (interface{}, error)
+	// Apply 将结果写回业务数据（可选），结果来自缓存时同样会执行
+	Apply func(job *models.Job, result []byte) error
+	// CacheKey 计算结果缓存键（可选），为nil时不缓存结果
+	CacheKey func(job *models.Job) string
+	// UseAIQuota 是否消耗用户每日的AI调用次数
+	UseAIQuota bool
+	// AI 是否为AI任务，同一用户同时执行的AI任务数量受 AI_MAX_CONCURRENT 限制
+	AI bool
+	// Bulk 是否为耗时较长的批量任务（导入、导出、补全），由单独的worker执行，不会占满普通任务的worker
+	Bulk bool
+	// Inline 是否为在请求中同步执行的AI调用（问答、写作助手），不进入队列，通过Begin开始
+	Inline bool
+	// Timeout 单次执行的超时时间，默认5分钟
+	Timeout time.Duration
+}
+
+// ErrUnknownJobType 未注册的任务类型
+var ErrUnknownJobType = errors.New("不支持的任务类型")
+
+var (
+	handlers   = make(map[string]*Handler)
+	settings   *config.Config
+	chatClient *utils.ChatClient
+
+	// wakeup 有新任务入队时唤醒空闲的worker
+	wakeup = make(chan struct{}, 1)
+)
+
+// 空闲时轮询任务表的间隔
+const pollInterval = 2 * time.Second
+
+// 任务因进程退出而中断后最多执行的次数
+const maxJobAttempts = 3
+
+// Register 注册任务处理器，需在Start之前调用
+func Register(jobType string, handler *Handler) {
+	handlers[jobType] = handler
+}
+
+// Start 启动后台任务worker
+func Start(cfg *config.Config) {
+	settings = cfg
+	chatClient = utils.NewChatClient(cfg.AIBaseURL, cfg.AIAPIKey, cfg.AIModel)
+
+	// 恢复上次进程退出时中断的任务
+	if count, err := models.RequeueRunningJobs(inlineJobTypes(), maxJobAttempts); err != nil {
+		log.Printf("恢复中断的任务失败: %v", err)
+	} else if count > 0 {
+		log.Printf("已将 %d 个中断的任务重新放回队列", count)
+	}
+
+	var types, aiTypes, bulkTypes []string
+	for jobType, handler := range handlers {
+		switch {
+		case handler.Bulk:
+			bulkTypes = append(bulkTypes, jobType)
+		case handler.Inline:
+			// 同步调用不由worker执行，只参与AI任务的并发数统计
+			aiTypes = append(aiTypes, jobType)
+		case handler.AI:
+			types = append(types, jobType)
+			aiTypes = append(aiTypes, jobType)
+		default:
+			types = append(types, jobType)
+		}
+	}
+
+	workers := cfg.JobWorkers
+	if workers <= 0 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go worker(types, aiTypes, aiMaxConcurrent())
+	}
+
+	// 批量任务每个用户同时只执行一个，避免一个用户的多个导入占满批量任务的worker
+	bulkWorkers := cfg.BulkJobWorkers
+	if bulkWorkers <= 0 {
+		bulkWorkers = 1
+	}
+	for i := 0; i < bulkWorkers; i++ {
+		go worker(bulkTypes, bulkTypes, 1)
+	}
+	log.Printf("后台任务已启动，worker数量: %d，批量任务worker数量: %d", workers, bulkWorkers)
+
+	// 定期清理存储和过期的导出文件
+	startStorageGC(cfg)
+	startExportCleanup(cfg)
+}
+
+// Enqueue 创建任务并放入队列
+// 结果已缓存时直接完成任务且不消耗AI调用次数
+func Enqueue(userID uint, jobType string, noteID *uint, input interface{}) (*models.Job, error) {
+	handler, ok := handlers[jobType]
+	if !ok || handler.Inline {
+		return nil, ErrUnknownJobType
+	}
+
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &models.Job{
+		UserID: userID,
+		Type:   jobType,
+		NoteID: noteID,
+		Status: models.JobStatusQueued,
+		Input:  string(data),
+	}
+
+	// 命中缓存时直接完成任务
+	if handler.CacheKey != nil {
+		job.ContentHash = handler.CacheKey(job)
+		if cache, err := models.GetAIResultCache(job.ContentHash); err == nil {
+			now := time.Now()
+			job.Status = models.JobStatusDone
+			job.Result = cache.Result
+			job.Output = json.RawMessage(cache.Result)
+			job.Cached = true
+			job.FinishedAt = &now
+
+			if err := models.CreateJob(job); err != nil {
+				return nil, err
+			}
+			if handler.Apply != nil {
+				if err := handler.Apply(job, []byte(cache.Result)); err != nil {
+					models.FailJob(job.ID, err.Error())
+					return nil, err
+				}
+			}
+			return job, nil
+		}
+	}
+
+	if handler.UseAIQuota {
+		if err := ConsumeAIQuota(userID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := models.CreateJob(job); err != nil {
+		// 任务没有创建成功，退还已消耗的次数
+		if handler.UseAIQuota {
+			refundAIQuota(userID)
+		}
+		return nil, err
+	}
+
+	// 唤醒空闲worker，队列已有通知时不阻塞
+	select {
+	case wakeup <- struct{}{}:
+	default:
+	}
+
+	return job, nil
+}
+
+// Begin 开始一次在请求中同步执行的AI调用
+// 消耗AI调用次数并将调用记录为执行中的任务，与队列中的AI任务共用每个用户的并发数限制，
+// 超出限制时返回models.ErrTooManyRunningJobs；调用结束后需调用Finish或Fail
+func Begin(userID uint, jobType string, noteID *uint, input interface{}) (*models.Job, error) {
+	handler, ok := handlers[jobType]
+	if !ok || !handler.Inline {
+		return nil, ErrUnknownJobType
+	}
+
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+
+	if handler.UseAIQuota {
+		if err := ConsumeAIQuota(userID); err != nil {
+			return nil, err
+		}
+	}
+
+	job := &models.Job{
+		UserID: userID,
+		Type:   jobType,
+		NoteID: noteID,
+		Input:  string(data),
+	}
+	if err := models.StartJob(job, aiJobTypes(), aiMaxConcurrent()); err != nil {
+		if handler.UseAIQuota {
+			refundAIQuota(userID)
+		}
+		return nil, err
+	}
+	return job, nil
+}
+
+// Finish 保存同步执行的AI调用的结果
+func Finish(job *models.Job, output interface{}) {
+	result, err := json.Marshal(output)
+	if err != nil {
+		models.FailJob(job.ID, "序列化任务结果失败")
+		return
+	}
+	if err := models.FinishJob(job.ID, string(result), false); err != nil {
+		log.Printf("保存任务 %d 的结果失败: %v", job.ID, err)
+	}
+}
+
+// Fail 标记同步执行的AI调用失败，并退还消耗的AI调用次数
+// err 只写入日志，任务中保存固定的失败原因，避免将模型服务返回的错误展示给用户
+func Fail(job *models.Job, err error) {
+	log.Printf("任务 %d (%s) 执行失败: %v", job.ID, job.Type, err)
+	if failErr := models.FailJob(job.ID, "AI调用失败"); failErr != nil {
+		log.Printf("保存任务 %d 的状态失败: %v", job.ID, failErr)
+	}
+	if handler, ok := handlers[job.Type]; ok && handler.UseAIQuota {
+		refundAIQuota(job.UserID)
+	}
+}
+
+// Wait 等待任务结束，超时后返回任务的当前状态
+func Wait(ctx context.Context, id uint, timeout time.Duration) (*models.Job, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		job, err := models.GetJobByID(id)
+		if err != nil {
+			return nil, err
+		}
+		if job.Status == models.JobStatusDone || job.Status == models.JobStatusFailed || time.Now().After(deadline) {
+			return job, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return job, nil
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+// ConsumeAIQuota 消耗用户一次当天的AI调用次数
+func ConsumeAIQuota(userID uint) error {
+	return models.ConsumeAIQuota(userID, settings.AIDailyQuota)
+}
+
+// refundAIQuota 退还用户一次当天的AI调用次数
+func refundAIQuota(userID uint) {
+	if err := models.RefundAIQuota(userID); err != nil {
+		log.Printf("退还用户 %d 的AI调用次数失败: %v", userID, err)
+	}
+}
+
+// aiMaxConcurrent 每个用户同时执行的AI任务数量上限
+func aiMaxConcurrent() int {
+	if settings.AIMaxConcurrent <= 0 {
+		return 1
+	}
+	return settings.AIMaxConcurrent
+}
+
+// QuotaStatus 用户AI配额使用情况
+type QuotaStatus struct {
+	DailyLimit    int   `json:"daily_limit"`
+	UsedToday     int   `json:"used_today"`
+	Remaining     int   `json:"remaining"`
+	MaxConcurrent int   `json:"max_concurrent"`
+	Running       int64 `json:"running"`
+}
+
+// GetQuotaStatus 获取用户AI配额使用情况
+func GetQuotaStatus(userID uint) (*QuotaStatus, error) {
+	used, err := models.GetAIUsage(userID)
+	if err != nil {
+		return nil, err
+	}
+	running, err := models.CountRunningJobs(userID, aiJobTypes())
+	if err != nil {
+		return nil, err
+	}
+
+	remaining := settings.AIDailyQuota - used
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	return &QuotaStatus{
+		DailyLimit:    settings.AIDailyQuota,
+		UsedToday:     used,
+		Remaining:     remaining,
+		MaxConcurrent: aiMaxConcurrent(),
+		Running:       running,
+	}, nil
+}
+
+// aiJobTypes 所有AI任务类型
+func aiJobTypes() []string {
+	var types []string
+	for jobType, handler := range handlers {
+		if handler.AI {
+			types = append(types, jobType)
+		}
+	}
+	return types
+}
+
+// inlineJobTypes 所有同步执行的AI调用类型
+func inlineJobTypes() []string {
+	var types []string
+	for jobType, handler := range handlers {
+		if handler.Inline {
+			types = append(types, jobType)
+		}
+	}
+	return types
+}
+
+// HashContent 计算内容哈希，用作结果缓存键
+func HashContent(jobType string, parts ...string) string {
+	sum := sha256.Sum256([]byte(jobType + "\x00" + strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// worker 循环领取并执行types中的任务，limitedTypes中的任务每个用户同时最多执行maxPerUser个
+func worker(types, limitedTypes []string, maxPerUser int) {
+	for {
+		job, err := models.ClaimNextJob(types, limitedTypes, maxPerUser)
+		if err != nil {
+			log.Printf("领取任务失败: %v", err)
+		}
+		if job == nil {
+			select {
+			case <-wakeup:
+			case <-time.After(pollInterval):
+			}
+			continue
+		}
+
+		execute(job)
+	}
+}
+
+// execute 执行单个任务并保存结果
+func execute(job *models.Job) {
+	handler := handlers[job.Type]
+
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("任务 %d 执行异常: %v", job.ID, r)
+			models.FailJob(job.ID, fmt.Sprintf("任务执行异常: %v", r))
+		}
+	}()
+
+	timeout := handler.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Minute
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	output, err := handler.Run(ctx, job)
+	if err != nil {
+		log.Printf("任务 %d (%s) 执行失败: %v", job.ID, job.Type, err)
+		models.FailJob(job.ID, err.Error())
+		return
+	}
+
+	result, err := json.Marshal(output)
+	if err != nil {
+		models.FailJob(job.ID, "序列化任务结果失败")
+		return
+	}
+
+	if handler.Apply != nil {
+		if err := handler.Apply(job, result); err != nil {
+			models.FailJob(job.ID, err.Error())
+			return
+		}
+	}
+
+	if handler.CacheKey != nil && job.ContentHash != "" {
+		if err := models.SaveAIResultCache(job.ContentHash, job.Type, string(result)); err != nil {
+			log.Printf("保存任务 %d 的结果缓存失败: %v", job.ID, err)
+		}
+	}
+
+	if err := models.FinishJob(job.ID, string(result), false); err != nil {
+		log.Printf("保存任务 %d 的结果失败: %v", job.ID, err)
+	}
+}
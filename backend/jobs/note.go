@@ -0,0 +1,48 @@
+package jobs
+
+import (
+	"errors"
+	"log"
+	"strings"
+
+	"cyi-note/backend/models"
+	"cyi-note/backend/utils"
+)
+
+// NoteSaved 笔记保存后按用户设置在后台生成摘要和标签建议
+// previousContent为保存前的内容，新建笔记时为空字符串
+func NoteSaved(note *models.Note, previousContent string, created bool) {
+	if strings.TrimSpace(note.Content) == "" {
+		return
+	}
+
+	settings, err := models.GetUserSettings(note.UserID)
+	if err != nil {
+		log.Printf("获取用户 %d 的设置失败: %v", note.UserID, err)
+		return
+	}
+	if !settings.AutoSummary && !settings.AutoTagSuggestions {
+		return
+	}
+
+	changed := created || utils.IsMaterialChange(previousContent, note.Content)
+	noteID := note.ID
+	input := ContentInput{Content: note.Content}
+
+	// 内容有实质变化，或笔记还没有摘要时生成摘要
+	if settings.AutoSummary && (changed || note.Summary == "") {
+		if _, err := Enqueue(note.UserID, TypeSummary, &noteID, input); err != nil {
+			if errors.Is(err, models.ErrAIQuotaExceeded) {
+				log.Printf("用户 %d 的AI调用次数已用完，跳过笔记 %d 的自动摘要", note.UserID, note.ID)
+			} else {
+				log.Printf("创建笔记 %d 的自动摘要任务失败: %v", note.ID, err)
+			}
+		}
+	}
+
+	if settings.AutoTagSuggestions && changed {
+		if _, err := Enqueue(note.UserID, TypeTagSuggestions, &noteID, input); err != nil {
+			log.Printf("创建笔记 %d 的标签建议任务失败: %v", note.ID, err)
+		}
+	}
+}
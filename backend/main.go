@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 	"log"
+	// 内嵌时区数据，资源库按客户端时区分组时不依赖系统时区文件
+	_ "time/tzdata"
 	
 	"github.com/gin-gonic/gin"
 	"github.com/gin-contrib/cors"
@@ -10,7 +12,9 @@ import (
 	"cyi-note/backend/config"
 	"cyi-note/backend/models"
 	"cyi-note/backend/api"
+	"cyi-note/backend/commands"
 	"cyi-note/backend/controllers"
+	"cyi-note/backend/jobs"
 )
 
 func main() {
@@ -25,6 +29,9 @@ func main() {
 		log.Fatalf("无法初始化数据库: %v", err)
 	}
 	
+	// 执行命令行子命令（如 storage-migrate）
+	commands.ExitOnCommand(cfg)
+	
 	// 确保管理员账号存在
 	if err := models.EnsureAdminExists(cfg); err != nil {
 		log.Fatalf("检查管理员账号失败: %v", err)
@@ -33,15 +40,32 @@ func main() {
 	// 初始化附件控制器
 	controllers.InitAttachmentController(cfg)
 	
+	// 初始化断点续传控制器
+	controllers.InitUploadController(cfg)
+	
+	// 初始化导入控制器
+	controllers.InitImportController(cfg)
+	
+	// 初始化AI控制器
+	controllers.InitAIController(cfg)
+	
+	// 启动后台任务
+	jobs.Start(cfg)
+	
 	// 创建Gin引擎
 	r := gin.Default()
 	
 	// 配置CORS
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "Accept", "X-Requested-With"},
-		ExposeHeaders:    []string{"Content-Length", "Content-Type"},
+		AllowMethods:     []string{"GET", "HEAD", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "Accept", "X-Requested-With",
+			"Tus-Resumable", "Upload-Length", "Upload-Offset", "Upload-Metadata", "Upload-Checksum",
+			"Range", "If-Range", "If-None-Match", "If-Modified-Since"},
+		ExposeHeaders: []string{"Content-Length", "Content-Type", "Location",
+			"Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size", "Tus-Checksum-Algorithm",
+			"Upload-Length", "Upload-Offset", "Upload-Metadata", "Upload-Expires", "X-Attachment-Id",
+			"Accept-Ranges", "Content-Range", "Content-Disposition", "ETag", "Last-Modified"},
 		AllowCredentials: false,
 		MaxAge:           86400,
 	}))
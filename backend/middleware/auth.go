@@ -56,6 +56,22 @@ func AuthRequired() gin.HandlerFunc {
 	}
 }
 
+// UserIDFromRequest 从Authorization头解析当前用户ID，不要求必须登录
+// 不接受查询参数中的令牌，避免令牌出现在日志和Referer中；<img>等无法设置请求头的场景使用签名URL
+func UserIDFromRequest(c *gin.Context) (uint, bool) {
+	parts := strings.Split(c.GetHeader("Authorization"), " ")
+	if len(parts) != 2 || parts[0] != "Bearer" || parts[1] == "" {
+		return 0, false
+	}
+	
+	claims, err := ParseToken(parts[1])
+	if err != nil {
+		return 0, false
+	}
+	
+	return claims.UserID, true
+}
+
 // AdminRequired 管理员认证中间件
 func AdminRequired() gin.HandlerFunc {
 	return func(c *gin.Context) {
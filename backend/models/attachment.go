@@ -1,32 +1,48 @@
 package models
 
 import (
-	"database/sql"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 	
 	"gorm.io/gorm"
+	
+	"cyi-note/backend/storage"
+	"cyi-note/backend/utils"
 )
 
 // Attachment 附件模型
 type Attachment struct {
-	ID        uint           `gorm:"primaryKey" json:"id"`
-	NoteID    *uint          `gorm:"index;null" json:"note_id"` // 修改为指针类型，允许为NULL
-	UserID    uint           `gorm:"index;not null;default:1" json:"user_id"` // 为现有记录设置默认值
-	Filename  string         `gorm:"size:255;not null" json:"filename"`
-	Filepath  string         `gorm:"size:255;not null" json:"-"` // 文件存储路径，不返回给前端
-	FileURL   string         `gorm:"-" json:"file_url"`          // 文件访问URL，计算属性，不存储在数据库
-	Filetype  string         `gorm:"size:100" json:"filetype"`
-	Filesize  int64          `json:"filesize"`
-	IsTemp    bool           `gorm:"default:false" json:"is_temp"` // 是否是临时附件
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
-	
+	ID           uint           `gorm:"primaryKey" json:"id"`
+	NoteID       *uint          `gorm:"index;null" json:"note_id"`               // 修改为指针类型，允许为NULL
+	UserID       uint           `gorm:"index;not null;default:1" json:"user_id"` // 为现有记录设置默认值
+	Filename     string         `gorm:"size:255;not null" json:"filename"`
+	Filepath     string         `gorm:"size:255;not null" json:"-"`       // 文件在存储后端中的键，不返回给前端
+	BlobID       *uint          `gorm:"index" json:"-"`                   // 引用的去重文件，早期上传的附件为空
+	OriginalID   *uint          `gorm:"index" json:"-"`                   // 规范化前的原图，仅在用户选择保留原图时存在
+	Hash         string         `gorm:"size:64;index" json:"hash"`        // 文件内容的SHA-256
+	FileURL      string         `gorm:"-" json:"file_url"`                // 文件访问URL，计算属性，不存储在数据库
+	SignedURL    string         `gorm:"-" json:"signed_url"`              // 带签名的短期访问URL，可用于无法携带认证头的场景
+	ThumbnailURL string         `gorm:"-" json:"thumbnail_url,omitempty"` // 图片缩略图的签名URL，非图片附件为空
+	Filetype     string         `gorm:"size:100" json:"filetype"`
+	Filesize     int64          `json:"filesize"`
+	AltText      string         `gorm:"size:500" json:"alt_text"`         // 图片的替代文本，服务端渲染和导出笔记时用作缺省的alt
+	Caption      string         `gorm:"size:1000" json:"caption"`         // 附件的说明文字
+	OriginalSize int64          `gorm:"default:0" json:"-"` // 保留的原图大小，计入用户已使用的空间
+	IsTemp       bool           `gorm:"default:false" json:"is_temp"`    // 是否是临时附件
+	Deduplicated bool           `gorm:"-" json:"deduplicated,omitempty"` // 上传时是否复用了用户自己已上传过的相同文件
+	HasOriginal  bool           `gorm:"-" json:"has_original,omitempty"` // 是否保留了规范化前的原图
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
+
 	// 关联
 	Note Note `gorm:"foreignKey:NoteID" json:"-"`
 	User User `gorm:"foreignKey:UserID" json:"-"`
@@ -34,19 +50,38 @@ type Attachment struct {
 
 // AfterFind 查询后自动设置文件URL
 func (a *Attachment) AfterFind(tx *gorm.DB) error {
+	a.SetURLs()
+	a.HasOriginal = a.OriginalID != nil
+	return nil
+}
+
+// SetURLs 设置文件访问URL和签名URL
+func (a *Attachment) SetURLs() {
 	// 使用ID而不是文件路径构建URL
 	a.FileURL = "/api/attachments/" + fmt.Sprintf("%d", a.ID)
-	return nil
+	a.SignedURL, _ = utils.SignAttachmentURL(a.ID)
+	if utils.IsThumbnailable(a.Filetype) {
+		a.ThumbnailURL = a.SignedURL + "&size=thumb"
+	}
 }
 
-// BeforeDelete 删除前移除文件
-func (a *Attachment) BeforeDelete(tx *gorm.DB) error {
-	// 删除物理文件
-	err := os.Remove(a.Filepath)
-	if err != nil && !os.IsNotExist(err) {
-		return err
+// StorageKey 附件在存储后端中的键
+// 早期版本保存的是以 uploads/ 开头的本地路径，这里统一转换为相对于上传目录的键
+func (a *Attachment) StorageKey() string {
+	key := strings.ReplaceAll(a.Filepath, "\\", "/")
+	return strings.TrimPrefix(key, "uploads/")
+}
+
+// GetOriginal 获取保留的原图，没有原图时返回gorm.ErrRecordNotFound
+func (a *Attachment) GetOriginal() (*Blob, error) {
+	if a.OriginalID == nil {
+		return nil, gorm.ErrRecordNotFound
 	}
-	return nil
+	var blob Blob
+	if err := DB.First(&blob, *a.OriginalID).Error; err != nil {
+		return nil, err
+	}
+	return &blob, nil
 }
 
 // CreateAttachment 创建附件
@@ -61,6 +96,23 @@ func GetAttachmentByID(id uint) (*Attachment, error) {
 	return &attachment, err
 }
 
+// GetAttachmentAltTexts 获取用户附件中设置的替代文本，返回附件ID到替代文本的映射
+// 其他用户的附件和没有替代文本的附件不包含在结果中
+func GetAttachmentAltTexts(userID uint, ids []uint) (map[uint]string, error) {
+	altTexts := make(map[uint]string)
+	if len(ids) == 0 {
+		return altTexts, nil
+	}
+	var attachments []Attachment
+	err := DB.Select("id", "alt_text").
+		Where("id IN ? AND user_id = ? AND alt_text <> ''", ids, userID).
+		Find(&attachments).Error
+	for _, attachment := range attachments {
+		altTexts[attachment.ID] = attachment.AltText
+	}
+	return altTexts, err
+}
+
 // GetAttachmentsByNoteID 获取笔记的所有附件
 func GetAttachmentsByNoteID(noteID uint) ([]Attachment, error) {
 	var attachments []Attachment
@@ -69,277 +121,305 @@ func GetAttachmentsByNoteID(noteID uint) ([]Attachment, error) {
 	return attachments, err
 }
 
+// GetAttachmentsByIDs 获取指定ID的附件，按ID排序
+func GetAttachmentsByIDs(ids []uint) ([]Attachment, error) {
+	var attachments []Attachment
+	err := DB.Where("id IN ?", ids).Order("id ASC").Find(&attachments).Error
+	return attachments, err
+}
+
+// GetAttachmentsInDateRange 获取用户笔记中在[start, end)期间上传的附件，可按文件类型前缀过滤
+func GetAttachmentsInDateRange(userID uint, start, end time.Time, fileType string) ([]Attachment, error) {
+	var attachments []Attachment
+	query := DB.Model(&Attachment{}).
+		Joins("JOIN notes ON notes.id = attachments.note_id").
+		Where("notes.user_id = ? AND attachments.note_id IS NOT NULL", userID).
+		Where("attachments.created_at >= ? AND attachments.created_at < ?", start, end)
+	if fileType != "" {
+		query = query.Where("attachments.filetype LIKE ?", fileType+"%")
+	}
+	err := query.Order("attachments.created_at ASC").Find(&attachments).Error
+	return attachments, err
+}
+
+// imageOptions 上传图片的规范化参数
+var imageOptions = utils.ImageOptions{MaxDimension: 4096, JPEGQuality: 85}
+
+// SetImageOptions 设置上传图片的规范化参数
+func SetImageOptions(options utils.ImageOptions) {
+	imageOptions = options
+}
+
+// uploadPolicy 上传文件的类型和大小限制
+var uploadPolicy utils.UploadPolicy
+
+// SetUploadPolicy 设置上传文件的类型和大小限制
+func SetUploadPolicy(policy utils.UploadPolicy) {
+	uploadPolicy = policy
+}
+
 // SaveFile 保存文件并创建附件记录
-func SaveFile(file *os.File, filename string, noteID uint, fileType string, userID uint, isTemp bool) (*Attachment, error) {
-	// 创建上传目录
-	var uploadDir string
-	if isTemp {
-		// 临时文件保存在临时目录
-		uploadDir = filepath.Join("uploads", "temp", fmt.Sprintf("%d", userID))
-	} else {
-		// 普通附件保存在uploads目录
-		uploadDir = filepath.Join("uploads", fmt.Sprintf("%d", userID))
+// 文件类型根据内容检测，不信任客户端提供的类型，不符合上传限制时返回
+// utils.ErrFileTypeNotAllowed 或 utils.ErrFileTooLarge；
+// 文件按内容SHA-256去重存储，相同内容只保存一份；
+// 图片会先去除EXIF等元数据、按方向旋转并重新压缩，用户开启保留原图时另存一份原图；
+// 无法解码的图片只去除元数据，文件结构损坏时返回 utils.ErrInvalidImage
+func SaveFile(file *os.File, filename string, noteID uint, userID uint, isTemp bool) (*Attachment, error) {
+	fileType, filename, size, err := checkFile(file, filename)
+	if err != nil {
+		return nil, err
 	}
 	
-	// 确保目录存在
-	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		return nil, fmt.Errorf("创建目录失败: %v", err)
+	// 提前检查配额，避免写入注定无法保存的文件；创建记录时还会在事务中再次检查
+	if err := CheckStorageQuota(userID, size); err != nil {
+		return nil, err
 	}
 	
-	// 生成文件路径
-	timestamp := time.Now().UnixNano()
-	randomSuffix := fmt.Sprintf("%x", timestamp)[:8] // 使用时间戳的前8位十六进制作为随机后缀
-	fileExt := filepath.Ext(filename)
-	if fileExt == "" {
-		// 如果没有扩展名，尝试从Content-Type推断
-		fileExt = getExtensionFromContentType(fileType)
+	stored, err := storeFile(file, fileType, filename, userID)
+	if err != nil {
+		return nil, err
 	}
 	
-	// 安全化文件名，只保留基本部分
-	safeName := fmt.Sprintf("%d_%d_%s%s", 
-		userID, timestamp, randomSuffix, fileExt)
-	newFilepath := filepath.Join(uploadDir, safeName)
-	
-	// 创建目标文件
-	dst, err := os.Create(newFilepath)
+	attachment, err := createAttachmentForBlob(stored.Blob, stored.Filename, noteID, stored.FileType, userID, isTemp, stored.Original)
 	if err != nil {
-		return nil, fmt.Errorf("创建目标文件失败: %v", err)
+		stored.release()
+		return nil, err
 	}
-	defer dst.Close()
-	
-	// 复制文件内容
-	if _, err = io.Copy(dst, file); err != nil {
-		// 如果复制失败，删除已创建的文件
-		os.Remove(newFilepath)
-		return nil, fmt.Errorf("复制文件内容失败: %v", err)
+	attachment.Deduplicated = stored.Deduplicated
+	return attachment, nil
+}
+
+// checkFile 根据内容检测文件类型并检查上传限制，返回文件类型、与类型一致的文件名和文件大小
+func checkFile(file *os.File, filename string) (string, string, int64, error) {
+	fileType, filename, err := utils.DetectContentType(file, filename)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("读取文件失败: %v", err)
 	}
-	
-	// 获取文件信息，包括大小
-	fileInfo, err := os.Stat(newFilepath)
+	info, err := file.Stat()
 	if err != nil {
-		os.Remove(newFilepath)
-		return nil, fmt.Errorf("获取文件信息失败: %v", err)
+		return "", "", 0, fmt.Errorf("读取文件失败: %v", err)
 	}
-	
-	// 创建附件记录
-	attachment := &Attachment{
-		UserID:   userID,
-		Filename: filename,
-		Filepath: newFilepath,
-		Filetype: fileType,
-		Filesize: fileInfo.Size(),
-		IsTemp:   isTemp,
+	if err := uploadPolicy.Check(fileType, info.Size()); err != nil {
+		return "", "", 0, err
 	}
-	
-	// 只有在非临时附件且提供了noteID的情况下，才设置NoteID
-	if !isTemp && noteID > 0 {
-		attachment.NoteID = &noteID
+	return fileType, filename, info.Size(), nil
+}
+
+// storedFile 已写入存储后端、尚未创建附件记录的文件
+type storedFile struct {
+	Blob     *Blob
+	Original *Blob // 保留的原图，可为nil
+	FileType string
+	Filename string
+	// 用户自己已上传过相同内容，其他用户上传过的内容不算，避免泄露其他用户的文件
+	Deduplicated bool
+}
+
+// release 释放文件持有的Blob引用，创建附件记录失败时调用
+func (f *storedFile) release() {
+	ReleaseBlob(f.Blob.ID)
+	if f.Original != nil {
+		ReleaseBlob(f.Original.ID)
 	}
+}
+
+// storeFile 将已通过检查的文件写入存储后端并获取Blob引用
+// 图片会先去除EXIF等元数据、按方向旋转并重新压缩，用户开启保留原图时另存一份原图
+func storeFile(file *os.File, fileType, filename string, userID uint) (*storedFile, error) {
+	var content io.ReadSeeker = file
+	stored := &storedFile{FileType: fileType, Filename: filename}
 	
-	if err := DB.Create(attachment).Error; err != nil {
-		// 如果创建失败，删除已创建的文件
-		os.Remove(newFilepath)
-		return nil, fmt.Errorf("创建附件记录失败: %v", err)
+	if utils.IsNormalizable(fileType) {
+		normalized, err := utils.NormalizeImage(file, fileType, imageOptions)
+		if _, seekErr := file.Seek(0, io.SeekStart); seekErr != nil {
+			return nil, fmt.Errorf("读取文件失败: %v", seekErr)
+		}
+		
+		if err != nil {
+			// 无法解码的图片不重新编码，只去除其中的EXIF等元数据，避免保存GPS位置
+			log.Printf("规范化图片 %s 失败，去除元数据后保存: %v", filename, err)
+			data, readErr := io.ReadAll(file)
+			if readErr != nil {
+				return nil, fmt.Errorf("读取文件失败: %v", readErr)
+			}
+			stripped, stripErr := utils.StripImageMetadata(data, fileType)
+			if stripErr != nil {
+				return nil, fmt.Errorf("%w: %s", utils.ErrInvalidImage, filename)
+			}
+			content = bytes.NewReader(stripped)
+		} else {
+			if keepOriginal(userID) {
+				if stored.Original, err = acquireContent(file, fileType); err != nil {
+					return nil, fmt.Errorf("保存原图失败: %v", err)
+				}
+			}
+			
+			content = bytes.NewReader(normalized.Data)
+			if normalized.ContentType != fileType {
+				stored.Filename = strings.TrimSuffix(filename, filepath.Ext(filename)) + imageExtension(normalized.ContentType)
+				stored.FileType = normalized.ContentType
+			}
+		}
 	}
 	
-	return attachment, nil
+	hash, size, err := HashFile(content)
+	if err == nil {
+		_, userErr := GetUserBlobByHash(userID, hash)
+		stored.Deduplicated = userErr == nil
+		stored.Blob, err = AcquireBlob(hash, size, stored.FileType, content)
+	}
+	if err != nil {
+		if stored.Original != nil {
+			ReleaseBlob(stored.Original.ID)
+		}
+		return nil, fmt.Errorf("保存文件失败: %v", err)
+	}
+	return stored, nil
 }
 
-// getExtensionFromContentType 根据Content-Type猜测文件扩展名
-func getExtensionFromContentType(contentType string) string {
-	switch contentType {
-	case "image/jpeg", "image/jpg":
-		return ".jpg"
-	case "image/png":
-		return ".png"
-	case "image/gif":
-		return ".gif"
-	case "image/webp":
-		return ".webp"
-	case "application/pdf":
-		return ".pdf"
-	case "text/plain":
-		return ".txt"
-	case "text/markdown":
-		return ".md"
-	case "application/json":
-		return ".json"
-	default:
-		return ""
+// acquireContent 计算内容哈希并获取对应的Blob引用
+func acquireContent(content io.ReadSeeker, contentType string) (*Blob, error) {
+	hash, size, err := HashFile(content)
+	if err != nil {
+		return nil, err
 	}
+	return AcquireBlob(hash, size, contentType, content)
 }
 
-// DeleteAttachment 删除附件
-func DeleteAttachment(id uint) error {
-	return DB.Delete(&Attachment{}, id).Error
+// keepOriginal 检查用户是否选择保留规范化前的原图
+func keepOriginal(userID uint) bool {
+	settings, err := GetUserSettings(userID)
+	return err == nil && settings.KeepOriginalImages
 }
 
-// DateGroup 日期分组结构
-type DateGroup struct {
-	Date        string `json:"date"`
-	Count       int    `json:"count"`
-	DisplayDate string `json:"displayDate"`
+// imageExtension 图片类型对应的文件扩展名
+func imageExtension(contentType string) string {
+	if contentType == "image/png" {
+		return ".png"
+	}
+	return ".jpg"
 }
 
-// GetAttachmentsByDate 按日期分组获取附件
-func GetAttachmentsByDate(userID uint, page, pageSize int, fileType string) ([]Attachment, []DateGroup, int64, error) {
-	var attachments []Attachment
-	var total int64
-	
-	// 基础查询：获取属于用户的所有附件
-	query := DB.Model(&Attachment{}).
-		Joins("JOIN notes ON notes.id = attachments.note_id").
-		Where("notes.user_id = ? AND attachments.note_id IS NOT NULL", userID)
-	
-	// 应用文件类型过滤（如果有）
-	if fileType != "" {
-		query = query.Where("attachments.filetype LIKE ?", fileType+"%")
+// CreateAttachmentFromHash 使用用户已上传过的文件创建附件，无需再次上传内容
+// 文件类型沿用首次上传时检测到的类型；文件不存在时返回gorm.ErrRecordNotFound
+func CreateAttachmentFromHash(hash, filename string, noteID uint, userID uint, isTemp bool) (*Attachment, error) {
+	existing, err := GetUserBlobByHash(userID, hash)
+	if err != nil {
+		return nil, err
 	}
-	
-	// 获取总数
-	if err := query.Count(&total).Error; err != nil {
-		return nil, nil, 0, err
+	if err := uploadPolicy.Check(existing.ContentType, existing.Size); err != nil {
+		return nil, err
 	}
 	
-	// 获取分页数据
-	if err := query.
-		Order("attachments.created_at DESC").
-		Limit(pageSize).
-		Offset((page - 1) * pageSize).
-		Find(&attachments).Error; err != nil {
-		return nil, nil, 0, err
+	blob, err := RetainBlob(hash)
+	if err != nil {
+		return nil, err
 	}
 	
-	// 查询日期分组数据
-	var dateGroups []DateGroup
-	var rows *sql.Rows
-	var err error
-	
-	// 检查数据库类型，根据不同类型使用不同的SQL语法
-	dbType := DB.Dialector.Name()
-	
-	// 构建日期查询
-	var dateQuery string
-	params := []interface{}{userID}
-	
-	if dbType == "sqlite" {
-		// SQLite 日期函数
-		dateQuery = `
-			SELECT 
-				strftime('%Y-%m-%d', attachments.created_at) as date,
-				COUNT(attachments.id) as count
-			FROM attachments
-			JOIN notes ON notes.id = attachments.note_id
-			WHERE notes.user_id = ? AND attachments.deleted_at IS NULL
-                AND attachments.note_id IS NOT NULL
-		`
-	} else if dbType == "mysql" || dbType == "postgres" {
-		// MySQL/PostgreSQL 日期函数
-		dateQuery = `
-			SELECT 
-				DATE(attachments.created_at) as date,
-				COUNT(attachments.id) as count
-			FROM attachments
-			JOIN notes ON notes.id = attachments.note_id
-			WHERE notes.user_id = ? AND attachments.deleted_at IS NULL
-                AND attachments.note_id IS NOT NULL
-		`
-	} else {
-		// 兜底方案：直接返回时间戳，后续处理
-		dateQuery = `
-			SELECT 
-				cast(attachments.created_at as text) as date,
-				COUNT(attachments.id) as count
-			FROM attachments
-			JOIN notes ON notes.id = attachments.note_id
-			WHERE notes.user_id = ? AND attachments.deleted_at IS NULL
-                AND attachments.note_id IS NOT NULL
-		`
+	attachment, err := createAttachmentForBlob(blob, filename, noteID, blob.ContentType, userID, isTemp, nil)
+	if err != nil {
+		ReleaseBlob(blob.ID)
+		return nil, err
 	}
+	attachment.Deduplicated = true
+	return attachment, nil
+}
+
+// createAttachmentForBlob 创建引用Blob的附件记录，调用方需已持有Blob及原图（可为nil）的引用
+func createAttachmentForBlob(blob *Blob, filename string, noteID uint, fileType string, userID uint, isTemp bool, original *Blob) (*Attachment, error) {
+	attachment := newAttachmentForBlob(blob, filename, noteID, fileType, userID, isTemp, original)
 	
-	if fileType != "" {
-		dateQuery += " AND attachments.filetype LIKE ?"
-		params = append(params, fileType+"%")
+	// 计入已使用空间与创建记录在同一事务中完成
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		return insertAttachment(tx, attachment)
+	})
+	if errors.Is(err, ErrStorageQuotaExceeded) {
+		return nil, err
 	}
+	if err != nil {
+		return nil, fmt.Errorf("创建附件记录失败: %v", err)
+	}
+	attachment.SetURLs()
 	
-	// 分组和排序
-	if dbType == "sqlite" {
-		dateQuery += " GROUP BY strftime('%Y-%m-%d', attachments.created_at) ORDER BY date DESC"
-	} else if dbType == "mysql" || dbType == "postgres" {
-		dateQuery += " GROUP BY DATE(attachments.created_at) ORDER BY date DESC"
-	} else {
-		dateQuery += " GROUP BY cast(attachments.created_at as text) ORDER BY date DESC"
+	return attachment, nil
+}
+
+// newAttachmentForBlob 构造引用Blob的附件，不保存到数据库
+func newAttachmentForBlob(blob *Blob, filename string, noteID uint, fileType string, userID uint, isTemp bool, original *Blob) *Attachment {
+	attachment := &Attachment{
+		UserID:   userID,
+		Filename: filename,
+		Filepath: blob.StorageKey,
+		BlobID:   &blob.ID,
+		Hash:     blob.Hash,
+		Filetype: fileType,
+		Filesize: blob.Size,
+		IsTemp:   isTemp,
+	}
+	if original != nil {
+		attachment.OriginalID = &original.ID
+		attachment.OriginalSize = original.Size
+		attachment.HasOriginal = true
 	}
 	
-	// 执行查询
-	rows, err = DB.Raw(dateQuery, params...).Rows()
+	// 只有在非临时附件且提供了noteID的情况下，才设置NoteID
+	if !isTemp && noteID > 0 {
+		attachment.NoteID = &noteID
+	}
+	return attachment
+}
+
+// insertAttachment 在事务中计入已使用空间并创建附件记录，超出配额时返回ErrStorageQuotaExceeded
+func insertAttachment(tx *gorm.DB, attachment *Attachment) error {
+	if err := reserveStorage(tx, attachment.UserID, attachment.StorageSize()); err != nil {
+		return err
+	}
+	return tx.Create(attachment).Error
+}
+
+// DeleteAttachment 删除附件记录及存储后端中的文件
+func DeleteAttachment(id uint) error {
+	attachment, err := GetAttachmentByID(id)
 	if err != nil {
-		return nil, nil, 0, err
+		return err
 	}
-	defer rows.Close()
 	
-	for rows.Next() {
-		var group DateGroup
-		var date string
-		var count int
-		
-		if err := rows.Scan(&date, &count); err != nil {
-			continue
-		}
-		
-		// 标准化日期格式
-		// 如果返回的是完整日期时间，提取日期部分
-		if len(date) > 10 && strings.Contains(date, "T") {
-			date = strings.Split(date, "T")[0]
-		} else if len(date) > 10 {
-			// 如果是其他格式的日期时间，只保留前10个字符（YYYY-MM-DD）
-			date = date[:10]
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&Attachment{}, id).Error; err != nil {
+			return err
 		}
-		
-		// 尝试解析日期
-		t, err := time.Parse("2006-01-02", date)
-		if err != nil {
-			// 尝试解析其他可能的日期格式
-			formats := []string{"2006-01-02", "01/02/2006", "02-01-2006"}
-			for _, format := range formats {
-				t, err = time.Parse(format, date)
-				if err == nil {
-					break
-				}
-			}
-			
-			// 如果还是无法解析，使用当前日期
-			if err != nil {
-				t = time.Now()
-				date = t.Format("2006-01-02")
-			}
+		if err := deleteAttachmentTexts(tx, id); err != nil {
+			return err
 		}
-		
-		group.Date = date
-		group.Count = count
-		group.DisplayDate = formatDisplayDate(t)
-		
-		dateGroups = append(dateGroups, group)
+		return releaseStorage(tx, attachment.UserID, attachment.StorageSize())
+	})
+	if err != nil {
+		return err
 	}
 	
-	return attachments, dateGroups, total, nil
+	return releaseAttachmentFile(attachment)
 }
 
-// formatDisplayDate 格式化显示日期
-func formatDisplayDate(t time.Time) string {
-	now := time.Now()
-	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
-	yesterday := today.AddDate(0, 0, -1)
-	
-	if t.Year() == today.Year() && t.Month() == today.Month() && t.Day() == today.Day() {
-		return "今天"
-	} else if t.Year() == yesterday.Year() && t.Month() == yesterday.Month() && t.Day() == yesterday.Day() {
-		return "昨天"
-	} else if t.Year() == now.Year() {
-		return t.Format("01月02日")
+// StorageSize 附件占用的空间，包括保留的原图
+func (a *Attachment) StorageSize() int64 {
+	return a.Filesize + a.OriginalSize
+}
+
+// releaseAttachmentFile 释放附件引用的文件及保留的原图
+// 去重存储的文件在最后一个引用释放时才会删除，早期上传的附件直接删除文件
+func releaseAttachmentFile(attachment *Attachment) error {
+	if attachment.OriginalID != nil {
+		if err := ReleaseBlob(*attachment.OriginalID); err != nil {
+			return err
+		}
 	}
-	
-	return t.Format("2006年01月02日")
+	if attachment.BlobID != nil {
+		return ReleaseBlob(*attachment.BlobID)
+	}
+	if err := storage.Current().Delete(context.Background(), attachment.StorageKey()); err != nil {
+		return err
+	}
+	return releaseLegacyThumbnails(attachment.Hash)
 }
 
 // UpdateAttachment 更新附件
@@ -0,0 +1,252 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+
+	"cyi-note/backend/storage"
+	"cyi-note/backend/utils"
+)
+
+// maxAttachmentTextLength 每个附件最多保存的文本长度（字节）
+const maxAttachmentTextLength = 1024 * 1024
+
+// AttachmentText 从附件中提取的文本，用于搜索
+type AttachmentText struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	AttachmentID uint      `gorm:"uniqueIndex;not null" json:"attachment_id"`
+	Content      string    `gorm:"size:1048576" json:"content"`
+	Truncated    bool      `gorm:"default:false" json:"truncated"` // 文本超过长度限制被截断
+	Error        string    `gorm:"size:500" json:"error,omitempty"` // 提取失败的原因，失败的附件不会被重复处理
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// textExtractMaxSize 提取文本的附件的最大大小（字节），0表示不限制
+var textExtractMaxSize int64 = 50 * 1024 * 1024
+
+// SetTextExtractMaxSize 设置提取文本的附件的最大大小
+func SetTextExtractMaxSize(size int64) {
+	textExtractMaxSize = size
+}
+
+// GetAttachmentText 获取附件提取的文本
+func GetAttachmentText(attachmentID uint) (*AttachmentText, error) {
+	var text AttachmentText
+	err := DB.Where("attachment_id = ?", attachmentID).First(&text).Error
+	return &text, err
+}
+
+// ExtractAttachmentText 提取附件中的文本并保存，已提取过的附件会重新提取
+// 内容相同的文件已提取过时直接复用其文本；提取失败时保存失败原因并返回错误
+func ExtractAttachmentText(attachment *Attachment) (*AttachmentText, error) {
+	if !utils.IsTextExtractable(attachment.Filetype) {
+		return nil, utils.ErrTextNotExtractable
+	}
+
+	text := &AttachmentText{AttachmentID: attachment.ID}
+	if existing, err := findTextByHash(attachment.Hash); err == nil {
+		text.Content = existing.Content
+		text.Truncated = existing.Truncated
+	} else if err := extractText(attachment, text); err != nil {
+		text.Error = truncateRunes(err.Error(), 500)
+		if saveErr := saveAttachmentText(text); saveErr != nil {
+			return nil, saveErr
+		}
+		return nil, err
+	}
+
+	if err := saveAttachmentText(text); err != nil {
+		return nil, err
+	}
+	return text, nil
+}
+
+// findTextByHash 查找内容相同的附件已成功提取的文本
+func findTextByHash(hash string) (*AttachmentText, error) {
+	if hash == "" {
+		return nil, gorm.ErrRecordNotFound
+	}
+	var text AttachmentText
+	err := DB.Joins("JOIN attachments ON attachments.id = attachment_texts.attachment_id").
+		Where("attachments.hash = ? AND attachments.deleted_at IS NULL AND attachment_texts.error = ?", hash, "").
+		First(&text).Error
+	return &text, err
+}
+
+// extractText 将附件下载到临时文件后提取文本
+func extractText(attachment *Attachment, text *AttachmentText) error {
+	if textExtractMaxSize > 0 && attachment.Filesize > textExtractMaxSize {
+		return fmt.Errorf("文件超过 %d MB，不提取文本", textExtractMaxSize/1024/1024)
+	}
+
+	reader, err := storage.Current().Get(context.Background(), attachment.StorageKey())
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	// PDF和OOXML文档需要随机访问，先写入临时文件
+	tmp, err := os.CreateTemp("", "cyi-note-extract-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, reader)
+	if err != nil {
+		return err
+	}
+
+	content, truncated, err := utils.ExtractText(tmp, size, attachment.Filetype, maxAttachmentTextLength)
+	if err != nil {
+		return err
+	}
+	text.Content = content
+	text.Truncated = truncated
+	return nil
+}
+
+// saveAttachmentText 保存提取的文本，替换附件已有的记录
+func saveAttachmentText(text *AttachmentText) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("attachment_id = ?", text.AttachmentID).Delete(&AttachmentText{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(text).Error
+	})
+}
+
+// deleteAttachmentTexts 在事务中删除附件提取的文本
+func deleteAttachmentTexts(tx *gorm.DB, attachmentIDs ...uint) error {
+	if len(attachmentIDs) == 0 {
+		return nil
+	}
+	return tx.Where("attachment_id IN ?", attachmentIDs).Delete(&AttachmentText{}).Error
+}
+
+// GetAttachmentsWithoutText 分批获取尚未提取文本的附件，用于补全已有附件的文本
+func GetAttachmentsWithoutText(afterID uint, limit int) ([]Attachment, error) {
+	var attachments []Attachment
+	err := DB.Where("attachments.id > ?", afterID).
+		Where("NOT EXISTS (SELECT 1 FROM attachment_texts WHERE attachment_texts.attachment_id = attachments.id)").
+		Order("attachments.id ASC").Limit(limit).Find(&attachments).Error
+	return attachments, err
+}
+
+// AttachmentMatch 搜索关键词在附件中的匹配
+type AttachmentMatch struct {
+	AttachmentID uint   `json:"attachment_id"`
+	Filename     string `json:"filename"`
+	Field        string `json:"field"`   // 匹配的内容：caption、alt_text 或 content（提取的文本）
+	Snippet      string `json:"snippet"` // 匹配位置附近的文本
+}
+
+// notesWithMatchingAttachments 附件的说明文字、替代文本或提取的文本包含关键词的笔记ID子查询
+func notesWithMatchingAttachments(keyword string) *gorm.DB {
+	like := "%" + keyword + "%"
+	return DB.Table("attachments").Select("attachments.note_id").
+		Joins("LEFT JOIN attachment_texts ON attachment_texts.attachment_id = attachments.id").
+		Where("attachments.deleted_at IS NULL AND attachments.note_id IS NOT NULL").
+		Where("attachments.caption LIKE ? OR attachments.alt_text LIKE ? OR attachment_texts.content LIKE ?", like, like, like)
+}
+
+// setAttachmentMatches 为搜索结果中的笔记设置匹配关键词的附件
+func setAttachmentMatches(notes []Note, keyword string) error {
+	if len(notes) == 0 {
+		return nil
+	}
+	noteIDs := make([]uint, len(notes))
+	for i := range notes {
+		noteIDs[i] = notes[i].ID
+	}
+
+	var rows []struct {
+		NoteID       uint
+		AttachmentID uint
+		Filename     string
+		Caption      string
+		AltText      string
+		Content      string
+	}
+	like := "%" + keyword + "%"
+	err := DB.Table("attachments").
+		Select("attachments.note_id, attachments.id AS attachment_id, attachments.filename, attachments.caption, attachments.alt_text, COALESCE(attachment_texts.content, '') AS content").
+		Joins("LEFT JOIN attachment_texts ON attachment_texts.attachment_id = attachments.id").
+		Where("attachments.deleted_at IS NULL AND attachments.note_id IN ?", noteIDs).
+		Where("attachments.caption LIKE ? OR attachments.alt_text LIKE ? OR attachment_texts.content LIKE ?", like, like, like).
+		Order("attachments.id ASC").
+		Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+
+	matches := make(map[uint][]AttachmentMatch)
+	for _, row := range rows {
+		// 优先显示说明文字和替代文本中的匹配
+		field, text := "content", row.Content
+		if containsFold(row.Caption, keyword) {
+			field, text = "caption", row.Caption
+		} else if containsFold(row.AltText, keyword) {
+			field, text = "alt_text", row.AltText
+		}
+		matches[row.NoteID] = append(matches[row.NoteID], AttachmentMatch{
+			AttachmentID: row.AttachmentID,
+			Filename:     row.Filename,
+			Field:        field,
+			Snippet:      textSnippet(text, keyword, 60),
+		})
+	}
+	for i := range notes {
+		notes[i].MatchedAttachments = matches[notes[i].ID]
+	}
+	return nil
+}
+
+// textSnippet 截取关键词前后各radius个字符的文本，不区分大小写
+func textSnippet(content, keyword string, radius int) string {
+	index := -1
+	if lower := strings.ToLower(content); len(lower) == len(content) {
+		index = strings.Index(lower, strings.ToLower(keyword))
+	}
+	if index < 0 {
+		// 转换大小写后长度变化时位置不可靠，按原文查找
+		index = strings.Index(content, keyword)
+	}
+	if index < 0 {
+		index = 0
+	}
+
+	before := []rune(content[:index])
+	after := []rune(content[index:])
+	start := len(before) - radius
+	if start < 0 {
+		start = 0
+	}
+	end := utf8.RuneCountInString(keyword) + radius
+	if end > len(after) {
+		end = len(after)
+	}
+
+	snippet := strings.ReplaceAll(string(before[start:])+string(after[:end]), "\n", " ")
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(after) {
+		snippet += "…"
+	}
+	return snippet
+}
+
+// containsFold 不区分大小写检查text是否包含keyword
+func containsFold(text, keyword string) bool {
+	return strings.Contains(strings.ToLower(text), strings.ToLower(keyword))
+}
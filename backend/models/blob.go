@@ -0,0 +1,183 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash/fnv"
+	"io"
+	"regexp"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"cyi-note/backend/storage"
+)
+
+// Blob 按内容SHA-256去重存储的文件，多个附件可以引用同一个Blob
+type Blob struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Hash        string    `gorm:"size:64;uniqueIndex;not null" json:"hash"` // 内容的SHA-256（十六进制小写）
+	StorageKey  string    `gorm:"size:255;not null" json:"-"`              // 在存储后端中的键
+	Size        int64     `gorm:"not null" json:"size"`
+	ContentType string    `gorm:"size:100" json:"content_type"`
+	RefCount    int       `gorm:"not null;default:0" json:"ref_count"` // 引用该文件的附件数量
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// blobHashPattern SHA-256十六进制格式
+var blobHashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// blobLocks 按哈希分段的锁，保证同一内容的引用计数变更与文件写入、删除不会交错
+var blobLocks [64]sync.Mutex
+
+func lockBlob(hash string) func() {
+	h := fnv.New32a()
+	h.Write([]byte(hash))
+	lock := &blobLocks[h.Sum32()%uint32(len(blobLocks))]
+	lock.Lock()
+	return lock.Unlock
+}
+
+// IsValidBlobHash 检查是否为合法的SHA-256十六进制字符串
+func IsValidBlobHash(hash string) bool {
+	return blobHashPattern.MatchString(hash)
+}
+
+// blobStorageKey 根据哈希生成存储键，按前两级目录分散文件
+func blobStorageKey(hash string) string {
+	return "blobs/" + hash[:2] + "/" + hash[2:4] + "/" + hash
+}
+
+// HashFile 计算文件内容的SHA-256，计算后将读取位置恢复到文件开头
+func HashFile(file io.ReadSeeker) (string, int64, error) {
+	h := sha256.New()
+	size, err := io.Copy(h, file)
+	if err != nil {
+		return "", 0, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+// GetBlobByHash 通过哈希获取Blob
+func GetBlobByHash(hash string) (*Blob, error) {
+	var blob Blob
+	err := DB.Where("hash = ?", hash).First(&blob).Error
+	if err != nil {
+		return nil, err
+	}
+	return &blob, nil
+}
+
+// GetUserBlobByHash 获取用户已上传过的Blob
+// 只返回该用户自己的附件引用的文件，避免通过哈希探测其他用户的文件
+func GetUserBlobByHash(userID uint, hash string) (*Blob, error) {
+	var blob Blob
+	err := DB.Model(&Blob{}).
+		Joins("JOIN attachments ON attachments.blob_id = blobs.id AND attachments.deleted_at IS NULL").
+		Where("attachments.user_id = ? AND blobs.hash = ? AND blobs.ref_count > 0", userID, hash).
+		First(&blob).Error
+	if err != nil {
+		return nil, err
+	}
+	return &blob, nil
+}
+
+// AcquireBlob 为内容获取一个Blob引用
+// 已存在相同内容时只增加引用计数，否则将内容写入存储后端并创建Blob
+func AcquireBlob(hash string, size int64, contentType string, content io.Reader) (*Blob, error) {
+	unlock := lockBlob(hash)
+	defer unlock()
+
+	blob, err := retainBlob(hash)
+	if err == nil {
+		return blob, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	// 写入新文件
+	key := blobStorageKey(hash)
+	if err := storage.Current().Put(context.Background(), key, content, size, contentType); err != nil {
+		return nil, err
+	}
+
+	blob = &Blob{
+		Hash:        hash,
+		StorageKey:  key,
+		Size:        size,
+		ContentType: contentType,
+		RefCount:    1,
+	}
+	if err := DB.Create(blob).Error; err != nil {
+		// 其他进程可能同时创建了相同内容的Blob
+		if existing, retainErr := retainBlob(hash); retainErr == nil {
+			return existing, nil
+		}
+		return nil, err
+	}
+	return blob, nil
+}
+
+// RetainBlob 为已存在的Blob增加一个引用
+func RetainBlob(hash string) (*Blob, error) {
+	unlock := lockBlob(hash)
+	defer unlock()
+
+	return retainBlob(hash)
+}
+
+// retainBlob 增加引用计数，Blob不存在或已无引用时返回gorm.ErrRecordNotFound
+func retainBlob(hash string) (*Blob, error) {
+	result := DB.Model(&Blob{}).
+		Where("hash = ? AND ref_count > 0", hash).
+		Update("ref_count", gorm.Expr("ref_count + 1"))
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return GetBlobByHash(hash)
+}
+
+// ReleaseBlob 释放一个Blob引用，最后一个引用释放时删除记录、存储后端中的文件及其缩略图
+func ReleaseBlob(id uint) error {
+	var blob Blob
+	if err := DB.First(&blob, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	unlock := lockBlob(blob.Hash)
+	defer unlock()
+
+	if err := DB.Model(&Blob{}).
+		Where("id = ? AND ref_count > 0", id).
+		Update("ref_count", gorm.Expr("ref_count - 1")).Error; err != nil {
+		return err
+	}
+
+	// 条件删除，只有引用计数为0时才会删除
+	result := DB.Where("id = ? AND ref_count <= 0", id).Delete(&Blob{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+
+	if err := storage.Current().Delete(context.Background(), blob.StorageKey); err != nil {
+		return err
+	}
+	return deleteThumbnails(blob.Hash)
+}
@@ -59,20 +59,24 @@ func InitDB(cfg config.DatabaseConfig) error {
 		log.Println("暂时禁用外键检查，以便进行迁移")
 	}
 	
-	// 强制删除attachments表并重新创建
-	log.Println("正在强制同步数据库表结构...")
-	if err := db.Migrator().DropTable(&Attachment{}); err != nil {
-		log.Printf("警告：删除附件表失败: %v", err)
-	} else {
-		log.Println("成功删除附件表，将重新创建")
-	}
-	
 	// 自动迁移数据库表结构
 	err = db.AutoMigrate(
 		&User{},
 		&Note{},
 		&Tag{},
 		&Attachment{},
+		&Blob{},
+		&Thumbnail{},
+		&AttachmentText{},
+		&AttachmentReference{},
+		&Upload{},
+		&Job{},
+		&AIUsage{},
+		&AIResultCache{},
+		&UserSettings{},
+		&TagSuggestion{},
+		&PromptTemplate{},
+		&NoteRevision{},
 	)
 	
 	if err != nil {
@@ -0,0 +1,29 @@
+package models
+
+import "gorm.io/gorm"
+
+// CountNotesByUserID 统计用户的笔记数量
+func CountNotesByUserID(userID uint) (int64, error) {
+	var count int64
+	err := DB.Model(&Note{}).Where("user_id = ?", userID).Count(&count).Error
+	return count, err
+}
+
+// FindNotesInBatches 按ID顺序分批读取用户的笔记及其标签和附件，fn返回错误时停止
+func FindNotesInBatches(userID uint, batchSize int, fn func(notes []Note) error) error {
+	var notes []Note
+	return DB.Where("user_id = ?", userID).Preload("Tags").Preload("Attachments").
+		FindInBatches(&notes, batchSize, func(tx *gorm.DB, batch int) error {
+			return fn(notes)
+		}).Error
+}
+
+// GetUserAttachmentsByIDs 获取用户可以访问的附件：属于用户笔记的附件，以及用户上传的临时附件
+func GetUserAttachmentsByIDs(userID uint, ids []uint) ([]Attachment, error) {
+	var attachments []Attachment
+	if len(ids) == 0 {
+		return attachments, nil
+	}
+	err := libraryFilter(userID, LibraryQuery{})().Where("attachments.id IN ?", ids).Find(&attachments).Error
+	return attachments, err
+}
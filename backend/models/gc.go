@@ -0,0 +1,365 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"cyi-note/backend/storage"
+)
+
+// StorageGCOptions 存储清理参数
+type StorageGCOptions struct {
+	DryRun      bool          // 只报告问题，不做任何修改
+	TempTTL     time.Duration // 未关联到笔记的临时附件的保留时间，0表示不清理临时附件
+	GracePeriod time.Duration // 比该时间更新的文件和记录不做处理，避免误删正在上传的文件
+	Force       bool          // 文件丢失的记录超过 storageGCMaxMissingRatio 时仍然删除
+}
+
+// storageGCMaxMissingRatio 文件丢失的记录超过该比例时，可能是存储后端配置错误（例如指向了空的存储桶），
+// 不自动删除这些记录，需要确认后使用 Force 删除
+const storageGCMaxMissingRatio = 0.1
+
+// StorageGCReport 存储清理结果
+type StorageGCReport struct {
+	DryRun           bool  `json:"dry_run"`
+	ExpiredTemp      int   `json:"expired_temp"`       // 过期的临时附件
+	OrphanFiles      int   `json:"orphan_files"`       // 没有记录引用的文件
+	OrphanBytes      int64 `json:"orphan_bytes"`       // 孤儿文件的总大小
+	MissingBlobs     int   `json:"missing_blobs"`      // 文件不存在的去重文件记录
+	MissingLegacy    int   `json:"missing_legacy"`     // 文件不存在的早期附件记录
+	MissingThumbnail int   `json:"missing_thumbnails"` // 文件不存在的缩略图记录
+	RefCountFixed    int   `json:"ref_count_fixed"`    // 引用计数与实际引用不一致的去重文件
+	MissingSkipped   bool  `json:"missing_skipped"`    // 文件丢失的记录比例过高，未删除这些记录
+	Errors           int   `json:"errors"`
+}
+
+// RunStorageGC 清理过期的临时附件，并核对存储后端中的文件与数据库记录
+// 只检查附件使用的前缀，没有记录引用的文件会被删除；文件已丢失的记录会被删除（缩略图会在下次访问时重新生成），
+// 丢失比例过高时除非指定 Force 否则保留这些记录；去重文件的引用计数按实际引用的附件数量校正
+func RunStorageGC(ctx context.Context, opts StorageGCOptions) (*StorageGCReport, error) {
+	report := &StorageGCReport{DryRun: opts.DryRun}
+	start := time.Now()
+	cutoff := start.Add(-opts.GracePeriod)
+
+	if opts.TempTTL > 0 {
+		if err := expireTempAttachments(start.Add(-opts.TempTTL), opts.DryRun, report); err != nil {
+			return report, err
+		}
+	}
+
+	// 先列出存储后端中的文件再读取记录，列出之后新写入的文件不会被误判为孤儿文件
+	// 只列出附件使用的前缀，与上传目录共用存储的其他文件不会被当作孤儿文件
+	prefixes, err := storageGCPrefixes()
+	if err != nil {
+		return report, err
+	}
+	files := make(map[string]storage.ObjectInfo)
+	for _, prefix := range prefixes {
+		err := storage.Current().List(ctx, prefix, func(info storage.ObjectInfo) error {
+			files[info.Key] = info
+			return nil
+		})
+		if err != nil {
+			return report, err
+		}
+	}
+
+	known := make(map[string]bool)
+	if err := checkBlobFiles(files, known, cutoff, opts, report); err != nil {
+		return report, err
+	}
+	if err := checkLegacyFiles(ctx, files, prefixes, known, cutoff, opts, report); err != nil {
+		return report, err
+	}
+	if err := checkThumbnailFiles(files, known, cutoff, opts.DryRun, report); err != nil {
+		return report, err
+	}
+
+	// 没有记录引用的文件
+	for key, info := range files {
+		if known[key] || info.ModTime.After(cutoff) {
+			continue
+		}
+		log.Printf("孤儿文件: %s (%d 字节)", key, info.Size)
+		report.OrphanFiles++
+		report.OrphanBytes += info.Size
+		if !opts.DryRun {
+			if err := storage.Current().Delete(ctx, key); err != nil {
+				log.Printf("删除孤儿文件 %s 失败: %v", key, err)
+				report.Errors++
+			}
+		}
+	}
+
+	if err := fixBlobRefCounts(cutoff, opts.DryRun, report); err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
+
+// storageGCPrefixes 清理时列出的存储键前缀：去重文件、缩略图，以及早期按用户保存的附件和临时附件
+func storageGCPrefixes() ([]string, error) {
+	var userIDs []uint
+	if err := DB.Unscoped().Model(&User{}).Pluck("id", &userIDs).Error; err != nil {
+		return nil, err
+	}
+
+	prefixes := []string{"blobs/", "thumbnails/"}
+	for _, id := range userIDs {
+		prefixes = append(prefixes, fmt.Sprintf("%d/", id), fmt.Sprintf("temp/%d/", id))
+	}
+	return prefixes, nil
+}
+
+// allowMissingRemoval 检查是否可以删除文件丢失的记录，比例过高时只记录日志
+func allowMissingRemoval(kind string, missing, total int, opts StorageGCOptions, report *StorageGCReport) bool {
+	if missing == 0 {
+		return false
+	}
+	if !opts.Force && float64(missing) > float64(total)*storageGCMaxMissingRatio {
+		log.Printf("%d 个%s中有 %d 个文件丢失，超过 %.0f%%，可能是存储后端配置错误，未删除这些记录；确认后使用 -force 删除",
+			total, kind, missing, storageGCMaxMissingRatio*100)
+		report.MissingSkipped = true
+		return false
+	}
+	return true
+}
+
+// expireTempAttachments 删除创建时间早于before且仍未关联到笔记的临时附件
+// 已在笔记内容中引用的临时附件不会被删除
+func expireTempAttachments(before time.Time, dryRun bool, report *StorageGCReport) error {
+	var attachments []Attachment
+	if err := DB.Where("is_temp = ? AND note_id IS NULL AND created_at < ?", true, before).
+		Where("NOT EXISTS (SELECT 1 FROM attachment_references WHERE attachment_references.attachment_id = attachments.id)").
+		Find(&attachments).Error; err != nil {
+		return err
+	}
+
+	for _, attachment := range attachments {
+		log.Printf("过期的临时附件: %d (%s)", attachment.ID, attachment.Filename)
+		report.ExpiredTemp++
+		if dryRun {
+			continue
+		}
+		if err := DeleteAttachment(attachment.ID); err != nil {
+			log.Printf("删除临时附件 %d 失败: %v", attachment.ID, err)
+			report.Errors++
+		}
+	}
+	return nil
+}
+
+// checkBlobFiles 核对去重文件，文件丢失时删除引用它的附件
+func checkBlobFiles(files map[string]storage.ObjectInfo, known map[string]bool, cutoff time.Time, opts StorageGCOptions, report *StorageGCReport) error {
+	var blobs []Blob
+	if err := DB.Find(&blobs).Error; err != nil {
+		return err
+	}
+
+	var missing []Blob
+	for _, blob := range blobs {
+		known[blob.StorageKey] = true
+		if _, ok := files[blob.StorageKey]; ok || blob.CreatedAt.After(cutoff) {
+			continue
+		}
+
+		log.Printf("文件丢失的去重文件: %s", blob.StorageKey)
+		missing = append(missing, blob)
+	}
+	report.MissingBlobs = len(missing)
+
+	if !allowMissingRemoval("去重文件", len(missing), len(blobs), opts, report) || opts.DryRun {
+		return nil
+	}
+	for _, blob := range missing {
+		if err := removeMissingBlob(&blob); err != nil {
+			log.Printf("清理去重文件 %s 的记录失败: %v", blob.Hash, err)
+			report.Errors++
+		}
+	}
+	return nil
+}
+
+// removeMissingBlob 删除引用已丢失文件的附件，作为原图引用时只解除引用
+func removeMissingBlob(blob *Blob) error {
+	var attachments []Attachment
+	if err := DB.Where("blob_id = ?", blob.ID).Find(&attachments).Error; err != nil {
+		return err
+	}
+	for _, attachment := range attachments {
+		if err := DeleteAttachment(attachment.ID); err != nil {
+			return err
+		}
+	}
+
+	var originals []Attachment
+	if err := DB.Where("original_id = ?", blob.ID).Find(&originals).Error; err != nil {
+		return err
+	}
+	for _, attachment := range originals {
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&Attachment{}).Where("id = ?", attachment.ID).
+				Updates(map[string]interface{}{"original_id": nil, "original_size": 0}).Error; err != nil {
+				return err
+			}
+			return releaseStorage(tx, attachment.UserID, attachment.OriginalSize)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// 删除已无引用的记录及其缩略图
+	if err := DB.Where("id = ?", blob.ID).Delete(&Blob{}).Error; err != nil {
+		return err
+	}
+	return deleteThumbnails(blob.Hash)
+}
+
+// checkLegacyFiles 核对未使用去重存储的早期附件，文件丢失时删除附件
+// 不在已列出前缀中的文件单独检查是否存在
+func checkLegacyFiles(ctx context.Context, files map[string]storage.ObjectInfo, prefixes []string, known map[string]bool, cutoff time.Time, opts StorageGCOptions, report *StorageGCReport) error {
+	var attachments []Attachment
+	if err := DB.Where("blob_id IS NULL").Find(&attachments).Error; err != nil {
+		return err
+	}
+
+	var missing []Attachment
+	for _, attachment := range attachments {
+		key := attachment.StorageKey()
+		known[key] = true
+		if _, ok := files[key]; ok || attachment.CreatedAt.After(cutoff) {
+			continue
+		}
+		if !hasAnyPrefix(key, prefixes) {
+			_, err := storage.Current().Stat(ctx, key)
+			if err == nil {
+				continue
+			}
+			if !errors.Is(err, storage.ErrNotExist) {
+				log.Printf("读取附件 %d 的文件失败: %v", attachment.ID, err)
+				report.Errors++
+				continue
+			}
+		}
+
+		log.Printf("文件丢失的附件: %d (%s)", attachment.ID, key)
+		missing = append(missing, attachment)
+	}
+	report.MissingLegacy = len(missing)
+
+	if !allowMissingRemoval("早期附件", len(missing), len(attachments), opts, report) || opts.DryRun {
+		return nil
+	}
+	for _, attachment := range missing {
+		if err := DeleteAttachment(attachment.ID); err != nil {
+			log.Printf("删除附件 %d 失败: %v", attachment.ID, err)
+			report.Errors++
+		}
+	}
+	return nil
+}
+
+// hasAnyPrefix 检查key是否以任一前缀开头
+func hasAnyPrefix(key string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkThumbnailFiles 核对缩略图，文件丢失时删除记录以便重新生成
+func checkThumbnailFiles(files map[string]storage.ObjectInfo, known map[string]bool, cutoff time.Time, dryRun bool, report *StorageGCReport) error {
+	var thumbnails []Thumbnail
+	if err := DB.Find(&thumbnails).Error; err != nil {
+		return err
+	}
+
+	for _, thumbnail := range thumbnails {
+		known[thumbnail.StorageKey] = true
+		if _, ok := files[thumbnail.StorageKey]; ok || thumbnail.CreatedAt.After(cutoff) {
+			continue
+		}
+
+		log.Printf("文件丢失的缩略图: %s", thumbnail.StorageKey)
+		report.MissingThumbnail++
+		if dryRun {
+			continue
+		}
+		if err := DB.Delete(&Thumbnail{}, thumbnail.ID).Error; err != nil {
+			log.Printf("删除缩略图记录 %d 失败: %v", thumbnail.ID, err)
+			report.Errors++
+		}
+	}
+	return nil
+}
+
+// fixBlobRefCounts 按实际引用的附件数量校正引用计数，已无引用的去重文件会被删除
+// 最近更新过的记录可能正处于上传流程中（已增加引用但还未创建附件），不做处理
+func fixBlobRefCounts(cutoff time.Time, dryRun bool, report *StorageGCReport) error {
+	var rows []struct {
+		ID       uint
+		Hash     string
+		RefCount int
+		Actual   int
+	}
+	err := DB.Raw(`SELECT blobs.id, blobs.hash, blobs.ref_count,
+			(SELECT COUNT(*) FROM attachments WHERE attachments.deleted_at IS NULL AND attachments.blob_id = blobs.id) +
+			(SELECT COUNT(*) FROM attachments WHERE attachments.deleted_at IS NULL AND attachments.original_id = blobs.id) AS actual
+		FROM blobs WHERE blobs.updated_at < ?`, cutoff).Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		// 引用计数为0的记录是异常中断留下的，同样需要清理
+		if row.RefCount == row.Actual && row.Actual > 0 {
+			continue
+		}
+
+		log.Printf("去重文件 %s 的引用计数为 %d，实际引用 %d", row.Hash, row.RefCount, row.Actual)
+		report.RefCountFixed++
+		if dryRun {
+			continue
+		}
+		if err := setBlobRefCount(row.ID, row.Hash, row.Actual); err != nil {
+			log.Printf("校正去重文件 %s 的引用计数失败: %v", row.Hash, err)
+			report.Errors++
+		}
+	}
+	return nil
+}
+
+// setBlobRefCount 设置引用计数，为0时删除记录、文件及缩略图
+func setBlobRefCount(id uint, hash string, count int) error {
+	unlock := lockBlob(hash)
+	defer unlock()
+
+	if count > 0 {
+		return DB.Model(&Blob{}).Where("id = ?", id).UpdateColumn("ref_count", count).Error
+	}
+
+	var blob Blob
+	if err := DB.First(&blob, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if err := DB.Delete(&Blob{}, id).Error; err != nil {
+		return err
+	}
+	if err := storage.Current().Delete(context.Background(), blob.StorageKey); err != nil {
+		return err
+	}
+	return deleteThumbnails(hash)
+}
@@ -0,0 +1,347 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"cyi-note/backend/utils"
+)
+
+// ImportReport 导入结果，试运行时为将要创建的内容
+type ImportReport struct {
+	DryRun        bool                `json:"dry_run"`
+	Notes         []ImportNoteReport  `json:"notes"`
+	NewTags       []string            `json:"new_tags"`       // 需要新建的标签
+	Attachments   int                 `json:"attachments"`    // 附件数量
+	TotalSize     int64               `json:"total_size"`     // 附件总大小（字节），图片规范化后实际占用的空间可能更小
+	QuotaExceeded bool                `json:"quota_exceeded"` // 附件总大小是否超出存储空间配额
+	Issues        []utils.ImportIssue `json:"issues"`         // 跳过的文件、未找到的引用等
+}
+
+// ImportNoteReport 导入的一篇笔记
+type ImportNoteReport struct {
+	Path        string     `json:"path"`
+	NoteID      uint       `json:"note_id,omitempty"` // 试运行时为空
+	Title       string     `json:"title"`
+	Tags        []string   `json:"tags"`
+	CreatedAt   *time.Time `json:"created_at,omitempty"`
+	IsPublic    bool       `json:"is_public"`
+	Attachments []string   `json:"attachments"`
+}
+
+// 导入的阶段，用于报告进度
+const (
+	ImportStagePrepare = "prepare" // 检查引用的文件
+	ImportStageStore   = "store"   // 写入附件内容
+	ImportStageSave    = "save"    // 在事务中创建笔记
+)
+
+// ImportOptions 导入选项
+type ImportOptions struct {
+	DryRun bool
+	// Progress 报告进度（可选），done/total 为当前阶段已处理和总共的数量
+	Progress func(stage string, done, total int)
+}
+
+// progress 报告导入进度
+func (o ImportOptions) progress(stage string, done, total int) {
+	if o.Progress != nil {
+		o.Progress(stage, done, total)
+	}
+}
+
+// importFile 导入的文件，多篇笔记引用同一文件时共用
+type importFile struct {
+	tempPath string
+	fileType string
+	filename string
+	size     int64
+	err      error       // 无法导入的原因，为nil时可以导入
+	stored   *storedFile // 已写入存储后端的内容
+}
+
+// ImportNotes 导入解析出的笔记，笔记、标签和附件在同一事务中创建，任何一步失败都不会留下导入的内容
+// 引用的文件按普通上传的规则检查类型和大小，无法导入的文件保留原来的链接并记录在报告中
+// opts.DryRun为true时只检查并返回将要创建的内容；返回创建的附件，用于生成缩略图等后续处理
+func ImportNotes(userID uint, notes []utils.ImportedNote, issues []utils.ImportIssue, opts ImportOptions) (*ImportReport, []Attachment, error) {
+	report := &ImportReport{
+		DryRun:  opts.DryRun,
+		Notes:   make([]ImportNoteReport, 0, len(notes)),
+		NewTags: []string{},
+		Issues:  append([]utils.ImportIssue{}, issues...),
+	}
+
+	files := make(map[string]*importFile)
+	defer func() {
+		for _, file := range files {
+			if file.tempPath != "" {
+				os.Remove(file.tempPath)
+			}
+		}
+	}()
+
+	var tagNames []string
+	seenTags := make(map[string]bool)
+	for i, note := range notes {
+		opts.progress(ImportStagePrepare, i, len(notes))
+		noteReport := ImportNoteReport{
+			Path:        note.Path,
+			Title:       note.Title,
+			Tags:        note.Tags,
+			IsPublic:    note.IsPublic,
+			Attachments: []string{},
+		}
+		if noteReport.Tags == nil {
+			noteReport.Tags = []string{}
+		}
+		if !note.CreatedAt.IsZero() {
+			createdAt := note.CreatedAt
+			noteReport.CreatedAt = &createdAt
+		}
+		for _, tag := range note.Tags {
+			if !seenTags[tag] {
+				seenTags[tag] = true
+				tagNames = append(tagNames, tag)
+			}
+		}
+
+		for _, f := range note.Files {
+			file, ok := files[f.Path]
+			if !ok {
+				file = prepareImportFile(f)
+				files[f.Path] = file
+				if file.err != nil {
+					report.Issues = append(report.Issues, utils.ImportIssue{Path: f.Path, Reason: "无法导入: " + file.err.Error()})
+				}
+			}
+			if file.err == nil {
+				noteReport.Attachments = append(noteReport.Attachments, file.filename)
+				report.Attachments++
+				report.TotalSize += file.size
+			}
+		}
+		report.Notes = append(report.Notes, noteReport)
+	}
+
+	// 已存在的标签直接使用
+	if len(tagNames) > 0 {
+		var existing []string
+		if err := DB.Model(&Tag{}).Where("name IN ?", tagNames).Pluck("name", &existing).Error; err != nil {
+			return nil, nil, err
+		}
+		exists := make(map[string]bool, len(existing))
+		for _, name := range existing {
+			exists[name] = true
+		}
+		for _, name := range tagNames {
+			if !exists[name] {
+				report.NewTags = append(report.NewTags, name)
+			}
+		}
+	}
+
+	if err := CheckStorageQuota(userID, report.TotalSize); err != nil {
+		if !errors.Is(err, ErrStorageQuotaExceeded) {
+			return nil, nil, err
+		}
+		report.QuotaExceeded = true
+	}
+	if opts.DryRun {
+		return report, nil, nil
+	}
+	if report.QuotaExceeded {
+		return report, nil, ErrStorageQuotaExceeded
+	}
+
+	attachments, err := createImportedNotes(userID, notes, files, report, opts)
+	if err != nil {
+		return report, nil, err
+	}
+	return report, attachments, nil
+}
+
+// prepareImportFile 将文件解压到临时文件，并按上传规则检测类型和检查大小
+func prepareImportFile(f *utils.ImportedFile) *importFile {
+	file := &importFile{}
+
+	src, err := f.Open()
+	if err != nil {
+		file.err = fmt.Errorf("读取文件失败: %v", err)
+		return file
+	}
+	defer src.Close()
+
+	temp, err := os.CreateTemp("", "import_*")
+	if err != nil {
+		file.err = fmt.Errorf("创建临时文件失败: %v", err)
+		return file
+	}
+	defer temp.Close()
+	file.tempPath = temp.Name()
+
+	if _, err := io.Copy(temp, src); err != nil {
+		file.err = fmt.Errorf("读取文件失败: %v", err)
+		return file
+	}
+	if _, err := temp.Seek(0, io.SeekStart); err != nil {
+		file.err = fmt.Errorf("读取文件失败: %v", err)
+		return file
+	}
+	file.fileType, file.filename, file.size, file.err = checkFile(temp, f.Name)
+	return file
+}
+
+// createImportedNotes 写入附件内容，并在同一事务中创建笔记、标签和附件记录，同时在报告中填写笔记ID
+func createImportedNotes(userID uint, notes []utils.ImportedNote, files map[string]*importFile, report *ImportReport, opts ImportOptions) ([]Attachment, error) {
+	// 事务失败时释放已获取的Blob引用
+	var acquired []uint
+	release := func() {
+		for _, id := range acquired {
+			ReleaseBlob(id)
+		}
+	}
+
+	// 每个附件持有一个Blob引用：第一次使用时写入内容，再次使用时增加引用计数
+	type noteBlob struct {
+		file     *importFile
+		blob     *Blob
+		original *Blob
+	}
+	blobs := make([][]*noteBlob, len(notes))
+	for i, note := range notes {
+		opts.progress(ImportStageStore, i, len(notes))
+		blobs[i] = make([]*noteBlob, len(note.Files))
+		for j, f := range note.Files {
+			file := files[f.Path]
+			if file.err != nil {
+				continue
+			}
+
+			entry := &noteBlob{file: file}
+			if file.stored == nil {
+				stored, err := storeImportFile(file, userID)
+				if err != nil {
+					release()
+					return nil, err
+				}
+				file.stored = stored
+				entry.blob, entry.original = stored.Blob, stored.Original
+				acquired = append(acquired, stored.Blob.ID)
+				if stored.Original != nil {
+					acquired = append(acquired, stored.Original.ID)
+				}
+			} else {
+				blob, err := RetainBlob(file.stored.Blob.Hash)
+				if err != nil {
+					release()
+					return nil, err
+				}
+				entry.blob = blob
+				acquired = append(acquired, blob.ID)
+				if file.stored.Original != nil {
+					if entry.original, err = RetainBlob(file.stored.Original.Hash); err != nil {
+						release()
+						return nil, err
+					}
+					acquired = append(acquired, entry.original.ID)
+				}
+			}
+			blobs[i][j] = entry
+		}
+	}
+
+	// 事务中不报告进度，SQLite在事务期间无法写入任务进度
+	opts.progress(ImportStageSave, 0, len(notes))
+	var attachments []Attachment
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		tags := make(map[string]*Tag)
+		for i, imported := range notes {
+			note := Note{
+				UserID:    userID,
+				Title:     imported.Title,
+				IsPublic:  imported.IsPublic,
+				CreatedAt: imported.CreatedAt,
+			}
+			if err := tx.Create(&note).Error; err != nil {
+				return err
+			}
+			report.Notes[i].NoteID = note.ID
+
+			for _, name := range imported.Tags {
+				tag, ok := tags[name]
+				if !ok {
+					var err error
+					if tag, err = getOrCreateTag(tx, name); err != nil {
+						return err
+					}
+					tags[name] = tag
+				}
+				if err := tx.Create(&NoteTag{NoteID: note.ID, TagID: tag.ID}).Error; err != nil {
+					return err
+				}
+			}
+
+			// 将内容中的占位符替换为附件地址，无法导入的文件恢复为原来的链接
+			replacements := make([]string, 0, len(imported.Files)*2)
+			for j, f := range imported.Files {
+				entry := blobs[i][j]
+				if entry == nil {
+					replacements = append(replacements, utils.ImportFileRef(j), f.Original)
+					continue
+				}
+				attachment := newAttachmentForBlob(entry.blob, entry.file.stored.Filename, note.ID, entry.file.stored.FileType, userID, false, entry.original)
+				if err := insertAttachment(tx, attachment); err != nil {
+					return err
+				}
+				attachments = append(attachments, *attachment)
+				replacements = append(replacements, utils.ImportFileRef(j), "/api/attachments/"+strconv.FormatUint(uint64(attachment.ID), 10))
+			}
+			content := imported.Content
+			if len(replacements) > 0 {
+				content = strings.NewReplacer(replacements...).Replace(content)
+			}
+			if err := tx.Model(&note).UpdateColumn("content", content).Error; err != nil {
+				return err
+			}
+
+			for _, id := range utils.ParseAttachmentReferences(content) {
+				if err := tx.Create(&AttachmentReference{NoteID: note.ID, AttachmentID: id}).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		release()
+		for i := range report.Notes {
+			report.Notes[i].NoteID = 0
+		}
+		if errors.Is(err, ErrStorageQuotaExceeded) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("创建笔记失败: %v", err)
+	}
+
+	for i := range attachments {
+		attachments[i].SetURLs()
+	}
+	return attachments, nil
+}
+
+// storeImportFile 将导入的文件写入存储后端
+func storeImportFile(file *importFile, userID uint) (*storedFile, error) {
+	temp, err := os.Open(file.tempPath)
+	if err != nil {
+		return nil, fmt.Errorf("读取文件失败: %v", err)
+	}
+	defer temp.Close()
+	return storeFile(temp, file.fileType, file.filename, userID)
+}
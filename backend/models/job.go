@@ -0,0 +1,310 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+// 任务状态
+const (
+	JobStatusQueued  = "queued"  // 排队中
+	JobStatusRunning = "running" // 执行中
+	JobStatusDone    = "done"    // 已完成
+	JobStatusFailed  = "failed"  // 执行失败
+)
+
+// Job 后台任务模型
+type Job struct {
+	ID          uint            `gorm:"primaryKey" json:"id"`
+	UserID      uint            `gorm:"index;not null" json:"user_id"`
+	Type        string          `gorm:"size:50;index;not null" json:"type"`
+	NoteID      *uint           `gorm:"index" json:"note_id"`
+	Status      string          `gorm:"size:20;index;not null;default:queued" json:"status"`
+	Input       string          `gorm:"type:text" json:"-"`              // 任务参数（JSON）
+	Result      string          `gorm:"type:text" json:"-"`              // 任务结果（JSON）
+	Output      json.RawMessage `gorm:"-" json:"result,omitempty"`       // 任务结果，计算属性，不存储在数据库
+	Error       string          `gorm:"size:500" json:"error,omitempty"` // 失败原因
+	ContentHash string          `gorm:"size:64;index" json:"-"`          // 结果缓存键
+	Cached      bool            `gorm:"default:false" json:"cached"`     // 结果是否来自缓存
+	Attempts    int             `gorm:"default:0" json:"attempts"`
+	Progress    int             `gorm:"default:0" json:"progress"`       // 执行进度（0-100）
+	Stage       string          `gorm:"size:100" json:"stage,omitempty"` // 当前执行阶段的说明
+	StartedAt   *time.Time      `json:"started_at"`
+	FinishedAt  *time.Time      `json:"finished_at"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// AfterFind 查询后自动设置任务结果
+func (j *Job) AfterFind(tx *gorm.DB) error {
+	if j.Result != "" {
+		j.Output = json.RawMessage(j.Result)
+	}
+	return nil
+}
+
+// AIUsage 用户每日AI调用次数
+type AIUsage struct {
+	ID     uint   `gorm:"primaryKey" json:"-"`
+	UserID uint   `gorm:"uniqueIndex:idx_ai_usage_user_day;not null" json:"user_id"`
+	Day    string `gorm:"size:10;uniqueIndex:idx_ai_usage_user_day;not null" json:"day"` // YYYY-MM-DD
+	Count  int    `gorm:"not null;default:0" json:"count"`
+}
+
+// TableName 指定表名
+func (AIUsage) TableName() string {
+	return "ai_usages"
+}
+
+// AIResultCache AI任务结果缓存，按任务类型和内容哈希索引
+type AIResultCache struct {
+	CacheKey  string `gorm:"primaryKey;size:64"`
+	Type      string `gorm:"size:50;index;not null"`
+	Result    string `gorm:"type:text"`
+	CreatedAt time.Time
+}
+
+// TableName 指定表名
+func (AIResultCache) TableName() string {
+	return "ai_result_caches"
+}
+
+// ErrAIQuotaExceeded 超出每日AI调用次数
+var ErrAIQuotaExceeded = errors.New("今日AI调用次数已用完")
+
+// ErrTooManyRunningJobs 用户同时执行的AI任务数量已达上限
+var ErrTooManyRunningJobs = errors.New("同时进行的AI任务过多，请稍后再试")
+
+// claimMutex 保证同一进程内领取任务时的并发数检查是串行的
+var claimMutex sync.Mutex
+
+// CreateJob 创建任务
+func CreateJob(job *Job) error {
+	return DB.Create(job).Error
+}
+
+// GetJobByID 通过ID获取任务
+func GetJobByID(id uint) (*Job, error) {
+	var job Job
+	err := DB.First(&job, id).Error
+	return &job, err
+}
+
+// GetJobsByUserID 获取用户最近的任务，jobTypes为空时返回所有类型的任务
+func GetJobsByUserID(userID uint, jobTypes []string, limit int) ([]Job, error) {
+	var jobs []Job
+	query := DB.Where("user_id = ?", userID)
+	if len(jobTypes) > 0 {
+		query = query.Where("type IN ?", jobTypes)
+	}
+	err := query.Order("id DESC").Limit(limit).Find(&jobs).Error
+	return jobs, err
+}
+
+// CountRunningJobs 统计用户正在执行的指定类型的任务数量
+func CountRunningJobs(userID uint, types []string) (int64, error) {
+	var count int64
+	err := DB.Model(&Job{}).Where("user_id = ? AND status = ? AND type IN ?", userID, JobStatusRunning, types).Count(&count).Error
+	return count, err
+}
+
+// ClaimNextJob 领取types中下一个可执行的任务，没有可执行任务时返回nil
+// limitedTypes 中的任务按用户限制并发：用户正在执行的这些类型的任务数已达到maxPerUser时，跳过该用户的这些任务
+func ClaimNextJob(types, limitedTypes []string, maxPerUser int) (*Job, error) {
+	claimMutex.Lock()
+	defer claimMutex.Unlock()
+
+	query := DB.Where("status = ? AND type IN ?", JobStatusQueued, types)
+	if len(limitedTypes) > 0 {
+		busyUsers := DB.Model(&Job{}).
+			Select("user_id").
+			Where("status = ? AND type IN ?", JobStatusRunning, limitedTypes).
+			Group("user_id").
+			Having("COUNT(*) >= ?", maxPerUser)
+		query = query.Where("(type NOT IN ? OR user_id NOT IN (?))", limitedTypes, busyUsers)
+	}
+
+	// 使用Find而不是First，队列为空时不会每次轮询都记录record not found
+	var job Job
+	found := query.Order("id ASC").Limit(1).Find(&job)
+	if found.Error != nil {
+		return nil, found.Error
+	}
+	if found.RowsAffected == 0 {
+		return nil, nil
+	}
+
+	// 条件更新，避免被其他进程重复领取
+	now := time.Now()
+	result := DB.Model(&Job{}).
+		Where("id = ? AND status = ?", job.ID, JobStatusQueued).
+		Updates(map[string]interface{}{
+			"status":     JobStatusRunning,
+			"started_at": now,
+			"attempts":   gorm.Expr("attempts + 1"),
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+
+	job.Status = JobStatusRunning
+	job.StartedAt = &now
+	job.Attempts++
+	return &job, nil
+}
+
+// StartJob 创建直接处于执行状态的任务，用于在请求中同步执行的AI调用
+// 用户正在执行的limitedTypes中的任务数已达到maxPerUser时返回ErrTooManyRunningJobs
+func StartJob(job *Job, limitedTypes []string, maxPerUser int) error {
+	claimMutex.Lock()
+	defer claimMutex.Unlock()
+
+	running, err := CountRunningJobs(job.UserID, limitedTypes)
+	if err != nil {
+		return err
+	}
+	if running >= int64(maxPerUser) {
+		return ErrTooManyRunningJobs
+	}
+
+	now := time.Now()
+	job.Status = JobStatusRunning
+	job.StartedAt = &now
+	job.Attempts = 1
+	return DB.Create(job).Error
+}
+
+// UpdateJobProgress 更新执行中任务的进度和阶段说明
+func UpdateJobProgress(id uint, progress int, stage string) error {
+	return DB.Model(&Job{}).Where("id = ? AND status = ?", id, JobStatusRunning).Updates(map[string]interface{}{
+		"progress": progress,
+		"stage":    stage,
+	}).Error
+}
+
+// FinishJob 标记任务完成并保存结果
+func FinishJob(id uint, result string, cached bool) error {
+	now := time.Now()
+	return DB.Model(&Job{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":      JobStatusDone,
+		"result":      result,
+		"cached":      cached,
+		"error":       "",
+		"progress":    100,
+		"stage":       "",
+		"finished_at": now,
+	}).Error
+}
+
+// FailJob 标记任务失败
+func FailJob(id uint, reason string) error {
+	reason = truncateRunes(reason, 500)
+	now := time.Now()
+	return DB.Model(&Job{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":      JobStatusFailed,
+		"error":       reason,
+		"finished_at": now,
+	}).Error
+}
+
+// truncateRunes 将字符串截断为最多n个字符，不会截断多字节字符
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+// RequeueRunningJobs 将上次进程退出时仍在执行的任务重新放回队列
+// inlineTypes 中的任务是随请求结束的同步调用，无法重新执行，直接标记为失败；
+// 已执行maxAttempts次的任务也标记为失败，避免每次执行都导致进程退出的任务无限重试
+func RequeueRunningJobs(inlineTypes []string, maxAttempts int) (int64, error) {
+	now := time.Now()
+	err := DB.Model(&Job{}).Where("status = ? AND type IN ?", JobStatusRunning, inlineTypes).Updates(map[string]interface{}{
+		"status":      JobStatusFailed,
+		"error":       "服务重启，调用已中断",
+		"finished_at": now,
+	}).Error
+	if err != nil {
+		return 0, err
+	}
+
+	err = DB.Model(&Job{}).Where("status = ? AND attempts >= ?", JobStatusRunning, maxAttempts).Updates(map[string]interface{}{
+		"status":      JobStatusFailed,
+		"error":       "任务多次执行中断，已停止重试",
+		"finished_at": now,
+	}).Error
+	if err != nil {
+		return 0, err
+	}
+
+	result := DB.Model(&Job{}).Where("status = ?", JobStatusRunning).
+		Update("status", JobStatusQueued)
+	return result.RowsAffected, result.Error
+}
+
+// GetAIUsage 获取用户当天的AI调用次数
+func GetAIUsage(userID uint) (int, error) {
+	var usage AIUsage
+	err := DB.Where("user_id = ? AND day = ?", userID, time.Now().Format("2006-01-02")).First(&usage).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	return usage.Count, err
+}
+
+// ConsumeAIQuota 消耗一次当天的AI调用次数，超出limit时返回ErrAIQuotaExceeded
+func ConsumeAIQuota(userID uint, limit int) error {
+	day := time.Now().Format("2006-01-02")
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		// 确保当天的计数记录存在
+		usage := AIUsage{UserID: userID, Day: day}
+		if err := tx.Where(AIUsage{UserID: userID, Day: day}).FirstOrCreate(&usage).Error; err != nil {
+			return err
+		}
+
+		// 条件自增，计数已达上限时不更新
+		result := tx.Model(&AIUsage{}).
+			Where("id = ? AND count < ?", usage.ID, limit).
+			Update("count", gorm.Expr("count + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrAIQuotaExceeded
+		}
+		return nil
+	})
+}
+
+// RefundAIQuota 退还一次当天的AI调用次数，用于消耗次数后任务未能创建的情况
+func RefundAIQuota(userID uint) error {
+	day := time.Now().Format("2006-01-02")
+	return DB.Model(&AIUsage{}).
+		Where("user_id = ? AND day = ? AND count > 0", userID, day).
+		Update("count", gorm.Expr("count - 1")).Error
+}
+
+// GetAIResultCache 获取缓存的AI任务结果
+func GetAIResultCache(key string) (*AIResultCache, error) {
+	var cache AIResultCache
+	err := DB.Where("cache_key = ?", key).First(&cache).Error
+	if err != nil {
+		return nil, err
+	}
+	return &cache, nil
+}
+
+// SaveAIResultCache 保存AI任务结果缓存
+func SaveAIResultCache(key, jobType, result string) error {
+	return DB.Save(&AIResultCache{CacheKey: key, Type: jobType, Result: result}).Error
+}
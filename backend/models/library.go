@@ -0,0 +1,260 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidCursor 分页游标无效或与排序方式不一致
+var ErrInvalidCursor = errors.New("无效的分页游标")
+
+// librarySortColumns 资源库支持的排序字段
+var librarySortColumns = map[string]string{
+	"created_at": "attachments.created_at",
+	"filename":   "attachments.filename",
+	"filesize":   "attachments.filesize",
+}
+
+// LibraryQuery 资源库的筛选、排序和分页条件
+type LibraryQuery struct {
+	FileType string         // 文件类型前缀，例如 image/
+	Start    time.Time      // 上传时间不早于Start，零值表示不限制
+	End      time.Time      // 上传时间早于End，零值表示不限制
+	MinSize  int64          // 最小文件大小（字节），0表示不限制
+	MaxSize  int64          // 最大文件大小（字节），0表示不限制
+	NoteID   uint           // 所属笔记
+	TagID    uint           // 所属笔记的标签
+	Filename string         // 文件名包含的文本
+	Temp     *bool          // 只看临时附件（true）或已关联到笔记的附件（false），nil表示不限制
+	Sort     string         // 排序字段：created_at（默认）、filename、filesize
+	Asc      bool           // 是否升序，默认降序
+	Cursor   string         // 上一页返回的游标
+	Page     int            // 未提供游标时按页码分页
+	PageSize int            // 每页数量
+	Location *time.Location // 日期分组使用的时区，默认为服务器时区
+}
+
+// DateGroup 日期分组结构
+type DateGroup struct {
+	Date        string `json:"date"`
+	Count       int    `json:"count"`
+	DisplayDate string `json:"displayDate"`
+}
+
+// LibraryPage 资源库的一页结果
+type LibraryPage struct {
+	Attachments []Attachment
+	DateGroups  []DateGroup // 只在第一页（未提供游标时）返回
+	Total       int64
+	NextCursor  string // 没有下一页时为空
+}
+
+// libraryCursor 游标内容：上一页最后一个附件的排序字段值和ID
+type libraryCursor struct {
+	Sort  string          `json:"s"`
+	Asc   bool            `json:"a"`
+	Value json.RawMessage `json:"v"`
+	ID    uint            `json:"id"`
+}
+
+// QueryLibrary 查询用户的资源库，包括关联到其笔记的附件和其上传的临时附件
+// 提供游标时使用键集分页，否则按页码分页并返回日期分组
+func QueryLibrary(userID uint, q LibraryQuery) (*LibraryPage, error) {
+	column, ok := librarySortColumns[q.Sort]
+	if !ok {
+		q.Sort, column = "created_at", librarySortColumns["created_at"]
+	}
+	if q.Location == nil {
+		q.Location = time.Local
+	}
+
+	filtered := libraryFilter(userID, q)
+
+	page := &LibraryPage{}
+	if err := filtered().Count(&page.Total).Error; err != nil {
+		return nil, err
+	}
+
+	direction, compare := "DESC", "<"
+	if q.Asc {
+		direction, compare = "ASC", ">"
+	}
+	query := filtered().Order(column + " " + direction).Order("attachments.id " + direction)
+
+	if q.Cursor != "" {
+		cursor, value, err := decodeLibraryCursor(q.Cursor, q.Sort)
+		if err != nil || cursor.Asc != q.Asc {
+			return nil, ErrInvalidCursor
+		}
+		query = query.Where("("+column+" "+compare+" ?) OR ("+column+" = ? AND attachments.id "+compare+" ?)",
+			value, value, cursor.ID)
+	} else if q.Page > 1 {
+		query = query.Offset((q.Page - 1) * q.PageSize)
+	}
+
+	// 多查询一条，用于判断是否还有下一页
+	if err := query.Limit(q.PageSize + 1).Find(&page.Attachments).Error; err != nil {
+		return nil, err
+	}
+	if len(page.Attachments) > q.PageSize {
+		page.Attachments = page.Attachments[:q.PageSize]
+		last := page.Attachments[len(page.Attachments)-1]
+		cursor, err := encodeLibraryCursor(q.Sort, q.Asc, &last)
+		if err != nil {
+			return nil, err
+		}
+		page.NextCursor = cursor
+	}
+
+	if q.Cursor == "" {
+		groups, err := libraryDateGroups(filtered(), q.Location)
+		if err != nil {
+			return nil, err
+		}
+		page.DateGroups = groups
+	}
+	return page, nil
+}
+
+// libraryFilter 返回应用了所有筛选条件的查询构造函数，每次调用生成新的查询
+func libraryFilter(userID uint, q LibraryQuery) func() *gorm.DB {
+	return func() *gorm.DB {
+		query := DB.Model(&Attachment{}).
+			Where("attachments.note_id IN (?) OR (attachments.note_id IS NULL AND attachments.user_id = ?)",
+				DB.Model(&Note{}).Select("id").Where("user_id = ?", userID), userID)
+
+		if q.FileType != "" {
+			query = query.Where("attachments.filetype LIKE ?", q.FileType+"%")
+		}
+		if !q.Start.IsZero() {
+			query = query.Where("attachments.created_at >= ?", q.Start)
+		}
+		if !q.End.IsZero() {
+			query = query.Where("attachments.created_at < ?", q.End)
+		}
+		if q.MinSize > 0 {
+			query = query.Where("attachments.filesize >= ?", q.MinSize)
+		}
+		if q.MaxSize > 0 {
+			query = query.Where("attachments.filesize <= ?", q.MaxSize)
+		}
+		if q.NoteID != 0 {
+			query = query.Where("attachments.note_id = ?", q.NoteID)
+		}
+		if q.TagID != 0 {
+			query = query.Where("attachments.note_id IN (?)",
+				DB.Table("note_tags").Select("note_id").Where("tag_id = ?", q.TagID))
+		}
+		if q.Filename != "" {
+			query = query.Where("attachments.filename LIKE ?", "%"+q.Filename+"%")
+		}
+		if q.Temp != nil {
+			if *q.Temp {
+				query = query.Where("attachments.note_id IS NULL")
+			} else {
+				query = query.Where("attachments.note_id IS NOT NULL")
+			}
+		}
+		return query
+	}
+}
+
+// libraryDateGroups 按指定时区的上传日期统计附件数量，日期从新到旧排列
+// 在应用中按时区换算日期，不依赖各数据库的日期函数
+func libraryDateGroups(query *gorm.DB, loc *time.Location) ([]DateGroup, error) {
+	var times []time.Time
+	if err := query.Order("attachments.created_at DESC").Pluck("attachments.created_at", &times).Error; err != nil {
+		return nil, err
+	}
+
+	groups := []DateGroup{}
+	for _, t := range times {
+		local := t.In(loc)
+		date := local.Format("2006-01-02")
+		if n := len(groups); n > 0 && groups[n-1].Date == date {
+			groups[n-1].Count++
+			continue
+		}
+		groups = append(groups, DateGroup{
+			Date:        date,
+			Count:       1,
+			DisplayDate: formatDisplayDate(local, loc),
+		})
+	}
+	return groups, nil
+}
+
+// formatDisplayDate 格式化显示日期
+func formatDisplayDate(t time.Time, loc *time.Location) string {
+	now := time.Now().In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	yesterday := today.AddDate(0, 0, -1)
+
+	if t.Year() == today.Year() && t.Month() == today.Month() && t.Day() == today.Day() {
+		return "今天"
+	} else if t.Year() == yesterday.Year() && t.Month() == yesterday.Month() && t.Day() == yesterday.Day() {
+		return "昨天"
+	} else if t.Year() == now.Year() {
+		return t.Format("01月02日")
+	}
+
+	return t.Format("2006年01月02日")
+}
+
+// encodeLibraryCursor 根据附件的排序字段值生成游标
+func encodeLibraryCursor(sort string, asc bool, attachment *Attachment) (string, error) {
+	var value interface{}
+	switch sort {
+	case "filename":
+		value = attachment.Filename
+	case "filesize":
+		value = attachment.Filesize
+	default:
+		value = attachment.CreatedAt
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(libraryCursor{Sort: sort, Asc: asc, Value: raw, ID: attachment.ID})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeLibraryCursor 解析游标，返回游标内容和用于比较的排序字段值
+func decodeLibraryCursor(encoded, sort string) (*libraryCursor, interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, nil, err
+	}
+	var cursor libraryCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, nil, err
+	}
+	if cursor.Sort != sort {
+		return nil, nil, ErrInvalidCursor
+	}
+
+	switch sort {
+	case "filename":
+		var value string
+		err = json.Unmarshal(cursor.Value, &value)
+		return &cursor, value, err
+	case "filesize":
+		var value int64
+		err = json.Unmarshal(cursor.Value, &value)
+		return &cursor, value, err
+	default:
+		var value time.Time
+		err = json.Unmarshal(cursor.Value, &value)
+		// 与数据库中保存的时间使用相同的时区，SQLite按字符串比较时间
+		return &cursor, value.In(time.Local), err
+	}
+}
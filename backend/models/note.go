@@ -1,6 +1,7 @@
 package models
 
 import (
+	"log"
 	"time"
 	
 	"gorm.io/gorm"
@@ -22,6 +23,12 @@ type Note struct {
 	User        User          `gorm:"foreignKey:UserID" json:"user"`
 	Tags        []*Tag        `gorm:"many2many:note_tags;" json:"tags"`
 	Attachments []Attachment  `gorm:"foreignKey:NoteID" json:"attachments"`
+	
+	// 搜索结果中匹配关键词的附件，计算属性
+	MatchedAttachments []AttachmentMatch `gorm:"-" json:"matched_attachments,omitempty"`
+	
+	// 服务端渲染并清理后的HTML，请求 rendered_html=true 时以及公开笔记返回，计算属性
+	RenderedHTML string `gorm:"-" json:"rendered_html,omitempty"`
 }
 
 // CreateNote 创建笔记
@@ -56,14 +63,15 @@ func GetNotesByUserID(userID uint, page, pageSize int) ([]Note, int64, error) {
 	return notes, total, err
 }
 
-// SearchNotes 搜索笔记（标题、内容）
+// SearchNotes 搜索笔记（标题、内容，以及附件的说明文字、替代文本和提取的文本）
+// 附件匹配关键词的笔记会在MatchedAttachments中列出匹配的附件
 func SearchNotes(userID uint, keyword string, page, pageSize int) ([]Note, int64, error) {
 	var notes []Note
 	var total int64
 	
 	// 构建搜索条件
 	query := DB.Model(&Note{}).Where("user_id = ?", userID).
-		Where("title LIKE ? OR content LIKE ?", "%"+keyword+"%", "%"+keyword+"%")
+		Where("title LIKE ? OR content LIKE ? OR id IN (?)", "%"+keyword+"%", "%"+keyword+"%", notesWithMatchingAttachments(keyword))
 	
 	// 获取总数
 	if err := query.Count(&total).Error; err != nil {
@@ -74,8 +82,40 @@ func SearchNotes(userID uint, keyword string, page, pageSize int) ([]Note, int64
 	offset := (page - 1) * pageSize
 	err := query.Offset(offset).Limit(pageSize).Order("created_at DESC").
 		Preload("Tags").Preload("Attachments").Find(&notes).Error
+	if err != nil {
+		return nil, 0, err
+	}
 	
-	return notes, total, err
+	if err := setAttachmentMatches(notes, keyword); err != nil {
+		return nil, 0, err
+	}
+	return notes, total, nil
+}
+
+// GetNotesForRetrieval 获取用于问答检索的候选笔记
+// 优先返回标题或内容包含任一关键词的笔记，没有匹配时退回最近更新的笔记
+func GetNotesForRetrieval(userID uint, keywords []string, limit int) ([]Note, error) {
+	var notes []Note
+	
+	if len(keywords) > 0 {
+		query := DB.Model(&Note{}).Where("user_id = ?", userID)
+		
+		// 任一关键词命中标题或内容即可
+		conditions := DB.Where("1 = 0")
+		for _, keyword := range keywords {
+			conditions = conditions.Or("title LIKE ? OR content LIKE ?", "%"+keyword+"%", "%"+keyword+"%")
+		}
+		
+		if err := query.Where(conditions).Order("updated_at DESC").Limit(limit).Find(&notes).Error; err != nil {
+			return nil, err
+		}
+		if len(notes) > 0 {
+			return notes, nil
+		}
+	}
+	
+	err := DB.Where("user_id = ?", userID).Order("updated_at DESC").Limit(limit).Find(&notes).Error
+	return notes, err
 }
 
 // SearchNotesByTag 通过标签搜索笔记
@@ -106,22 +146,66 @@ func UpdateNote(note *Note) error {
 	return DB.Save(note).Error
 }
 
+// UpdateNoteSummary 更新笔记摘要，不修改笔记的更新时间
+func UpdateNoteSummary(id uint, summary string) error {
+	return DB.Model(&Note{}).Where("id = ?", id).UpdateColumn("summary", summary).Error
+}
+
 // DeleteNote 删除笔记
 func DeleteNote(id uint) error {
-	return DB.Transaction(func(tx *gorm.DB) error {
+	// 记录笔记的附件，删除成功后释放文件
+	attachments, err := GetAttachmentsByNoteID(id)
+	if err != nil {
+		return err
+	}
+	
+	err = DB.Transaction(func(tx *gorm.DB) error {
 		// 删除笔记标签关联
 		if err := tx.Where("note_id = ?", id).Delete(&NoteTag{}).Error; err != nil {
 			return err
 		}
 		
-		// 删除笔记附件
+		// 删除笔记附件，并从上传者已使用的空间中扣除
 		if err := tx.Where("note_id = ?", id).Delete(&Attachment{}).Error; err != nil {
 			return err
 		}
+		attachmentIDs := make([]uint, len(attachments))
+		for i := range attachments {
+			attachmentIDs[i] = attachments[i].ID
+			if err := releaseStorage(tx, attachments[i].UserID, attachments[i].StorageSize()); err != nil {
+				return err
+			}
+		}
+		if err := deleteAttachmentTexts(tx, attachmentIDs...); err != nil {
+			return err
+		}
+		if err := deleteAttachmentReferences(tx, id); err != nil {
+			return err
+		}
+		
+		// 删除标签建议
+		if err := tx.Where("note_id = ?", id).Delete(&TagSuggestion{}).Error; err != nil {
+			return err
+		}
+		
+		// 删除修订版本
+		if err := tx.Where("note_id = ?", id).Delete(&NoteRevision{}).Error; err != nil {
+			return err
+		}
 		
 		// 删除笔记
 		return tx.Delete(&Note{}, id).Error
 	})
+	if err != nil {
+		return err
+	}
+	
+	for i := range attachments {
+		if err := releaseAttachmentFile(&attachments[i]); err != nil {
+			log.Printf("释放附件 %d 的文件失败: %v", attachments[i].ID, err)
+		}
+	}
+	return nil
 }
 
 // AddTagToNote 给笔记添加标签
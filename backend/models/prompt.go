@@ -0,0 +1,85 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 写作助手动作
+const (
+	TransformRewrite    = "rewrite"     // 改写
+	TransformContinue   = "continue"    // 续写
+	TransformTranslate  = "translate"   // 翻译（中英互译）
+	TransformFixGrammar = "fix_grammar" // 修正语法
+	TransformTitle      = "title"       // 生成标题
+)
+
+// TransformActions 支持的写作助手动作
+var TransformActions = []string{
+	TransformRewrite,
+	TransformContinue,
+	TransformTranslate,
+	TransformFixGrammar,
+	TransformTitle,
+}
+
+// 默认提示词模板，使用text/template语法，可用变量：.TargetLang（翻译目标语言）、.Title（笔记标题）
+var defaultPromptTemplates = map[string]string{
+	TransformRewrite:    "你是一个写作助手。请改写用户提供的文本，使表达更清晰流畅，保持原意、原有语言和Markdown格式，只输出改写后的文本。",
+	TransformContinue:   "你是一个写作助手。请根据用户提供的文本{{if .Title}}（所属笔记标题：{{.Title}}）{{end}}自然地续写一到两段，保持相同的语言、语气和Markdown格式，只输出续写的内容，不要重复原文。",
+	TransformTranslate:  "你是一个翻译助手。请将用户提供的文本翻译为{{.TargetLang}}，保留Markdown格式、代码块和链接，只输出译文。",
+	TransformFixGrammar: "你是一个校对助手。请修正用户提供的文本中的错别字、语法和标点错误，不要改变原意和Markdown格式，只输出修正后的文本。",
+	TransformTitle:      "你是一个写作助手。请为用户提供的笔记内容生成一个简洁的标题，不超过30个字，使用与内容相同的语言，只输出标题本身，不要加引号。",
+}
+
+// PromptTemplate 写作助手的提示词模板，未保存时使用默认模板
+type PromptTemplate struct {
+	Action    string    `gorm:"primaryKey;size:50" json:"action"`
+	Template  string    `gorm:"type:text;not null" json:"template"`
+	IsDefault bool      `gorm:"-" json:"is_default"` // 是否为内置默认模板，计算属性
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// IsTransformAction 检查是否为支持的写作助手动作
+func IsTransformAction(action string) bool {
+	_, ok := defaultPromptTemplates[action]
+	return ok
+}
+
+// GetPromptTemplate 获取动作对应的提示词模板
+func GetPromptTemplate(action string) (*PromptTemplate, error) {
+	var template PromptTemplate
+	err := DB.Where("action = ?", action).First(&template).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &PromptTemplate{Action: action, Template: defaultPromptTemplates[action], IsDefault: true}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+// GetPromptTemplates 获取所有动作的提示词模板
+func GetPromptTemplates() ([]PromptTemplate, error) {
+	templates := make([]PromptTemplate, 0, len(TransformActions))
+	for _, action := range TransformActions {
+		template, err := GetPromptTemplate(action)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, *template)
+	}
+	return templates, nil
+}
+
+// SavePromptTemplate 保存提示词模板
+func SavePromptTemplate(template *PromptTemplate) error {
+	return DB.Save(template).Error
+}
+
+// ResetPromptTemplate 删除自定义模板，恢复为默认模板
+func ResetPromptTemplate(action string) error {
+	return DB.Where("action = ?", action).Delete(&PromptTemplate{}).Error
+}
@@ -0,0 +1,164 @@
+package models
+
+import (
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"cyi-note/backend/utils"
+)
+
+// ErrStorageQuotaExceeded 超出用户的存储空间配额
+var ErrStorageQuotaExceeded = errors.New("存储空间不足，已超出配额")
+
+// roleStorageQuotas 各角色默认的存储空间配额（字节），0表示不限制
+var roleStorageQuotas = map[string]int64{}
+
+// SetRoleStorageQuotas 设置各角色默认的存储空间配额
+func SetRoleStorageQuotas(quotas map[string]int64) {
+	roleStorageQuotas = quotas
+}
+
+// StorageLimit 用户的存储空间配额（字节），0表示不限制
+// 用户单独设置的配额优先于所属角色的默认配额
+func (u *User) StorageLimit() int64 {
+	if u.StorageQuota != nil {
+		return *u.StorageQuota
+	}
+	return roleStorageQuotas[u.Role]
+}
+
+// CheckStorageQuota 检查用户是否还有size字节的可用空间
+func CheckStorageQuota(userID uint, size int64) error {
+	user, err := GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if limit := user.StorageLimit(); limit > 0 && user.StorageUsed+size > limit {
+		return ErrStorageQuotaExceeded
+	}
+	return nil
+}
+
+// reserveStorage 在事务中增加用户已使用的空间，超出配额时返回ErrStorageQuotaExceeded
+// 使用条件更新，并发上传时不会超出配额
+func reserveStorage(tx *gorm.DB, userID uint, size int64) error {
+	var user User
+	if err := tx.First(&user, userID).Error; err != nil {
+		return err
+	}
+
+	query := tx.Model(&User{}).Where("id = ?", userID)
+	if limit := user.StorageLimit(); limit > 0 {
+		query = query.Where("storage_used + ? <= ?", size, limit)
+	}
+	result := query.UpdateColumn("storage_used", gorm.Expr("storage_used + ?", size))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrStorageQuotaExceeded
+	}
+	return nil
+}
+
+// releaseStorage 在事务中减少用户已使用的空间，不会减到0以下
+func releaseStorage(tx *gorm.DB, userID uint, size int64) error {
+	return tx.Model(&User{}).Where("id = ?", userID).
+		UpdateColumn("storage_used", gorm.Expr("CASE WHEN storage_used > ? THEN storage_used - ? ELSE 0 END", size, size)).Error
+}
+
+// RecalculateStorageUsage 根据附件记录重新统计所有用户已使用的空间
+func RecalculateStorageUsage() error {
+	return DB.Exec(`UPDATE users SET storage_used = (
+		SELECT COALESCE(SUM(attachments.filesize + attachments.original_size), 0)
+		FROM attachments
+		WHERE attachments.user_id = users.id AND attachments.deleted_at IS NULL
+	)`).Error
+}
+
+// UpdateUserStorageQuota 设置用户的存储空间配额（字节），为nil时使用所属角色的默认配额
+func UpdateUserStorageQuota(userID uint, quota *int64) error {
+	return DB.Model(&User{}).Where("id = ?", userID).UpdateColumn("storage_quota", quota).Error
+}
+
+// StorageCategory 按文件类型分类的空间使用情况
+type StorageCategory struct {
+	Category string `json:"category"` // image, video, audio, document, other
+	Count    int64  `json:"count"`
+	Size     int64  `json:"size"`
+}
+
+// StorageUsage 用户的存储空间使用情况
+type StorageUsage struct {
+	Used      int64             `json:"used"`
+	Quota     int64             `json:"quota"`     // 0表示不限制
+	Remaining int64             `json:"remaining"` // 不限制时为-1
+	Breakdown []StorageCategory `json:"breakdown"`
+}
+
+// GetStorageUsage 获取用户的存储空间使用情况及按文件类型的分类统计
+func GetStorageUsage(userID uint) (*StorageUsage, error) {
+	user, err := GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		Filetype string
+		Count    int64
+		Size     int64
+	}
+	if err := DB.Model(&Attachment{}).
+		Select("filetype, COUNT(*) AS count, COALESCE(SUM(filesize + original_size), 0) AS size").
+		Where("user_id = ?", userID).
+		Group("filetype").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	// 按分类汇总，保持固定顺序
+	categories := []string{"image", "video", "audio", "document", "other"}
+	totals := make(map[string]*StorageCategory, len(categories))
+	for _, category := range categories {
+		totals[category] = &StorageCategory{Category: category}
+	}
+	for _, row := range rows {
+		total := totals[storageCategory(row.Filetype)]
+		total.Count += row.Count
+		total.Size += row.Size
+	}
+
+	usage := &StorageUsage{
+		Used:      user.StorageUsed,
+		Quota:     user.StorageLimit(),
+		Remaining: -1,
+	}
+	if usage.Quota > 0 {
+		usage.Remaining = usage.Quota - usage.Used
+		if usage.Remaining < 0 {
+			usage.Remaining = 0
+		}
+	}
+	for _, category := range categories {
+		usage.Breakdown = append(usage.Breakdown, *totals[category])
+	}
+	return usage, nil
+}
+
+// storageCategory 文件类型所属的分类
+func storageCategory(contentType string) string {
+	switch {
+	case utils.IsImageFile(contentType):
+		return "image"
+	case strings.HasPrefix(contentType, "video/"):
+		return "video"
+	case strings.HasPrefix(contentType, "audio/"):
+		return "audio"
+	case utils.IsDocumentFile(contentType), contentType == "text/markdown":
+		return "document"
+	default:
+		return "other"
+	}
+}
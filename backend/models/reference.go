@@ -0,0 +1,152 @@
+package models
+
+import (
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"cyi-note/backend/utils"
+)
+
+// AttachmentReference 笔记内容中引用的附件（/api/attachments/:id 链接），保存笔记时更新
+type AttachmentReference struct {
+	ID           uint      `gorm:"primaryKey" json:"-"`
+	NoteID       uint      `gorm:"uniqueIndex:idx_reference_note_attachment;not null" json:"note_id"`
+	AttachmentID uint      `gorm:"uniqueIndex:idx_reference_note_attachment;index;not null" json:"attachment_id"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// SyncAttachmentReferences 根据笔记内容更新笔记引用的附件
+// 用户开启自动关联时，内容中引用的本人的临时附件会关联到该笔记；返回新关联的附件数量
+func SyncAttachmentReferences(note *Note) (int64, error) {
+	ids := utils.ParseAttachmentReferences(note.Content)
+
+	settings, err := GetUserSettings(note.UserID)
+	if err != nil {
+		return 0, err
+	}
+
+	var associated int64
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("note_id = ?", note.ID).Delete(&AttachmentReference{}).Error; err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		references := make([]AttachmentReference, len(ids))
+		for i, id := range ids {
+			references[i] = AttachmentReference{NoteID: note.ID, AttachmentID: id}
+		}
+		if err := tx.Create(&references).Error; err != nil {
+			return err
+		}
+
+		if !settings.AutoAssociateAttachments {
+			return nil
+		}
+		result := tx.Model(&Attachment{}).
+			Where("id IN ? AND user_id = ? AND is_temp = ? AND note_id IS NULL", ids, note.UserID, true).
+			Updates(map[string]interface{}{"note_id": note.ID, "is_temp": false})
+		associated = result.RowsAffected
+		return result.Error
+	})
+	return associated, err
+}
+
+// deleteAttachmentReferences 在事务中删除笔记的附件引用记录
+func deleteAttachmentReferences(tx *gorm.DB, noteID uint) error {
+	return tx.Where("note_id = ?", noteID).Delete(&AttachmentReference{}).Error
+}
+
+// RebuildAttachmentReferences 引用记录为空时（例如升级后首次启动）根据已有笔记的内容建立引用记录
+// 只记录引用，不会自动关联临时附件
+func RebuildAttachmentReferences() error {
+	var count int64
+	if err := DB.Model(&AttachmentReference{}).Count(&count).Error; err != nil || count > 0 {
+		return err
+	}
+
+	var lastID uint
+	for {
+		var notes []Note
+		if err := DB.Select("id", "content").Where("id > ?", lastID).Order("id ASC").Limit(100).Find(&notes).Error; err != nil {
+			return err
+		}
+		if len(notes) == 0 {
+			return nil
+		}
+
+		var references []AttachmentReference
+		for _, note := range notes {
+			lastID = note.ID
+			for _, id := range utils.ParseAttachmentReferences(note.Content) {
+				references = append(references, AttachmentReference{NoteID: note.ID, AttachmentID: id})
+			}
+		}
+		if len(references) > 0 {
+			if err := DB.Create(&references).Error; err != nil {
+				return err
+			}
+			log.Printf("已为 %d 篇笔记建立附件引用记录", len(notes))
+		}
+	}
+}
+
+// AttachmentReferenceReport 笔记的附件引用情况
+type AttachmentReferenceReport struct {
+	Referenced []Attachment `json:"referenced"` // 内容中引用的附件
+	Unused     []Attachment `json:"unused"`     // 关联到笔记但内容中没有引用的附件
+	Broken     []uint       `json:"broken"`     // 内容中引用但不存在或不属于笔记所有者的附件ID
+}
+
+// GetAttachmentReferenceReport 获取笔记引用的附件、未使用的附件以及失效的引用
+func GetAttachmentReferenceReport(note *Note) (*AttachmentReferenceReport, error) {
+	var ids []uint
+	if err := DB.Model(&AttachmentReference{}).Where("note_id = ?", note.ID).
+		Order("id ASC").Pluck("attachment_id", &ids).Error; err != nil {
+		return nil, err
+	}
+
+	// 只有笔记所有者的附件算作有效引用：关联到其笔记的附件，或其上传的临时附件
+	var referenced []Attachment
+	if len(ids) > 0 {
+		if err := DB.Select("attachments.*").
+			Joins("LEFT JOIN notes ON notes.id = attachments.note_id").
+			Where("attachments.id IN ?", ids).
+			Where("notes.user_id = ? OR (attachments.note_id IS NULL AND attachments.user_id = ?)", note.UserID, note.UserID).
+			Find(&referenced).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	report := &AttachmentReferenceReport{
+		Referenced: []Attachment{},
+		Unused:     []Attachment{},
+		Broken:     []uint{},
+	}
+	found := make(map[uint]Attachment, len(referenced))
+	for _, attachment := range referenced {
+		found[attachment.ID] = attachment
+	}
+	for _, id := range ids {
+		if attachment, ok := found[id]; ok {
+			report.Referenced = append(report.Referenced, attachment)
+		} else {
+			report.Broken = append(report.Broken, id)
+		}
+	}
+
+	attachments, err := GetAttachmentsByNoteID(note.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, attachment := range attachments {
+		if _, ok := found[attachment.ID]; !ok {
+			report.Unused = append(report.Unused, attachment)
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+	
+	"gorm.io/gorm"
+)
+
+// NoteRevision 笔记修订版本
+type NoteRevision struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	NoteID    uint      `gorm:"index;not null" json:"note_id"`
+	UserID    uint      `gorm:"index;not null" json:"user_id"`
+	Title     string    `gorm:"size:255;not null" json:"title"`
+	Content   string    `gorm:"type:text" json:"content"`
+	Source    string    `gorm:"size:50" json:"source"` // 修订来源，例如 ai:rewrite
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateNoteRevision 创建笔记修订版本
+func CreateNoteRevision(revision *NoteRevision) error {
+	return DB.Create(revision).Error
+}
+
+// GetNoteRevisionByID 通过ID获取修订版本
+func GetNoteRevisionByID(id uint) (*NoteRevision, error) {
+	var revision NoteRevision
+	err := DB.First(&revision, id).Error
+	return &revision, err
+}
+
+// GetNoteRevisions 获取笔记的所有修订版本，最新的在前
+func GetNoteRevisions(noteID uint) ([]NoteRevision, error) {
+	var revisions []NoteRevision
+	err := DB.Where("note_id = ?", noteID).Order("id DESC").Find(&revisions).Error
+	return revisions, err
+}
+
+// RestoreNoteRevision 将笔记恢复为指定的修订版本
+// 恢复前先把当前的标题和内容保存为来源为 restore 的修订版本，两步在同一事务中完成
+func RestoreNoteRevision(note *Note, revision *NoteRevision) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		current := NoteRevision{
+			NoteID:  note.ID,
+			UserID:  note.UserID,
+			Title:   note.Title,
+			Content: note.Content,
+			Source:  "restore",
+		}
+		if err := tx.Create(&current).Error; err != nil {
+			return err
+		}
+		
+		note.Title = revision.Title
+		note.Content = revision.Content
+		return tx.Save(note).Error
+	})
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UserSettings 用户偏好设置
+type UserSettings struct {
+	ID                       uint      `gorm:"primaryKey" json:"-"`
+	UserID                   uint      `gorm:"uniqueIndex;not null" json:"user_id"`
+	AutoSummary              bool      `gorm:"default:false" json:"auto_summary"`               // 保存笔记时自动生成摘要
+	AutoTagSuggestions       bool      `gorm:"default:false" json:"auto_tag_suggestions"`       // 保存笔记时自动生成标签建议
+	KeepOriginalImages       bool      `gorm:"default:false" json:"keep_original_images"`       // 上传图片时另存未经处理的原图（包含EXIF等元数据）
+	AutoAssociateAttachments bool      `gorm:"default:false" json:"auto_associate_attachments"` // 保存笔记时将内容中引用的临时附件关联到笔记
+	CreatedAt                time.Time `json:"created_at"`
+	UpdatedAt                time.Time `json:"updated_at"`
+}
+
+// GetUserSettings 获取用户设置，用户未保存过设置时返回默认值
+func GetUserSettings(userID uint) (*UserSettings, error) {
+	var settings UserSettings
+	err := DB.Where("user_id = ?", userID).First(&settings).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &UserSettings{UserID: userID}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// SaveUserSettings 保存用户设置
+func SaveUserSettings(settings *UserSettings) error {
+	return DB.Save(settings).Error
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// StorageObject 数据库记录引用的存储后端文件
+type StorageObject struct {
+	Key         string
+	ContentType string
+	Source      string // 引用该文件的记录，用于日志，例如 blob 12
+}
+
+// ForEachStorageObject 分批遍历数据库记录引用的所有文件：去重文件（包括保留的原图）、缩略图和早期附件
+// 早期附件包括已删除的记录，fn返回错误时停止
+func ForEachStorageObject(batchSize int, fn func(object StorageObject) error) error {
+	var blobs []Blob
+	err := DB.FindInBatches(&blobs, batchSize, func(tx *gorm.DB, batch int) error {
+		for _, blob := range blobs {
+			if err := fn(StorageObject{Key: blob.StorageKey, ContentType: blob.ContentType, Source: fmt.Sprintf("blob %d", blob.ID)}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	var thumbnails []Thumbnail
+	err = DB.FindInBatches(&thumbnails, batchSize, func(tx *gorm.DB, batch int) error {
+		for _, thumbnail := range thumbnails {
+			if err := fn(StorageObject{Key: thumbnail.StorageKey, ContentType: thumbnail.ContentType, Source: fmt.Sprintf("thumbnail %d", thumbnail.ID)}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	var attachments []Attachment
+	return DB.Unscoped().Where("blob_id IS NULL").FindInBatches(&attachments, batchSize, func(tx *gorm.DB, batch int) error {
+		for _, attachment := range attachments {
+			if err := fn(StorageObject{Key: attachment.StorageKey(), ContentType: attachment.Filetype, Source: fmt.Sprintf("attachment %d", attachment.ID)}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
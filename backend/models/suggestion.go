@@ -0,0 +1,78 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 标签建议状态
+const (
+	SuggestionPending  = "pending"  // 待处理
+	SuggestionAccepted = "accepted" // 已采纳
+	SuggestionRejected = "rejected" // 已拒绝
+)
+
+// TagSuggestion 笔记的标签建议
+type TagSuggestion struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	NoteID    uint      `gorm:"uniqueIndex:idx_tag_suggestion_note_name;not null" json:"note_id"`
+	Name      string    `gorm:"size:255;uniqueIndex:idx_tag_suggestion_note_name;not null" json:"name"`
+	Score     float64   `json:"score"`
+	Status    string    `gorm:"size:20;index;not null;default:pending" json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// GetTagSuggestionsByNoteID 获取笔记的标签建议，status为空时返回全部
+func GetTagSuggestionsByNoteID(noteID uint, status string) ([]TagSuggestion, error) {
+	var suggestions []TagSuggestion
+	query := DB.Where("note_id = ?", noteID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Order("score DESC, id ASC").Find(&suggestions).Error
+	return suggestions, err
+}
+
+// ReplacePendingTagSuggestions 用新的建议替换笔记所有待处理的建议
+// 已采纳或已拒绝的建议保持不变，不会再次出现
+func ReplacePendingTagSuggestions(noteID uint, suggestions []TagSuggestion) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("note_id = ? AND status = ?", noteID, SuggestionPending).
+			Delete(&TagSuggestion{}).Error; err != nil {
+			return err
+		}
+
+		// 已处理过的建议名称
+		var reviewed []string
+		if err := tx.Model(&TagSuggestion{}).Where("note_id = ?", noteID).
+			Pluck("name", &reviewed).Error; err != nil {
+			return err
+		}
+		skip := make(map[string]bool, len(reviewed))
+		for _, name := range reviewed {
+			skip[name] = true
+		}
+
+		for _, suggestion := range suggestions {
+			if skip[suggestion.Name] {
+				continue
+			}
+			skip[suggestion.Name] = true
+
+			suggestion.ID = 0
+			suggestion.NoteID = noteID
+			suggestion.Status = SuggestionPending
+			if err := tx.Create(&suggestion).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// UpdateTagSuggestionStatus 更新标签建议状态
+func UpdateTagSuggestionStatus(id uint, status string) error {
+	return DB.Model(&TagSuggestion{}).Where("id = ?", id).Update("status", status).Error
+}
@@ -101,14 +101,19 @@ func DeleteTag(id uint) error {
 
 // GetOrCreateTag 获取或创建标签
 func GetOrCreateTag(name string) (*Tag, error) {
+	return getOrCreateTag(DB, name)
+}
+
+// getOrCreateTag 在指定的数据库连接（可以是事务）中获取或创建标签
+func getOrCreateTag(tx *gorm.DB, name string) (*Tag, error) {
 	var tag Tag
 	
 	// 尝试查找标签
-	if err := DB.Where("name = ?", name).First(&tag).Error; err != nil {
+	if err := tx.Where("name = ?", name).First(&tag).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			// 标签不存在，创建新标签
 			tag = Tag{Name: name}
-			if err := DB.Create(&tag).Error; err != nil {
+			if err := tx.Create(&tag).Error; err != nil {
 				return nil, err
 			}
 		} else {
@@ -117,4 +122,4 @@ func GetOrCreateTag(name string) (*Tag, error) {
 	}
 	
 	return &tag, nil
-} 
\ No newline at end of file
+}
@@ -0,0 +1,224 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"cyi-note/backend/storage"
+	"cyi-note/backend/utils"
+)
+
+// Thumbnail 图片附件的缩略图，按原文件内容哈希和尺寸名称保存，引用同一文件的附件共用缩略图
+type Thumbnail struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Hash        string    `gorm:"size:64;uniqueIndex:idx_thumbnail_hash_size;not null" json:"hash"` // 原文件内容的SHA-256
+	Size        string    `gorm:"size:20;uniqueIndex:idx_thumbnail_hash_size;not null" json:"size"` // 尺寸名称，例如 thumb
+	StorageKey  string    `gorm:"size:255;not null" json:"-"`
+	ContentType string    `gorm:"size:100" json:"content_type"`
+	Width       int       `json:"width"`
+	Height      int       `json:"height"`
+	Filesize    int64     `json:"filesize"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// thumbnailSizes 可用的缩略图尺寸：名称 -> 最长边像素
+var thumbnailSizes = map[string]int{"thumb": 256}
+
+// SetThumbnailSizes 设置可用的缩略图尺寸
+func SetThumbnailSizes(sizes map[string]int) {
+	if len(sizes) > 0 {
+		thumbnailSizes = sizes
+	}
+}
+
+// ThumbnailSize 获取尺寸名称对应的最长边像素
+func ThumbnailSize(name string) (int, bool) {
+	size, ok := thumbnailSizes[name]
+	return size, ok
+}
+
+// ThumbnailSizeNames 按像素从小到大返回所有尺寸名称
+func ThumbnailSizeNames() []string {
+	names := make([]string, 0, len(thumbnailSizes))
+	for name := range thumbnailSizes {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return thumbnailSizes[names[i]] < thumbnailSizes[names[j]]
+	})
+	return names
+}
+
+// thumbnailStorageKey 缩略图在存储后端中的键
+func thumbnailStorageKey(hash, size, contentType string) string {
+	ext := ".jpg"
+	if contentType == "image/png" {
+		ext = ".png"
+	}
+	return "thumbnails/" + hash[:2] + "/" + hash + "/" + size + ext
+}
+
+// GetThumbnail 获取已生成的缩略图
+func GetThumbnail(hash, size string) (*Thumbnail, error) {
+	var thumbnail Thumbnail
+	err := DB.Where("hash = ? AND size = ?", hash, size).First(&thumbnail).Error
+	if err != nil {
+		return nil, err
+	}
+	return &thumbnail, nil
+}
+
+// EnsureThumbnail 获取内容哈希为hash的图片的缩略图，尚未生成时从sourceKey读取原图生成
+func EnsureThumbnail(hash, sourceKey, size string) (*Thumbnail, error) {
+	maxSize, ok := ThumbnailSize(size)
+	if !ok {
+		return nil, fmt.Errorf("无效的缩略图尺寸: %s", size)
+	}
+	if !IsValidBlobHash(hash) {
+		return nil, errors.New("缺少文件哈希，无法生成缩略图")
+	}
+
+	thumbnail, err := GetThumbnail(hash, size)
+	if err == nil {
+		return thumbnail, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	reader, err := storage.Current().Get(ctx, sourceKey)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	generated, err := utils.GenerateThumbnail(reader, maxSize)
+	if err != nil {
+		return nil, err
+	}
+
+	key := thumbnailStorageKey(hash, size, generated.ContentType)
+	if err := storage.Current().Put(ctx, key, bytes.NewReader(generated.Data), int64(len(generated.Data)), generated.ContentType); err != nil {
+		return nil, err
+	}
+
+	thumbnail = &Thumbnail{
+		Hash:        hash,
+		Size:        size,
+		StorageKey:  key,
+		ContentType: generated.ContentType,
+		Width:       generated.Width,
+		Height:      generated.Height,
+		Filesize:    int64(len(generated.Data)),
+	}
+	if err := DB.Create(thumbnail).Error; err != nil {
+		// 其他请求可能同时生成了相同的缩略图
+		if existing, getErr := GetThumbnail(hash, size); getErr == nil {
+			return existing, nil
+		}
+		return nil, err
+	}
+	return thumbnail, nil
+}
+
+// EnsureThumbnails 生成所有尺寸的缩略图，返回新生成的数量
+func EnsureThumbnails(hash, sourceKey string) (int, error) {
+	generated := 0
+	for _, size := range ThumbnailSizeNames() {
+		if _, err := GetThumbnail(hash, size); err == nil {
+			continue
+		}
+		if _, err := EnsureThumbnail(hash, sourceKey, size); err != nil {
+			return generated, err
+		}
+		generated++
+	}
+	return generated, nil
+}
+
+// deleteThumbnails 删除原文件的所有缩略图
+func deleteThumbnails(hash string) error {
+	var thumbnails []Thumbnail
+	if err := DB.Where("hash = ?", hash).Find(&thumbnails).Error; err != nil {
+		return err
+	}
+
+	for _, thumbnail := range thumbnails {
+		if err := storage.Current().Delete(context.Background(), thumbnail.StorageKey); err != nil {
+			return err
+		}
+	}
+	return DB.Where("hash = ?", hash).Delete(&Thumbnail{}).Error
+}
+
+// GetImageBlobs 分批获取可以生成缩略图的图片文件，用于补全缩略图
+func GetImageBlobs(afterID uint, limit int) ([]Blob, error) {
+	var blobs []Blob
+	err := DB.Where("id > ? AND ref_count > 0 AND content_type IN ?", afterID,
+		[]string{"image/jpeg", "image/png", "image/gif", "image/webp"}).
+		Order("id ASC").Limit(limit).Find(&blobs).Error
+	return blobs, err
+}
+
+// GetLegacyImageAttachments 分批获取未使用去重存储的早期图片附件，用于补全缩略图
+func GetLegacyImageAttachments(afterID uint, limit int) ([]Attachment, error) {
+	var attachments []Attachment
+	err := DB.Where("id > ? AND blob_id IS NULL AND filetype LIKE ?", afterID, "image/%").
+		Order("id ASC").Limit(limit).Find(&attachments).Error
+	return attachments, err
+}
+
+// EnsureAttachmentHash 早期上传的附件没有记录内容哈希，读取文件计算后保存，用于生成和查找缩略图
+func EnsureAttachmentHash(attachment *Attachment) error {
+	if attachment.Hash != "" {
+		return nil
+	}
+
+	reader, err := storage.Current().Get(context.Background(), attachment.StorageKey())
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, reader); err != nil {
+		return err
+	}
+	hash := hex.EncodeToString(h.Sum(nil))
+	if err := DB.Model(&Attachment{}).Where("id = ?", attachment.ID).UpdateColumn("hash", hash).Error; err != nil {
+		return err
+	}
+	attachment.Hash = hash
+	return nil
+}
+
+// releaseLegacyThumbnails 删除早期附件的缩略图，其他附件或去重文件仍使用相同内容时保留
+func releaseLegacyThumbnails(hash string) error {
+	if hash == "" {
+		return nil
+	}
+	var count int64
+	if err := DB.Model(&Attachment{}).Where("hash = ?", hash).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	if err := DB.Model(&Blob{}).Where("hash = ?", hash).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	return deleteThumbnails(hash)
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+)
+
+// Upload 断点续传（tus协议）的上传会话
+type Upload struct {
+	ID           string    `gorm:"primaryKey;size:32" json:"id"`
+	UserID       uint      `gorm:"index;not null" json:"user_id"`
+	Length       int64     `gorm:"not null" json:"length"`           // 文件总大小
+	Offset       int64     `gorm:"not null;default:0" json:"offset"` // 已接收的字节数
+	Metadata     string    `gorm:"size:1000" json:"-"`               // 原始的Upload-Metadata请求头
+	Filename     string    `gorm:"size:255" json:"filename"`
+	Filetype     string    `gorm:"size:100" json:"filetype"`
+	NoteID       *uint     `json:"note_id"`
+	IsTemp       bool      `gorm:"default:false" json:"is_temp"`
+	AttachmentID *uint     `json:"attachment_id"` // 上传完成后创建的附件
+	ExpiresAt    time.Time `gorm:"index" json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// CreateUpload 创建上传会话
+func CreateUpload(upload *Upload) error {
+	return DB.Create(upload).Error
+}
+
+// GetUploadByID 通过ID获取上传会话
+func GetUploadByID(id string) (*Upload, error) {
+	var upload Upload
+	err := DB.Where("id = ?", id).First(&upload).Error
+	return &upload, err
+}
+
+// UpdateUploadOffset 更新已接收的字节数，并顺延过期时间
+func UpdateUploadOffset(id string, offset int64, expiresAt time.Time) error {
+	return DB.Model(&Upload{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"offset":     offset,
+		"expires_at": expiresAt,
+	}).Error
+}
+
+// CompleteUpload 记录上传完成后创建的附件
+func CompleteUpload(id string, attachmentID uint) error {
+	return DB.Model(&Upload{}).Where("id = ?", id).Update("attachment_id", attachmentID).Error
+}
+
+// DeleteUpload 删除上传会话
+func DeleteUpload(id string) error {
+	return DB.Where("id = ?", id).Delete(&Upload{}).Error
+}
+
+// GetExpiredUploads 获取已过期的上传会话
+func GetExpiredUploads(now time.Time) ([]Upload, error) {
+	var uploads []Upload
+	err := DB.Where("expires_at < ?", now).Find(&uploads).Error
+	return uploads, err
+}
@@ -22,6 +22,10 @@ type User struct {
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 	
+	// 存储空间
+	StorageQuota *int64 `json:"storage_quota"`                          // 单独设置的配额（字节），为空时使用角色的默认配额，0表示不限制
+	StorageUsed  int64  `gorm:"not null;default:0" json:"storage_used"` // 已使用的空间（字节）
+	
 	// 关联
 	Notes []Note `gorm:"foreignKey:UserID" json:"-"`
 }
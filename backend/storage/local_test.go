@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalPutGetStatDelete(t *testing.T) {
+	root := t.TempDir()
+	local, err := NewLocal(root)
+	if err != nil {
+		t.Fatalf("NewLocal: %v", err)
+	}
+	ctx := context.Background()
+	key := "blobs/ab/cd/abcdef"
+
+	if err := local.Put(ctx, key, strings.NewReader("hello world"), -1, "text/plain"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(root, "blobs", "ab", "cd", "abcdef")); err != nil || string(data) != "hello world" {
+		t.Fatalf("file on disk = %q, %v", data, err)
+	}
+
+	reader, err := local.Get(ctx, key)
+	if got := readAll(t, reader, err); got != "hello world" {
+		t.Errorf("Get = %q", got)
+	}
+
+	info, err := local.Stat(ctx, "/"+key)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Key != key || info.Size != 11 || info.ModTime.IsZero() {
+		t.Errorf("Stat = %+v", info)
+	}
+
+	// 覆盖写入
+	if err := local.Put(ctx, key, strings.NewReader("bye"), 3, ""); err != nil {
+		t.Fatalf("Put overwrite: %v", err)
+	}
+	reader, err = local.Get(ctx, key)
+	if got := readAll(t, reader, err); got != "bye" {
+		t.Errorf("Get after overwrite = %q", got)
+	}
+
+	if err := local.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := local.Stat(ctx, key); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Stat after delete: err = %v, want ErrNotExist", err)
+	}
+	if _, err := local.Get(ctx, key); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Get after delete: err = %v, want ErrNotExist", err)
+	}
+	if err := local.Delete(ctx, key); err != nil {
+		t.Errorf("Delete missing file: %v", err)
+	}
+}
+
+func TestLocalGetRange(t *testing.T) {
+	local, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocal: %v", err)
+	}
+	ctx := context.Background()
+	if err := local.Put(ctx, "range.txt", strings.NewReader("0123456789"), 10, ""); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	reader, err := local.GetRange(ctx, "range.txt", 3, 4)
+	if got := readAll(t, reader, err); got != "3456" {
+		t.Errorf("GetRange = %q, want 3456", got)
+	}
+
+	reader, err = local.GetRange(ctx, "range.txt", 8, 10)
+	if got := readAll(t, reader, err); got != "89" {
+		t.Errorf("GetRange past end = %q, want 89", got)
+	}
+
+	if _, err := local.GetRange(ctx, "missing.txt", 0, 1); !errors.Is(err, ErrNotExist) {
+		t.Errorf("GetRange missing: err = %v, want ErrNotExist", err)
+	}
+}
+
+func TestLocalKeysStayInsideRoot(t *testing.T) {
+	parent := t.TempDir()
+	root := filepath.Join(parent, "uploads")
+	local, err := NewLocal(root)
+	if err != nil {
+		t.Fatalf("NewLocal: %v", err)
+	}
+	ctx := context.Background()
+
+	if err := local.Put(ctx, "../../escape.txt", strings.NewReader("x"), 1, ""); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(parent, "escape.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("file was written outside the root: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "escape.txt")); err != nil {
+		t.Errorf("file was not written inside the root: %v", err)
+	}
+
+	for _, key := range []string{"", "/", ".."} {
+		if err := local.Put(ctx, key, strings.NewReader("x"), 1, ""); err == nil {
+			t.Errorf("Put(%q) succeeded, want error", key)
+		}
+	}
+}
+
+func TestLocalList(t *testing.T) {
+	local, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocal: %v", err)
+	}
+	ctx := context.Background()
+
+	keys := []string{"1/a.png", "10/b.png", "blobs/aa/bb/1", "blobs/cc/dd/2", "thumbnails/aa/1/thumb.jpg"}
+	for _, key := range keys {
+		if err := local.Put(ctx, key, strings.NewReader(key), int64(len(key)), ""); err != nil {
+			t.Fatalf("Put %s: %v", key, err)
+		}
+	}
+
+	list := func(prefix string) []string {
+		var listed []string
+		err := local.List(ctx, prefix, func(info ObjectInfo) error {
+			if info.Size != int64(len(info.Key)) {
+				t.Errorf("List info = %+v", info)
+			}
+			listed = append(listed, info.Key)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("List(%q): %v", prefix, err)
+		}
+		sort.Strings(listed)
+		return listed
+	}
+
+	if got := list(""); strings.Join(got, ",") != strings.Join(keys, ",") {
+		t.Errorf("List all = %v", got)
+	}
+	if got := list("blobs/"); strings.Join(got, ",") != "blobs/aa/bb/1,blobs/cc/dd/2" {
+		t.Errorf("List blobs/ = %v", got)
+	}
+	if got := list("1/"); strings.Join(got, ",") != "1/a.png" {
+		t.Errorf("List 1/ = %v", got)
+	}
+	if got := list("missing/"); len(got) != 0 {
+		t.Errorf("List missing/ = %v", got)
+	}
+
+	// fn返回的错误会中止遍历
+	stop := errors.New("stop")
+	count := 0
+	err = local.List(ctx, "", func(info ObjectInfo) error {
+		count++
+		return stop
+	})
+	if !errors.Is(err, stop) || count != 1 {
+		t.Errorf("List with stop: err = %v, count = %d", err, count)
+	}
+}
+
+func TestLocalPresignNotSupported(t *testing.T) {
+	local, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocal: %v", err)
+	}
+	if _, err := local.Presign(context.Background(), "1/a.png", time.Minute); !errors.Is(err, ErrPresignNotSupported) {
+		t.Errorf("Presign: err = %v, want ErrPresignNotSupported", err)
+	}
+}
@@ -0,0 +1,434 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3Object 模拟存储中的对象
+type fakeS3Object struct {
+	data        []byte
+	contentType string
+	modTime     time.Time
+}
+
+// fakeS3 用 httptest 模拟的S3服务，只支持测试用到的路径风格请求，并校验每个请求的签名
+type fakeS3 struct {
+	t        *testing.T
+	bucket   string
+	signer   *S3  // 使用相同的密钥重新计算签名
+	pageSize int  // ListObjectsV2 每页返回的对象数量
+	noRange  bool // 模拟不支持Range请求的服务
+
+	mu        sync.Mutex
+	objects   map[string]fakeS3Object
+	listPages int
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *S3) {
+	t.Helper()
+
+	fake := &fakeS3{t: t, bucket: "notes", pageSize: 2, objects: make(map[string]fakeS3Object)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	client, err := NewS3(S3Options{
+		Endpoint:     server.URL,
+		Region:       "test-region",
+		Bucket:       fake.bucket,
+		AccessKey:    "test-access",
+		SecretKey:    "test-secret",
+		UsePathStyle: true,
+	})
+	if err != nil {
+		t.Fatalf("NewS3: %v", err)
+	}
+	fake.signer = client
+	return fake, client
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := f.verify(r); err != nil {
+		f.t.Errorf("%s %s: %v", r.Method, r.URL, err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	bucketPath := "/" + f.bucket
+	if r.URL.Path == bucketPath && r.Method == http.MethodGet {
+		f.list(w, r)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, bucketPath+"/") {
+		http.Error(w, "unknown bucket", http.StatusBadRequest)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, bucketPath+"/")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.ContentLength != int64(len(data)) {
+			f.t.Errorf("PUT %s: Content-Length %d, body %d bytes", key, r.ContentLength, len(data))
+		}
+		f.objects[key] = fakeS3Object{data: data, contentType: r.Header.Get("Content-Type"), modTime: time.Now().UTC().Truncate(time.Second)}
+	case http.MethodGet, http.MethodHead:
+		object, ok := f.objects[key]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", object.contentType)
+		w.Header().Set("Last-Modified", object.modTime.Format(http.TimeFormat))
+		data := object.data
+		status := http.StatusOK
+		var start, end int
+		if rangeHeader := r.Header.Get("Range"); rangeHeader != "" && !f.noRange {
+			if _, err := fmt.Sscanf(rangeHeader, "bytes=%d-%d", &start, &end); err != nil {
+				http.Error(w, "bad range", http.StatusBadRequest)
+				return
+			}
+			if end >= len(data) {
+				end = len(data) - 1
+			}
+			data = data[start : end+1]
+			status = http.StatusPartialContent
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+		w.WriteHeader(status)
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "unsupported method", http.StatusMethodNotAllowed)
+	}
+}
+
+// list 按键排序分页返回对象，continuation-token 为上一页的最后一个键
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("list-type") != "2" {
+		http.Error(w, "only ListObjectsV2 is supported", http.StatusBadRequest)
+		return
+	}
+	prefix := query.Get("prefix")
+	after := query.Get("continuation-token")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.listPages++
+
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, prefix) && key > after {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var result listObjectsResult
+	if len(keys) > f.pageSize {
+		keys = keys[:f.pageSize]
+		result.IsTruncated = true
+		result.NextContinuationToken = keys[len(keys)-1]
+	}
+	for _, key := range keys {
+		object := f.objects[key]
+		result.Contents = append(result.Contents, struct {
+			Key          string    `xml:"Key"`
+			LastModified time.Time `xml:"LastModified"`
+			Size         int64     `xml:"Size"`
+		}{key, object.modTime, int64(len(object.data))})
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
+
+// verify 按收到的请求重新构建规范请求并校验签名，覆盖请求头签名和预签名URL两种方式
+func (f *fakeS3) verify(r *http.Request) error {
+	query := r.URL.Query()
+	if signature := query.Get("X-Amz-Signature"); signature != "" {
+		now, err := time.Parse("20060102T150405Z", query.Get("X-Amz-Date"))
+		if err != nil {
+			return fmt.Errorf("invalid X-Amz-Date: %v", err)
+		}
+		if query.Get("X-Amz-Credential") != "test-access/"+f.signer.scope(now) {
+			return fmt.Errorf("unexpected credential %q", query.Get("X-Amz-Credential"))
+		}
+		query.Del("X-Amz-Signature")
+		canonicalRequest := strings.Join([]string{
+			r.Method,
+			r.URL.EscapedPath(),
+			canonicalQuery(query),
+			"host:" + r.Host + "\n",
+			"host",
+			unsignedPayload,
+		}, "\n")
+		if expected := f.signer.signature(now, canonicalRequest); signature != expected {
+			return errors.New("presigned URL signature mismatch")
+		}
+		return nil
+	}
+
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 ") {
+		return fmt.Errorf("missing Authorization header")
+	}
+	fields := make(map[string]string)
+	for _, part := range strings.Split(strings.TrimPrefix(auth, "AWS4-HMAC-SHA256 "), ", ") {
+		if name, value, ok := strings.Cut(part, "="); ok {
+			fields[name] = value
+		}
+	}
+	now, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return fmt.Errorf("invalid X-Amz-Date: %v", err)
+	}
+	if fields["Credential"] != "test-access/"+f.signer.scope(now) {
+		return fmt.Errorf("unexpected credential %q", fields["Credential"])
+	}
+
+	var headers strings.Builder
+	for _, name := range strings.Split(fields["SignedHeaders"], ";") {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		headers.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		canonicalQuery(query),
+		headers.String(),
+		fields["SignedHeaders"],
+		r.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+	if fields["Signature"] != f.signer.signature(now, canonicalRequest) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+func readAll(t *testing.T, r io.ReadCloser, err error) string {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return string(data)
+}
+
+func TestS3PutGetStatDelete(t *testing.T) {
+	fake, s3 := newFakeS3(t)
+	ctx := context.Background()
+	key := "blobs/ab/cd/测试 file+1.txt"
+
+	if err := s3.Put(ctx, key, strings.NewReader("hello world"), 11, "text/plain"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if got := fake.objects[key]; string(got.data) != "hello world" || got.contentType != "text/plain" {
+		t.Fatalf("stored object = %q (%s)", got.data, got.contentType)
+	}
+
+	reader, err := s3.Get(ctx, key)
+	if got := readAll(t, reader, err); got != "hello world" {
+		t.Errorf("Get = %q", got)
+	}
+
+	info, err := s3.Stat(ctx, key)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Key != key || info.Size != 11 || info.ContentType != "text/plain" || info.ModTime.IsZero() {
+		t.Errorf("Stat = %+v", info)
+	}
+
+	if err := s3.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s3.Stat(ctx, key); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Stat after delete: err = %v, want ErrNotExist", err)
+	}
+	if _, err := s3.Get(ctx, key); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Get after delete: err = %v, want ErrNotExist", err)
+	}
+	if err := s3.Delete(ctx, key); err != nil {
+		t.Errorf("Delete missing object: %v", err)
+	}
+}
+
+func TestS3PutUnknownSize(t *testing.T) {
+	fake, s3 := newFakeS3(t)
+	ctx := context.Background()
+
+	// 长度未知时先写入临时文件，请求仍需带上正确的 Content-Length
+	if err := s3.Put(ctx, "1/unknown.bin", io.MultiReader(strings.NewReader("abc"), strings.NewReader("def")), -1, ""); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if got := string(fake.objects["1/unknown.bin"].data); got != "abcdef" {
+		t.Errorf("stored = %q", got)
+	}
+
+	if err := s3.Put(ctx, "1/empty.bin", bytes.NewReader(nil), 0, ""); err != nil {
+		t.Fatalf("Put empty: %v", err)
+	}
+	if object, ok := fake.objects["1/empty.bin"]; !ok || len(object.data) != 0 {
+		t.Errorf("empty object = %+v, %v", object, ok)
+	}
+}
+
+func TestS3GetRange(t *testing.T) {
+	fake, s3 := newFakeS3(t)
+	ctx := context.Background()
+	if err := s3.Put(ctx, "range.txt", strings.NewReader("0123456789"), 10, "text/plain"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	reader, err := s3.GetRange(ctx, "range.txt", 3, 4)
+	if got := readAll(t, reader, err); got != "3456" {
+		t.Errorf("GetRange = %q, want 3456", got)
+	}
+
+	reader, err = s3.GetRange(ctx, "range.txt", 3, 0)
+	if got := readAll(t, reader, err); got != "" {
+		t.Errorf("GetRange with zero length = %q", got)
+	}
+
+	// 服务忽略Range头时跳过多余的内容
+	fake.noRange = true
+	reader, err = s3.GetRange(ctx, "range.txt", 6, 3)
+	if got := readAll(t, reader, err); got != "678" {
+		t.Errorf("GetRange without range support = %q, want 678", got)
+	}
+
+	if _, err := s3.GetRange(ctx, "missing.txt", 0, 1); !errors.Is(err, ErrNotExist) {
+		t.Errorf("GetRange missing: err = %v, want ErrNotExist", err)
+	}
+}
+
+func TestS3ListPagination(t *testing.T) {
+	fake, s3 := newFakeS3(t)
+	ctx := context.Background()
+
+	keys := []string{"blobs/aa/1", "blobs/aa/2", "blobs/bb/3", "blobs/cc/4", "blobs/cc/5", "thumbnails/aa/1/thumb.jpg"}
+	for _, key := range keys {
+		if err := s3.Put(ctx, key, strings.NewReader(key), int64(len(key)), ""); err != nil {
+			t.Fatalf("Put %s: %v", key, err)
+		}
+	}
+
+	var listed []string
+	err := s3.List(ctx, "blobs/", func(info ObjectInfo) error {
+		if info.Size != int64(len(info.Key)) || info.ModTime.IsZero() {
+			t.Errorf("List info = %+v", info)
+		}
+		listed = append(listed, info.Key)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if want := keys[:5]; strings.Join(listed, ",") != strings.Join(want, ",") {
+		t.Errorf("List = %v, want %v", listed, want)
+	}
+	if fake.listPages != 3 {
+		t.Errorf("List requested %d pages, want 3", fake.listPages)
+	}
+
+	// fn返回的错误会中止遍历
+	stop := errors.New("stop")
+	count := 0
+	err = s3.List(ctx, "", func(info ObjectInfo) error {
+		count++
+		return stop
+	})
+	if !errors.Is(err, stop) || count != 1 {
+		t.Errorf("List with stop: err = %v, count = %d", err, count)
+	}
+}
+
+func TestS3Presign(t *testing.T) {
+	_, s3 := newFakeS3(t)
+	ctx := context.Background()
+	key := "blobs/ab/cd/中文 名称.png"
+	if err := s3.Put(ctx, key, strings.NewReader("image"), 5, "image/png"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	signed, err := s3.Presign(ctx, key, 15*time.Minute)
+	if err != nil {
+		t.Fatalf("Presign: %v", err)
+	}
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatalf("parse presigned URL: %v", err)
+	}
+	if got := u.Query().Get("X-Amz-Expires"); got != "900" {
+		t.Errorf("X-Amz-Expires = %s, want 900", got)
+	}
+
+	// 预签名URL不带任何请求头即可下载
+	resp, err := http.Get(signed)
+	if err != nil {
+		t.Fatalf("GET presigned URL: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "image" {
+		t.Errorf("GET presigned URL = %d %q", resp.StatusCode, body)
+	}
+
+	// 超出上限的有效期按7天处理
+	signed, err = s3.Presign(ctx, key, 30*24*time.Hour)
+	if err != nil {
+		t.Fatalf("Presign: %v", err)
+	}
+	if u, _ := url.Parse(signed); u.Query().Get("X-Amz-Expires") != "604800" {
+		t.Errorf("X-Amz-Expires = %s, want 604800", u.Query().Get("X-Amz-Expires"))
+	}
+}
+
+func TestS3VirtualHostedURL(t *testing.T) {
+	s3, err := NewS3(S3Options{Endpoint: "https://s3.example.com/", Bucket: "notes"})
+	if err != nil {
+		t.Fatalf("NewS3: %v", err)
+	}
+	if got := s3.objectURL("1/a b.png").String(); got != "https://notes.s3.example.com/1/a%20b.png" {
+		t.Errorf("objectURL = %s", got)
+	}
+	if got := s3.bucketURL().String(); got != "https://notes.s3.example.com/" {
+		t.Errorf("bucketURL = %s", got)
+	}
+
+	if _, err := NewS3(S3Options{Endpoint: "s3.example.com", Bucket: "notes"}); err == nil {
+		t.Error("NewS3 accepted an endpoint without scheme")
+	}
+}
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"cyi-note/backend/config"
+)
+
+// ErrNotExist 对象不存在
+var ErrNotExist = errors.New("对象不存在")
+
+// ErrPresignNotSupported 存储后端不支持生成预签名URL
+var ErrPresignNotSupported = errors.New("存储后端不支持预签名URL")
+
+// ObjectInfo 存储对象信息
+type ObjectInfo struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// Storage 附件存储后端
+// key 使用 / 分隔的相对路径，例如 1/1_1700000000_abcdef.png
+type Storage interface {
+	// Put 写入对象，size 为 -1 时表示长度未知
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get 读取对象，对象不存在时返回 ErrNotExist
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// GetRange 读取对象从offset开始的length个字节，对象不存在时返回 ErrNotExist
+	GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	// Delete 删除对象，对象不存在时不返回错误
+	Delete(ctx context.Context, key string) error
+	// Stat 获取对象信息，对象不存在时返回 ErrNotExist
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	// Presign 生成可直接下载对象的限时URL，不支持时返回 ErrPresignNotSupported
+	Presign(ctx context.Context, key string, expiry time.Duration) (string, error)
+	// List 遍历键以prefix开头的所有对象，fn返回错误时停止遍历并返回该错误
+	List(ctx context.Context, prefix string, fn func(info ObjectInfo) error) error
+}
+
+// 当前使用的存储后端
+var current Storage
+
+// Init 按配置初始化存储后端
+func Init(cfg *config.Config) error {
+	backend, err := New(cfg, cfg.StorageBackend)
+	if err != nil {
+		return err
+	}
+	current = backend
+	return nil
+}
+
+// Current 获取当前使用的存储后端
+func Current() Storage {
+	return current
+}
+
+// New 按名称创建存储后端：local 或 s3
+func New(cfg *config.Config, name string) (Storage, error) {
+	switch name {
+	case "", "local":
+		return NewLocal(cfg.UploadDir)
+	case "s3":
+		return NewS3(S3Options{
+			Endpoint:     cfg.S3.Endpoint,
+			Region:       cfg.S3.Region,
+			Bucket:       cfg.S3.Bucket,
+			AccessKey:    cfg.S3.AccessKey,
+			SecretKey:    cfg.S3.SecretKey,
+			UsePathStyle: cfg.S3.UsePathStyle,
+		})
+	default:
+		return nil, fmt.Errorf("不支持的存储后端: %s", name)
+	}
+}
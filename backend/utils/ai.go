@@ -1,9 +1,15 @@
 package utils
 
 import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
 	"strings"
+	"unicode/utf8"
 	
 	"github.com/go-ego/gse"
+	"golang.org/x/net/html"
 )
 
 // 中文分词器
@@ -16,7 +22,57 @@ func init() {
 	segmenter.LoadDict()
 }
 
+// KeywordScore 关键词及其得分
+type KeywordScore struct {
+	Word  string  `json:"word"`
+	Count int     `json:"count"` // 出现次数
+	Score float64 `json:"score"` // 相对得分，出现最多的词为1
+}
+
+// ExtractKeywordScores 从文本中提取出现次数最多的limit个关键词
+func ExtractKeywordScores(content string, limit int) []KeywordScore {
+	// 如果内容为空，返回空结果
+	if strings.TrimSpace(content) == "" {
+		return []KeywordScore{}
+	}
+	
+	// 分词（已过滤标点和单字符词）
+	segments := Tokenize(content)
+	
+	// 统计词频
+	wordFreq := make(map[string]int)
+	var order []string
+	for _, word := range segments {
+		if wordFreq[word] == 0 {
+			order = append(order, word)
+		}
+		wordFreq[word]++
+	}
+	
+	// 按词频排序，词频相同时保持出现顺序
+	sort.SliceStable(order, func(i, j int) bool {
+		return wordFreq[order[i]] > wordFreq[order[j]]
+	})
+	
+	if limit > 0 && len(order) > limit {
+		order = order[:limit]
+	}
+	
+	keywords := make([]KeywordScore, 0, len(order))
+	for _, word := range order {
+		keywords = append(keywords, KeywordScore{
+			Word:  word,
+			Count: wordFreq[word],
+			Score: float64(wordFreq[word]) / float64(wordFreq[order[0]]),
+		})
+	}
+	
+	return keywords
+}
+
 // ExtractKeywords 从文本中提取关键词作为标签
+// 保持 /api/ai/tags 原有的结果：保留原始大小写，只过滤少于2个字节的词；
+// 标签建议使用的 ExtractKeywordScores 另外做了小写化和标点过滤
 func ExtractKeywords(content string) ([]string, error) {
 	// 简单实现：使用分词器提取关键词
 	// 在实际应用中，可以使用更复杂的算法或调用外部API
@@ -31,40 +87,72 @@ func ExtractKeywords(content string) ([]string, error) {
 	
 	// 统计词频
 	wordFreq := make(map[string]int)
+	var order []string
 	for _, word := range segments {
 		// 过滤掉小于2个字符的词
 		if len(word) < 2 {
 			continue
 		}
+		if wordFreq[word] == 0 {
+			order = append(order, word)
+		}
 		wordFreq[word]++
 	}
 	
-	// 按词频排序
-	type wordCount struct {
-		word  string
-		count int
+	// 按词频排序，词频相同时保持出现顺序
+	sort.SliceStable(order, func(i, j int) bool {
+		return wordFreq[order[i]] > wordFreq[order[j]]
+	})
+	
+	// 取前10个词作为标签
+	if len(order) > 10 {
+		order = order[:10]
+	}
+	
+	return order, nil
+}
+
+// IsMaterialChange 判断笔记内容是否发生了实质性变化
+// 分词后的词集合相似度低于90%，或长度变化超过20%时视为实质性变化
+func IsMaterialChange(oldContent, newContent string) bool {
+	if oldContent == newContent {
+		return false
+	}
+	
+	oldLen, newLen := len(oldContent), len(newContent)
+	maxLen := oldLen
+	if newLen > maxLen {
+		maxLen = newLen
 	}
-	var wordCounts []wordCount
-	for word, count := range wordFreq {
-		wordCounts = append(wordCounts, wordCount{word, count})
+	diff := oldLen - newLen
+	if diff < 0 {
+		diff = -diff
+	}
+	if maxLen == 0 || float64(diff)/float64(maxLen) > 0.2 {
+		return true
 	}
 	
-	// 简单排序
-	for i := 0; i < len(wordCounts); i++ {
-		for j := i + 1; j < len(wordCounts); j++ {
-			if wordCounts[i].count < wordCounts[j].count {
-				wordCounts[i], wordCounts[j] = wordCounts[j], wordCounts[i]
-			}
-		}
+	oldTokens := make(map[string]bool)
+	for _, token := range Tokenize(oldContent) {
+		oldTokens[token] = true
+	}
+	newTokens := make(map[string]bool)
+	for _, token := range Tokenize(newContent) {
+		newTokens[token] = true
 	}
 	
-	// 取前10个词作为标签
-	var tags []string
-	for i := 0; i < len(wordCounts) && i < 10; i++ {
-		tags = append(tags, wordCounts[i].word)
+	intersection := 0
+	for token := range newTokens {
+		if oldTokens[token] {
+			intersection++
+		}
+	}
+	union := len(oldTokens) + len(newTokens) - intersection
+	if union == 0 {
+		return false
 	}
 	
-	return tags, nil
+	return float64(intersection)/float64(union) < 0.9
 }
 
 // GenerateSummary 生成文本摘要
@@ -89,30 +177,219 @@ func GenerateSummary(content string) (string, error) {
 	return content, nil
 }
 
-// GenerateTagSuggestions 生成标签建议（实际上是 ExtractKeywords 的别名）
-func GenerateTagSuggestions(content string) ([]string, error) {
-	return ExtractKeywords(content)
+// 摘要的最大长度（与Note.Summary字段长度一致）
+const maxSummaryRunes = 500
+
+// SummarizeWithModel 使用大模型生成摘要，未配置大模型时退回到截取前200个字符
+func SummarizeWithModel(ctx context.Context, client *ChatClient, content string) (string, error) {
+	if !client.Enabled() {
+		return GenerateSummary(content)
+	}
+	
+	if strings.TrimSpace(content) == "" {
+		return "", nil
+	}
+	
+	summary, err := client.Complete(ctx, []ChatMessage{
+		{Role: "system", Content: "你是一个笔记摘要助手。请用与原文相同的语言，将用户提供的笔记概括为不超过200字的一段摘要，只输出摘要本身。"},
+		{Role: "user", Content: RemoveHTMLTags(content)},
+	})
+	if err != nil {
+		return "", err
+	}
+	
+	summary = strings.TrimSpace(summary)
+	if utf8.RuneCountInString(summary) > maxSummaryRunes {
+		summary = string([]rune(summary)[:maxSummaryRunes])
+	}
+	
+	return summary, nil
 }
 
-// RemoveHTMLTags 移除HTML标签
-func RemoveHTMLTags(content string) string {
-	// 简单实现：移除所有<>之间的内容
-	inTag := false
-	var result strings.Builder
+// ExistingTag 参与标签建议排序的已有标签
+type ExistingTag struct {
+	ID        uint
+	Name      string
+	NoteCount int64 // 用户使用该标签的笔记数量
+}
+
+// TagSuggestion 标签建议
+type TagSuggestion struct {
+	Name         string   `json:"name"`
+	TagID        uint     `json:"tag_id,omitempty"` // 已有标签的ID
+	Existing     bool     `json:"existing"`
+	Score        float64  `json:"score"`
+	MatchedTerms []string `json:"matched_terms"` // 内容中命中的词
+	Reason       string   `json:"reason"`        // 建议理由
+}
+
+// containsPhrase 检查内容中是否包含完整的词组
+// 词组以英文字母或数字开头（结尾）时，前（后）一个字符不能也是英文字母或数字，避免 go 匹配 good
+func containsPhrase(content, phrase string) bool {
+	for offset := 0; ; {
+		i := strings.Index(content[offset:], phrase)
+		if i < 0 {
+			return false
+		}
+		start := offset + i
+		end := start + len(phrase)
+		first, _ := utf8.DecodeRuneInString(phrase)
+		last, _ := utf8.DecodeLastRuneInString(phrase)
+		before, _ := utf8.DecodeLastRuneInString(content[:start])
+		after, _ := utf8.DecodeRuneInString(content[end:])
+		if !(isASCIIWordRune(first) && isASCIIWordRune(before)) && !(isASCIIWordRune(last) && isASCIIWordRune(after)) {
+			return true
+		}
+		_, size := utf8.DecodeRuneInString(content[start:])
+		offset = start + size
+	}
+}
+
+// isASCIIWordRune 是否为英文字母、数字或下划线
+func isASCIIWordRune(r rune) bool {
+	return r < utf8.RuneSelf && (r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z')
+}
+
+// GenerateTagSuggestions 根据内容生成标签建议
+// 优先匹配已有标签（标签分词后在内容中出现），其余高频关键词作为新标签建议
+func GenerateTagSuggestions(content string, existingTags []ExistingTag, limit int) []TagSuggestion {
+	if limit <= 0 {
+		limit = 10
+	}
+	
+	keywords := ExtractKeywordScores(content, 0)
+	if len(keywords) == 0 {
+		return []TagSuggestion{}
+	}
+	keywordScores := make(map[string]KeywordScore, len(keywords))
+	for _, keyword := range keywords {
+		keywordScores[keyword.Word] = keyword
+	}
+	lowerContent := strings.ToLower(content)
 	
-	for _, r := range content {
-		if r == '<' {
-			inTag = true
+	var existing []TagSuggestion
+	coveredWords := make(map[string]bool)
+	for _, tag := range existingTags {
+		name := strings.ToLower(strings.TrimSpace(tag.Name))
+		if name == "" {
 			continue
 		}
-		if r == '>' {
-			inTag = false
+		
+		// 标签分词后在内容中命中的词
+		tagTokens := Tokenize(name)
+		if len(tagTokens) == 0 {
+			tagTokens = []string{name}
+		}
+		var matched []string
+		best := 0.0
+		for _, token := range tagTokens {
+			if keyword, ok := keywordScores[token]; ok {
+				matched = append(matched, token)
+				if keyword.Score > best {
+					best = keyword.Score
+				}
+			}
+		}
+		
+		// 标签整体出现在内容中
+		phrase := containsPhrase(lowerContent, name)
+		if len(matched) == 0 && !phrase {
 			continue
 		}
-		if !inTag {
-			result.WriteRune(r)
+		if phrase && len(matched) == 0 {
+			matched = []string{name}
+			best = 1.0 / float64(len(keywords))
+		}
+		
+		// 得分：命中比例 × 词频得分，整体命中和常用标签加权
+		coverage := float64(len(matched)) / float64(len(tagTokens))
+		score := coverage * (0.5 + 0.5*best)
+		if phrase {
+			score += 0.5
+		}
+		score *= 1 + 0.1*math.Log1p(float64(tag.NoteCount))
+		
+		for _, word := range matched {
+			coveredWords[word] = true
 		}
+		coveredWords[name] = true
+		
+		existing = append(existing, TagSuggestion{
+			Name:         tag.Name,
+			TagID:        tag.ID,
+			Existing:     true,
+			Score:        math.Round(score*1000) / 1000,
+			MatchedTerms: matched,
+			Reason:       describeMatch(matched, keywordScores, phrase),
+		})
 	}
 	
-	return result.String()
-} 
\ No newline at end of file
+	// 未被已有标签覆盖的高频关键词作为新标签
+	var created []TagSuggestion
+	for _, keyword := range keywords {
+		if coveredWords[keyword.Word] {
+			continue
+		}
+		created = append(created, TagSuggestion{
+			Name:         keyword.Word,
+			Score:        math.Round(keyword.Score*1000) / 1000,
+			MatchedTerms: []string{keyword.Word},
+			Reason:       describeMatch([]string{keyword.Word}, keywordScores, false),
+		})
+	}
+	
+	sort.SliceStable(existing, func(i, j int) bool {
+		return existing[i].Score > existing[j].Score
+	})
+	
+	suggestions := append(existing, created...)
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions
+}
+
+// describeMatch 生成标签建议的理由说明
+func describeMatch(matched []string, keywordScores map[string]KeywordScore, phrase bool) string {
+	parts := make([]string, 0, len(matched))
+	for _, word := range matched {
+		if keyword, ok := keywordScores[word]; ok {
+			parts = append(parts, fmt.Sprintf("“%s”出现%d次", word, keyword.Count))
+		} else {
+			parts = append(parts, fmt.Sprintf("“%s”", word))
+		}
+	}
+	
+	reason := "内容中" + strings.Join(parts, "，")
+	if phrase {
+		reason += "，完整包含标签名称"
+	}
+	return reason
+}
+
+// RemoveHTMLTags 移除HTML标签，只保留文本内容
+// 实体会被解码，脚本和样式的内容会被丢弃
+func RemoveHTMLTags(content string) string {
+	tokenizer := html.NewTokenizer(strings.NewReader(content))
+	var result strings.Builder
+	skipping := ""
+	
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return result.String()
+		case html.TextToken:
+			if skipping == "" {
+				result.Write(tokenizer.Text())
+			}
+		case html.StartTagToken:
+			if name, _ := tokenizer.TagName(); skipping == "" && (string(name) == "script" || string(name) == "style") {
+				skipping = string(name)
+			}
+		case html.EndTagToken:
+			if name, _ := tokenizer.TagName(); string(name) == skipping {
+				skipping = ""
+			}
+		}
+	}
+}
\ No newline at end of file
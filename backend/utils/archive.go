@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"unicode"
+)
+
+// ArchiveNamer 为打包下载的文件生成不重复的文件名
+type ArchiveNamer struct {
+	used map[string]bool
+}
+
+// NewArchiveNamer 创建文件名生成器
+func NewArchiveNamer() *ArchiveNamer {
+	return &ArchiveNamer{used: make(map[string]bool)}
+}
+
+// Name 返回可以安全写入ZIP的文件名
+// 与已使用的名称重复时（不区分大小写）在扩展名前添加序号，例如 a (1).png
+func (n *ArchiveNamer) Name(filename string) string {
+	filename = SafeArchiveName(filename)
+	ext := path.Ext(filename)
+	base := strings.TrimSuffix(filename, ext)
+
+	name := filename
+	for i := 1; n.used[strings.ToLower(name)]; i++ {
+		name = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+	n.used[strings.ToLower(name)] = true
+	return name
+}
+
+// SafeArchiveName 将文件名中的路径分隔符、控制字符等替换为下划线，为空时返回 file
+func SafeArchiveName(filename string) string {
+	filename = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, filename)
+	filename = strings.TrimSpace(filename)
+
+	if strings.Trim(filename, ".") == "" {
+		return "file"
+	}
+	return filename
+}
+
+// IsCompressedType 检查文件类型是否已经压缩，打包时无需再次压缩
+func IsCompressedType(contentType string) bool {
+	contentType = baseContentType(contentType)
+	switch {
+	case strings.HasPrefix(contentType, "image/") && contentType != "image/bmp" && contentType != "image/svg+xml":
+		return true
+	case strings.HasPrefix(contentType, "video/"), strings.HasPrefix(contentType, "audio/"):
+		return true
+	}
+	switch contentType {
+	case "application/zip", "application/gzip", "application/x-7z-compressed", "application/x-rar-compressed",
+		"application/pdf", docxContentType, xlsxContentType, pptxContentType:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestArchiveNamer(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		want  []string
+	}{
+		{
+			name:  "不重复的名称保持不变",
+			files: []string{"a.png", "b.png", "说明.txt"},
+			want:  []string{"a.png", "b.png", "说明.txt"},
+		},
+		{
+			name:  "重复时在扩展名前添加序号",
+			files: []string{"a.png", "a.png", "a.png"},
+			want:  []string{"a.png", "a (1).png", "a (2).png"},
+		},
+		{
+			name:  "不区分大小写",
+			files: []string{"Report.PDF", "report.pdf"},
+			want:  []string{"Report.PDF", "report (1).pdf"},
+		},
+		{
+			name:  "跳过已使用的序号",
+			files: []string{"a (1).png", "a.png", "a.png"},
+			want:  []string{"a (1).png", "a.png", "a (2).png"},
+		},
+		{
+			name:  "没有扩展名",
+			files: []string{"README", "README"},
+			want:  []string{"README", "README (1)"},
+		},
+		{
+			name:  "先替换不安全的字符再去重",
+			files: []string{"a/b.txt", "a:b.txt", "", ".."},
+			want:  []string{"a_b.txt", "a_b (1).txt", "file", "file (1)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			namer := NewArchiveNamer()
+			var got []string
+			for _, file := range tt.files {
+				got = append(got, namer.Name(file))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Name = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSafeArchiveName(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"笔记.md", "笔记.md"},
+		{"../../etc/passwd", ".._.._etc_passwd"},
+		{`C:\Users\a.txt`, "C__Users_a.txt"},
+		{"a\x00b\nc.txt", "a_b_c.txt"},
+		{`what?<>|"*.txt`, "what______.txt"},
+		{"  空格  ", "空格"},
+		{"...", "file"},
+		{"", "file"},
+	}
+
+	for _, tt := range tests {
+		if got := SafeArchiveName(tt.input); got != tt.want {
+			t.Errorf("SafeArchiveName(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package utils
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// enexSelfClosingPattern 自闭合的 en-todo、en-media 元素，HTML解析器不识别自闭合的自定义元素，会把之后的内容当作其子节点
+var enexSelfClosingPattern = regexp.MustCompile(`<(en-todo|en-media)(\s[^>]*?)?\s*/>`)
+
+// enexExtensions 常见资源类型的扩展名，其他类型使用 mime.ExtensionsByType 的结果
+var enexExtensions = map[string]string{
+	"text/plain":      ".txt",
+	"image/jpeg":      ".jpg",
+	"application/pdf": ".pdf",
+	"audio/mpeg":      ".mp3",
+}
+
+// enexNote ENEX文件中的一篇笔记
+type enexNote struct {
+	Title     string         `xml:"title"`
+	Content   string         `xml:"content"`
+	Created   string         `xml:"created"`
+	Tags      []string       `xml:"tag"`
+	Resources []enexResource `xml:"resource"`
+}
+
+// enexResource 笔记中嵌入的资源（图片、附件）
+type enexResource struct {
+	Data struct {
+		Encoding string `xml:"encoding,attr"`
+		Value    string `xml:",chardata"`
+	} `xml:"data"`
+	Mime       string `xml:"mime"`
+	Attributes struct {
+		FileName string `xml:"file-name"`
+	} `xml:"resource-attributes"`
+}
+
+// ParseEnex 解析印象笔记/Evernote导出的ENEX文件
+// 笔记内容（ENML）转换为Markdown，标签和创建时间保留；嵌入的资源解码后保存到dir中，作为笔记的附件导入
+// 调用方在导入完成后负责删除dir
+func ParseEnex(r io.Reader, dir string) ([]ImportedNote, []ImportIssue, error) {
+	decoder := xml.NewDecoder(r)
+	decoder.Strict = false
+
+	var notes []ImportedNote
+	var issues []ImportIssue
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, issues, fmt.Errorf("解析ENEX文件失败: %v", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "note" {
+			continue
+		}
+
+		var source enexNote
+		if err := decoder.DecodeElement(&source, &start); err != nil {
+			return nil, issues, fmt.Errorf("解析ENEX文件失败: %v", err)
+		}
+		note, noteIssues, err := convertEnexNote(&source, len(notes)+1, dir)
+		if err != nil {
+			return nil, issues, err
+		}
+		notes = append(notes, note)
+		issues = append(issues, noteIssues...)
+	}
+
+	if len(notes) == 0 {
+		return nil, issues, ErrNothingToImport
+	}
+	return notes, issues, nil
+}
+
+// convertEnexNote 转换一篇ENEX笔记，index为笔记在文件中的序号
+func convertEnexNote(source *enexNote, index int, dir string) (ImportedNote, []ImportIssue, error) {
+	title := NormalizeImportTitle(source.Title, "")
+	note := ImportedNote{Path: fmt.Sprintf("%d. %s", index, title), Title: title}
+	var issues []ImportIssue
+
+	if created, err := time.Parse("20060102T150405Z", strings.TrimSpace(source.Created)); err == nil {
+		note.CreatedAt = created
+	}
+	for _, tag := range source.Tags {
+		note.addTag(tag)
+	}
+
+	// 解码资源，en-media 通过内容的MD5引用资源
+	resources := make(map[string]*ImportedFile)
+	var order []string
+	namer := NewArchiveNamer()
+	for i := range source.Resources {
+		resource := &source.Resources[i]
+		file, hash, err := saveEnexResource(resource, dir, namer)
+		if err != nil {
+			return note, issues, err
+		}
+		if file == nil {
+			issues = append(issues, ImportIssue{Path: note.Path, Reason: "无法解码嵌入的资源 " + resource.Attributes.FileName})
+			continue
+		}
+		file.Path = note.Path + "/" + file.Name
+		if _, ok := resources[hash]; !ok {
+			order = append(order, hash)
+		}
+		resources[hash] = file
+	}
+
+	used := make(map[string]bool)
+	converter := &htmlConverter{
+		media: func(n *html.Node) string {
+			hash := strings.ToLower(attr(n, "hash"))
+			file, ok := resources[hash]
+			if !ok {
+				issues = append(issues, ImportIssue{Path: note.Path, Reason: "未找到引用的资源 " + hash})
+				return ""
+			}
+			used[hash] = true
+			return enexMediaLink(file, strings.HasPrefix(attr(n, "type"), "image/"), note.addFile(file))
+		},
+		skipped: func(reason string) {
+			issues = append(issues, ImportIssue{Path: note.Path, Reason: reason})
+		},
+	}
+
+	root, err := html.Parse(strings.NewReader(enexSelfClosingPattern.ReplaceAllString(source.Content, "<$1$2></$1>")))
+	if err != nil {
+		issues = append(issues, ImportIssue{Path: note.Path, Reason: "无法解析笔记内容: " + err.Error()})
+		root = &html.Node{Type: html.DocumentNode}
+	}
+	content := converter.convert(root)
+
+	// 内容中没有引用的资源附加在笔记末尾
+	for _, hash := range order {
+		if !used[hash] {
+			file := resources[hash]
+			content += "\n" + enexMediaLink(file, isImageFile(file.Name), note.addFile(file)) + "\n"
+		}
+	}
+	note.Content = content
+	return note, issues, nil
+}
+
+// saveEnexResource 将资源解码保存到dir中，返回文件和内容的MD5；无法解码时返回nil
+func saveEnexResource(resource *enexResource, dir string, namer *ArchiveNamer) (*ImportedFile, string, error) {
+	if encoding := strings.TrimSpace(resource.Data.Encoding); encoding != "" && encoding != "base64" {
+		return nil, "", nil
+	}
+	encoded := strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\n' || r == '\r' {
+			return -1
+		}
+		return r
+	}, resource.Data.Value)
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(data) == 0 {
+		return nil, "", nil
+	}
+
+	temp, err := os.CreateTemp(dir, "resource_*")
+	if err != nil {
+		return nil, "", fmt.Errorf("保存资源失败: %v", err)
+	}
+	defer temp.Close()
+	if _, err := temp.Write(data); err != nil {
+		return nil, "", fmt.Errorf("保存资源失败: %v", err)
+	}
+
+	name := strings.TrimSpace(resource.Attributes.FileName)
+	if name == "" {
+		name = "附件"
+		mimeType := strings.ToLower(strings.TrimSpace(resource.Mime))
+		if ext, ok := enexExtensions[mimeType]; ok {
+			name += ext
+		} else if exts, _ := mime.ExtensionsByType(mimeType); len(exts) > 0 {
+			name += exts[0]
+		}
+	}
+	name = namer.Name(name)
+
+	sum := md5.Sum(data)
+	tempPath := temp.Name()
+	return &ImportedFile{
+		Name: name,
+		Size: int64(len(data)),
+		Open: func() (io.ReadCloser, error) {
+			return os.Open(tempPath)
+		},
+		Original: "#",
+	}, hex.EncodeToString(sum[:]), nil
+}
+
+// enexMediaLink 资源的Markdown链接，图片使用图片语法
+func enexMediaLink(file *ImportedFile, image bool, index int) string {
+	text := markdownEscapePattern.ReplaceAllString(file.Name, `\$1`)
+	if image {
+		return "![" + text + "](" + ImportFileRef(index) + ")"
+	}
+	return "[" + text + "](" + ImportFileRef(index) + ")"
+}
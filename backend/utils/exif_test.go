@@ -0,0 +1,236 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// exifSegment 生成只包含Orientation标签的APP1段
+func exifSegment(order binary.ByteOrder, orientation uint16) []byte {
+	tiff := make([]byte, 26)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 1)
+	order.PutUint16(tiff[10:], 0x0112)
+	order.PutUint16(tiff[12:], 3)
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint16(tiff[18:], orientation)
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// testJPEG 生成2x1的JPEG，并在SOI之后插入给定的段
+func testJPEG(t *testing.T, segments ...[]byte) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, color.White)
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	out := append([]byte{}, data[:2]...)
+	for _, segment := range segments {
+		out = append(out, segment...)
+	}
+	return append(out, data[2:]...)
+}
+
+func TestExifOrientation(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"小端", testJPEG(t, exifSegment(binary.LittleEndian, 6)), 6},
+		{"大端", testJPEG(t, exifSegment(binary.BigEndian, 8)), 8},
+		{"没有EXIF", testJPEG(t), 1},
+		{"超出范围的值", testJPEG(t, exifSegment(binary.LittleEndian, 9)), 1},
+		{"不是JPEG", []byte("\x89PNG\r\n\x1a\n"), 1},
+		{"截断的段", testJPEG(t, exifSegment(binary.BigEndian, 3))[:20], 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exifOrientation(tt.data); got != tt.want {
+				t.Errorf("exifOrientation = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyOrientation(t *testing.T) {
+	// 2x1的图片，左侧像素为白色
+	src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	src.Set(0, 0, color.White)
+
+	tests := []struct {
+		orientation int
+		size        image.Point
+		white       image.Point
+	}{
+		{1, image.Pt(2, 1), image.Pt(0, 0)},
+		{2, image.Pt(2, 1), image.Pt(1, 0)},
+		{3, image.Pt(2, 1), image.Pt(1, 0)},
+		{4, image.Pt(2, 1), image.Pt(0, 0)},
+		{5, image.Pt(1, 2), image.Pt(0, 0)},
+		{6, image.Pt(1, 2), image.Pt(0, 0)},
+		{7, image.Pt(1, 2), image.Pt(0, 1)},
+		{8, image.Pt(1, 2), image.Pt(0, 1)},
+	}
+
+	for _, tt := range tests {
+		dst := applyOrientation(src, tt.orientation)
+		if got := dst.Bounds().Size(); got != tt.size {
+			t.Errorf("orientation %d: size = %v, want %v", tt.orientation, got, tt.size)
+			continue
+		}
+		r, _, _, _ := dst.At(tt.white.X, tt.white.Y).RGBA()
+		if r != 0xFFFF {
+			t.Errorf("orientation %d: pixel %v is not white", tt.orientation, tt.white)
+		}
+	}
+}
+
+// pngChunk 生成PNG数据块，测试只关心块结构，CRC填0
+func pngChunk(typ, data string) []byte {
+	chunk := make([]byte, 8, 12+len(data))
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	copy(chunk[4:], typ)
+	chunk = append(chunk, data...)
+	return append(chunk, 0, 0, 0, 0)
+}
+
+// riffChunk 生成WebP的RIFF块，奇数长度补齐一个字节
+func riffChunk(typ, data string) []byte {
+	chunk := make([]byte, 8, 9+len(data))
+	copy(chunk, typ)
+	binary.LittleEndian.PutUint32(chunk[4:], uint32(len(data)))
+	chunk = append(chunk, data...)
+	if len(data)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+func webpFile(chunks ...[]byte) []byte {
+	body := []byte("WEBP")
+	for _, chunk := range chunks {
+		body = append(body, chunk...)
+	}
+	header := []byte("RIFF\x00\x00\x00\x00")
+	binary.LittleEndian.PutUint32(header[4:], uint32(len(body)))
+	return append(header, body...)
+}
+
+func TestStripImageMetadata(t *testing.T) {
+	comment := []byte{0xFF, 0xFE, 0x00, 0x06, 'g', 'p', 's', '!'}
+	jpegWithExif := testJPEG(t, exifSegment(binary.BigEndian, 6), comment)
+	png := func(chunks ...[]byte) []byte {
+		out := []byte("\x89PNG\r\n\x1a\n")
+		for _, chunk := range chunks {
+			out = append(out, chunk...)
+		}
+		return out
+	}
+	ihdr, idat, iend := pngChunk("IHDR", "hdr"), pngChunk("IDAT", "pixels"), pngChunk("IEND", "")
+	vp8x := "\x0C\x00\x00\x00\x01\x00\x00\x00\x00\x00"
+	vp8xStripped := "\x00\x00\x00\x00\x01\x00\x00\x00\x00\x00"
+
+	tests := []struct {
+		name        string
+		data        []byte
+		contentType string
+		want        []byte
+		wantErr     error
+	}{
+		{
+			name:        "JPEG去除EXIF和注释",
+			data:        jpegWithExif,
+			contentType: "image/jpeg",
+			want:        testJPEG(t),
+		},
+		{
+			name:        "JPEG图像数据损坏时仍可去除",
+			data:        append(testJPEG(t, exifSegment(binary.BigEndian, 6)), "garbage"...),
+			contentType: "image/jpeg",
+			want:        append(testJPEG(t), "garbage"...),
+		},
+		{
+			name:        "JPEG段结构损坏",
+			data:        jpegWithExif[:8],
+			contentType: "image/jpeg",
+			wantErr:     ErrInvalidImage,
+		},
+		{
+			name:        "PNG去除文本和EXIF块",
+			data:        png(ihdr, pngChunk("tEXt", "GPS"), pngChunk("eXIf", "MM"), idat, pngChunk("iTXt", "XML"), iend),
+			contentType: "image/png",
+			want:        png(ihdr, idat, iend),
+		},
+		{
+			name:        "PNG缺少IEND",
+			data:        png(ihdr, idat),
+			contentType: "image/png",
+			wantErr:     ErrInvalidImage,
+		},
+		{
+			name:        "WebP去除EXIF和XMP块并清除标志位",
+			data:        webpFile(riffChunk("VP8X", vp8x), riffChunk("VP8 ", "frame"), riffChunk("EXIF", "MM*"), riffChunk("XMP ", "<x/>")),
+			contentType: "image/webp",
+			want:        webpFile(riffChunk("VP8X", vp8xStripped), riffChunk("VP8 ", "frame")),
+		},
+		{
+			name:        "WebP块长度超出文件",
+			data:        webpFile(riffChunk("VP8 ", "frame"))[:18],
+			contentType: "image/webp",
+			wantErr:     ErrInvalidImage,
+		},
+		{
+			name:        "不支持的类型",
+			data:        []byte("GIF89a"),
+			contentType: "image/gif",
+			wantErr:     ErrUnsupportedImage,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := StripImageMetadata(tt.data, tt.contentType)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("StripImageMetadata error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("StripImageMetadata: %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("StripImageMetadata = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// 去除元数据后的JPEG方向恢复为默认值，且仍能解码
+	stripped, _ := StripImageMetadata(jpegWithExif, "image/jpeg")
+	if exifOrientation(stripped) != 1 {
+		t.Error("stripped JPEG still has EXIF orientation")
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(stripped)); err != nil {
+		t.Errorf("decode stripped JPEG: %v", err)
+	}
+}
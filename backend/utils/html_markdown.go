@@ -0,0 +1,373 @@
+package utils
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var (
+	// markdownEscapePattern 文本中需要转义的Markdown字符
+	markdownEscapePattern = regexp.MustCompile("([\\\\`*_\\[\\]])")
+	// blankLinesPattern 连续的空行
+	blankLinesPattern = regexp.MustCompile(`\n{3,}`)
+	// todoPrefixPattern 以待办事项开头的段落
+	todoPrefixPattern = regexp.MustCompile(`^\[[ x]\] `)
+)
+
+// markdownBlockElements 转换为Markdown时作为独立段落的块级元素
+var markdownBlockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "body": true, "center": true,
+	"dd": true, "div": true, "dl": true, "dt": true, "en-note": true, "figure": true, "footer": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "header": true, "hr": true,
+	"html": true, "li": true, "main": true, "ol": true, "p": true, "pre": true, "section": true,
+	"table": true, "ul": true,
+}
+
+// markdownSkippedElements 转换为Markdown时忽略的元素
+var markdownSkippedElements = map[string]bool{
+	"head": true, "script": true, "style": true, "title": true, "noscript": true, "iframe": true, "object": true,
+}
+
+// htmlConverter 将HTML（包括印象笔记的ENML）转换为Markdown
+type htmlConverter struct {
+	// media 转换 en-media 等自定义元素，返回空字符串时忽略该元素
+	media func(n *html.Node) string
+	// skipped 记录无法转换的内容
+	skipped func(reason string)
+}
+
+// convert 转换HTML节点及其子节点
+func (c *htmlConverter) convert(root *html.Node) string {
+	text := blankLinesPattern.ReplaceAllString(c.blocks(root), "\n\n")
+	return strings.TrimSpace(text) + "\n"
+}
+
+// blocks 转换子节点，块级元素之间以空行分隔，相邻的行内内容合并为一个段落
+func (c *htmlConverter) blocks(n *html.Node) string {
+	var blocks []string
+	var inline strings.Builder
+	flush := func() {
+		if text := cleanInline(inline.String()); text != "" {
+			if todoPrefixPattern.MatchString(text) {
+				text = "- " + text
+			}
+			blocks = append(blocks, text)
+		}
+		inline.Reset()
+	}
+
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode && markdownBlockElements[child.Data] {
+			flush()
+			if block := strings.Trim(c.block(child), "\n"); strings.TrimSpace(block) != "" {
+				blocks = append(blocks, block)
+			}
+			continue
+		}
+		inline.WriteString(c.inline(child))
+	}
+	flush()
+	return strings.Join(blocks, "\n\n")
+}
+
+// block 转换块级元素
+func (c *htmlConverter) block(n *html.Node) string {
+	switch n.Data {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		level, _ := strconv.Atoi(n.Data[1:])
+		text := strings.ReplaceAll(cleanInline(c.inlineChildren(n)), "\n", " ")
+		if text == "" {
+			return ""
+		}
+		return strings.Repeat("#", level) + " " + text
+	case "ul", "ol":
+		return c.list(n)
+	case "blockquote":
+		return prefixLines(c.blocks(n), "> ", "> ")
+	case "pre":
+		return codeFence(textContent(n))
+	case "hr":
+		return "---"
+	case "table":
+		return c.table(n)
+	case "div":
+		// 印象笔记的代码块
+		if strings.Contains(strings.ReplaceAll(attr(n, "style"), " ", ""), "-en-codeblock:true") {
+			return codeFence(textContent(n))
+		}
+	}
+	return c.blocks(n)
+}
+
+// list 转换有序或无序列表，嵌套的内容按列表标记的宽度缩进
+func (c *htmlConverter) list(n *html.Node) string {
+	var items []string
+	index := 1
+	if start, err := strconv.Atoi(attr(n, "start")); err == nil {
+		index = start
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type != html.ElementNode || child.Data != "li" {
+			continue
+		}
+		marker := "- "
+		if n.Data == "ol" {
+			marker = strconv.Itoa(index) + ". "
+			index++
+		}
+		content := strings.TrimPrefix(c.blocks(child), "- ")
+		items = append(items, prefixLines(content, marker, strings.Repeat(" ", len(marker))))
+	}
+	return strings.Join(items, "\n")
+}
+
+// table 转换为GFM表格，第一行作为表头
+func (c *htmlConverter) table(n *html.Node) string {
+	var rows [][]string
+	var walk func(node *html.Node)
+	walk = func(node *html.Node) {
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != html.ElementNode {
+				continue
+			}
+			if child.Data != "tr" {
+				walk(child)
+				continue
+			}
+			var row []string
+			for cell := child.FirstChild; cell != nil; cell = cell.NextSibling {
+				if cell.Type == html.ElementNode && (cell.Data == "td" || cell.Data == "th") {
+					text := strings.ReplaceAll(c.blocks(cell), "\n\n", "<br>")
+					text = strings.ReplaceAll(strings.ReplaceAll(text, "\n", "<br>"), "|", `\|`)
+					row = append(row, text)
+				}
+			}
+			rows = append(rows, row)
+		}
+	}
+	walk(n)
+	if len(rows) == 0 {
+		return ""
+	}
+
+	columns := 0
+	for _, row := range rows {
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+	if columns == 0 {
+		return ""
+	}
+	lines := make([]string, 0, len(rows)+1)
+	for i, row := range rows {
+		for len(row) < columns {
+			row = append(row, "")
+		}
+		lines = append(lines, "| "+strings.Join(row, " | ")+" |")
+		if i == 0 {
+			lines = append(lines, "|"+strings.Repeat(" --- |", columns))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// inline 转换行内节点
+func (c *htmlConverter) inline(n *html.Node) string {
+	switch n.Type {
+	case html.TextNode:
+		return markdownEscapePattern.ReplaceAllString(collapseWhitespace(n.Data), `\$1`)
+	case html.ElementNode:
+	default:
+		return ""
+	}
+	if markdownSkippedElements[n.Data] {
+		return ""
+	}
+
+	switch n.Data {
+	case "br":
+		return "\n"
+	case "b", "strong":
+		return wrapInline(c.inlineChildren(n), "**")
+	case "i", "em":
+		return wrapInline(c.inlineChildren(n), "*")
+	case "s", "strike", "del":
+		return wrapInline(c.inlineChildren(n), "~~")
+	case "code", "kbd", "samp":
+		text := textContent(n)
+		if strings.TrimSpace(text) == "" {
+			return text
+		}
+		if strings.Contains(text, "`") {
+			return "`` " + text + " ``"
+		}
+		return "`" + text + "`"
+	case "a":
+		text := strings.TrimSpace(c.inlineChildren(n))
+		href := strings.TrimSpace(attr(n, "href"))
+		if href == "" || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+			return text
+		}
+		if text == "" {
+			return "<" + href + ">"
+		}
+		return "[" + text + "](" + markdownURL(href) + ")"
+	case "img":
+		src := strings.TrimSpace(attr(n, "src"))
+		if src == "" {
+			return ""
+		}
+		if strings.HasPrefix(src, "data:") {
+			c.skip("内嵌的图片数据未导入")
+			return ""
+		}
+		return "![" + markdownEscapePattern.ReplaceAllString(attr(n, "alt"), `\$1`) + "](" + markdownURL(src) + ")"
+	case "en-todo":
+		if attr(n, "checked") == "true" {
+			return "[x] "
+		}
+		return "[ ] "
+	case "en-media":
+		if c.media != nil {
+			return c.media(n)
+		}
+		return ""
+	case "en-crypt":
+		c.skip("加密的内容未导入")
+		return "（加密内容）"
+	}
+
+	// 行内位置出现的块级元素（例如 <span> 中的 <div>）单独成行
+	if markdownBlockElements[n.Data] {
+		return "\n" + c.block(n) + "\n"
+	}
+	return c.inlineChildren(n)
+}
+
+// inlineChildren 转换所有子节点为行内内容
+func (c *htmlConverter) inlineChildren(n *html.Node) string {
+	var b strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		b.WriteString(c.inline(child))
+	}
+	return b.String()
+}
+
+// skip 记录无法转换的内容
+func (c *htmlConverter) skip(reason string) {
+	if c.skipped != nil {
+		c.skipped(reason)
+	}
+}
+
+// wrapInline 用强调标记包裹文本，标记放在首尾空白之内，文本为空时不添加标记
+func wrapInline(text, mark string) string {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return text
+	}
+	start := strings.Index(text, trimmed)
+	return text[:start] + mark + trimmed + mark + text[start+len(trimmed):]
+}
+
+// cleanInline 整理段落文本：去掉每行首尾的空白和空行
+func cleanInline(text string) string {
+	lines := strings.Split(text, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if line = strings.TrimSpace(line); line != "" {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+// collapseWhitespace 将连续的空白合并为一个空格
+func collapseWhitespace(text string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range text {
+		if r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\f' {
+			if !space {
+				b.WriteByte(' ')
+			}
+			space = true
+			continue
+		}
+		space = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// textContent 返回节点的纯文本，块级元素和换行之间以换行分隔，用于代码块
+func textContent(n *html.Node) string {
+	var b strings.Builder
+	var walk func(node *html.Node)
+	walk = func(node *html.Node) {
+		switch {
+		case node.Type == html.TextNode:
+			b.WriteString(node.Data)
+		case node.Type == html.ElementNode && node.Data == "br":
+			b.WriteByte('\n')
+		case node.Type == html.ElementNode && markdownSkippedElements[node.Data]:
+		default:
+			block := node.Type == html.ElementNode && markdownBlockElements[node.Data]
+			if block && b.Len() > 0 && !strings.HasSuffix(b.String(), "\n") {
+				b.WriteByte('\n')
+			}
+			for child := node.FirstChild; child != nil; child = child.NextSibling {
+				walk(child)
+			}
+		}
+	}
+	walk(n)
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// codeFence 将文本包裹为代码块，文本中包含```时使用更长的围栏
+func codeFence(text string) string {
+	fence := "```"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	return fence + "\n" + text + "\n" + fence
+}
+
+// prefixLines 为第一行添加first前缀，其余非空行添加rest前缀
+func prefixLines(text, first, rest string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		switch {
+		case i == 0:
+			lines[i] = first + line
+		case line != "":
+			lines[i] = rest + line
+		case strings.TrimSpace(rest) != "":
+			lines[i] = strings.TrimRight(rest, " ")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// markdownURL 链接地址包含空格或括号时用尖括号包裹
+func markdownURL(url string) string {
+	if strings.ContainsAny(url, " ()<>") {
+		return "<" + strings.NewReplacer("<", "%3C", ">", "%3E").Replace(url) + ">"
+	}
+	return url
+}
+
+// attr 返回元素的属性值
+func attr(n *html.Node, name string) string {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
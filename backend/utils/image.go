@@ -0,0 +1,187 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	// 注册可解码的图片格式
+	_ "image/gif"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// ErrUnsupportedImage 无法解码的图片格式
+var ErrUnsupportedImage = errors.New("不支持的图片格式")
+
+// maxImagePixels 允许解码的最大像素数，避免超大尺寸图片耗尽内存
+const maxImagePixels = 100 * 1000 * 1000
+
+// thumbnailJPEGQuality 缩略图的JPEG压缩质量
+const thumbnailJPEGQuality = 82
+
+// Thumbnail 生成的缩略图
+type Thumbnail struct {
+	Data        []byte
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// IsThumbnailable 检查文件类型是否可以生成缩略图
+func IsThumbnailable(contentType string) bool {
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+		return true
+	}
+	return false
+}
+
+// DecodeImage 解码JPEG、PNG、GIF或WebP图片，返回图片及其格式名称
+// JPEG图片会按EXIF方向旋转为正确的显示方向
+func DecodeImage(r io.Reader) (image.Image, string, error) {
+	var buf bytes.Buffer
+	config, format, err := image.DecodeConfig(io.TeeReader(r, &buf))
+	if err != nil {
+		return nil, "", ErrUnsupportedImage
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return nil, "", errors.New("图片尺寸过大")
+	}
+
+	// DecodeConfig已读取到图像数据之前的文件头，其中包含EXIF段
+	orientation := 1
+	if format == "jpeg" {
+		orientation = exifOrientation(buf.Bytes())
+	}
+
+	img, _, err := image.Decode(io.MultiReader(&buf, r))
+	if err != nil {
+		return nil, "", err
+	}
+	return applyOrientation(img, orientation), format, nil
+}
+
+// ImageOptions 上传图片的规范化参数
+type ImageOptions struct {
+	MaxDimension int // 最长边超过该值时缩小，0表示不缩小
+	JPEGQuality  int // 重新压缩JPEG时的质量（1-100）
+}
+
+// NormalizedImage 规范化后的图片
+type NormalizedImage struct {
+	Data        []byte
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// IsNormalizable 检查文件类型是否需要在上传时规范化
+// GIF可能是动图，重新编码会丢失动画，因此不处理
+func IsNormalizable(contentType string) bool {
+	switch contentType {
+	case "image/jpeg", "image/png", "image/webp":
+		return true
+	}
+	return false
+}
+
+// NormalizeImage 规范化上传的图片：按EXIF方向旋转、缩小超过最大尺寸的图片并重新编码
+// 重新编码后不再包含EXIF（包括GPS位置）等元数据；WebP无法编码，按是否透明转换为JPEG或PNG
+func NormalizeImage(r io.Reader, contentType string, options ImageOptions) (*NormalizedImage, error) {
+	src, _, err := DecodeImage(r)
+	if err != nil {
+		return nil, err
+	}
+
+	dst := ResizeImage(src, options.MaxDimension)
+	bounds := dst.Bounds()
+
+	quality := options.JPEGQuality
+	if quality <= 0 || quality > 100 {
+		quality = jpeg.DefaultQuality
+	}
+
+	var buf bytes.Buffer
+	normalized := &NormalizedImage{Width: bounds.Dx(), Height: bounds.Dy()}
+	if contentType == "image/png" || (contentType == "image/webp" && !isOpaque(dst)) {
+		normalized.ContentType = "image/png"
+		err = png.Encode(&buf, dst)
+	} else {
+		normalized.ContentType = "image/jpeg"
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: quality})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	normalized.Data = buf.Bytes()
+	return normalized, nil
+}
+
+// GenerateThumbnail 生成最长边不超过maxSize的缩略图
+// 不透明的图片编码为JPEG，带透明通道的图片编码为PNG；原图不超过maxSize时不放大
+func GenerateThumbnail(r io.Reader, maxSize int) (*Thumbnail, error) {
+	src, _, err := DecodeImage(r)
+	if err != nil {
+		return nil, err
+	}
+
+	dst := ResizeImage(src, maxSize)
+	bounds := dst.Bounds()
+
+	var buf bytes.Buffer
+	thumbnail := &Thumbnail{Width: bounds.Dx(), Height: bounds.Dy()}
+	if isOpaque(dst) {
+		thumbnail.ContentType = "image/jpeg"
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: thumbnailJPEGQuality})
+	} else {
+		thumbnail.ContentType = "image/png"
+		err = png.Encode(&buf, dst)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	thumbnail.Data = buf.Bytes()
+	return thumbnail, nil
+}
+
+// ResizeImage 按比例缩小图片，使最长边不超过maxSize
+func ResizeImage(src image.Image, maxSize int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if maxSize <= 0 || (width <= maxSize && height <= maxSize) {
+		return src
+	}
+
+	if width >= height {
+		height = height * maxSize / width
+		width = maxSize
+	} else {
+		width = width * maxSize / height
+		height = maxSize
+	}
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Src, nil)
+	return dst
+}
+
+// isOpaque 检查图片是否不含透明像素
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
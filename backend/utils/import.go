@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// ImportedNote 从导入文件中解析出的笔记
+type ImportedNote struct {
+	Path      string          // 在导入文件中的路径
+	Title     string
+	Content   string          // Markdown内容，引用的文件使用 ImportFileRef(i) 占位，i 为 Files 中的下标
+	Tags      []string
+	CreatedAt time.Time       // 零值表示使用导入时间
+	IsPublic  bool
+	Files     []*ImportedFile // 内容引用的文件
+}
+
+// ImportedFile 笔记引用的文件
+type ImportedFile struct {
+	Path     string // 在导入文件中的路径，多篇笔记引用同一文件时相同
+	Name     string // 文件名
+	Size     int64  // 解压后的大小
+	Original string // 内容中原来的引用地址，文件无法导入时恢复为该地址
+	Open     func() (io.ReadCloser, error)
+}
+
+// ImportIssue 导入时跳过的文件或无法处理的内容
+type ImportIssue struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// ImportFileRef 笔记内容中第i个引用文件的占位符，导入时替换为附件地址
+func ImportFileRef(i int) string {
+	return fmt.Sprintf("{{import:%d}}", i)
+}
+
+// addFile 添加笔记引用的文件，同一文件只添加一次，返回文件在 Files 中的下标
+func (n *ImportedNote) addFile(file *ImportedFile) int {
+	for i, f := range n.Files {
+		if f.Path == file.Path {
+			return i
+		}
+	}
+	n.Files = append(n.Files, file)
+	return len(n.Files) - 1
+}
+
+// addTag 添加标签，忽略空标签和重复的标签（不区分大小写）
+func (n *ImportedNote) addTag(name string) {
+	name = NormalizeImportTag(name)
+	if name == "" {
+		return
+	}
+	for _, tag := range n.Tags {
+		if strings.EqualFold(tag, name) {
+			return
+		}
+	}
+	n.Tags = append(n.Tags, name)
+}
+
+// NormalizeImportTag 整理导入的标签名：去掉首尾空白和开头的#，超长时截断，为空时返回空字符串
+func NormalizeImportTag(name string) string {
+	return truncateRunes(strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(name), "#")), 255)
+}
+
+// NormalizeImportTitle 整理导入的标题，为空时使用fallback，超长时截断
+func NormalizeImportTitle(title, fallback string) string {
+	title = strings.Join(strings.Fields(title), " ")
+	if title == "" {
+		title = fallback
+	}
+	if title == "" {
+		title = "无标题"
+	}
+	return truncateRunes(title, 255)
+}
+
+// truncateRunes 将字符串截断为最多n个字符
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+// zipEntryName 返回ZIP条目的文件名
+// Windows中文系统创建的ZIP通常使用GBK编码文件名且不设置UTF-8标记，此时按GBK解码
+func zipEntryName(f *zip.File) string {
+	name := f.Name
+	if f.NonUTF8 && !utf8.ValidString(name) {
+		if decoded, err := simplifiedchinese.GB18030.NewDecoder().String(name); err == nil {
+			name = decoded
+		}
+	}
+	return strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(name, `\`, "/")), "/")
+}
+
+// isHiddenImportPath 检查路径是否属于隐藏文件或目录（例如 .obsidian、__MACOSX）
+func isHiddenImportPath(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") || part == "__MACOSX" {
+			return true
+		}
+	}
+	return false
+}
+
+// zipFileOpener 返回打开ZIP条目的函数
+func zipFileOpener(f *zip.File) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		return f.Open()
+	}
+}
+
+// readZipFile 读取ZIP条目的内容，超过maxSize时返回错误
+func readZipFile(f *zip.File, maxSize int64) ([]byte, error) {
+	if int64(f.UncompressedSize64) > maxSize {
+		return nil, fmt.Errorf("文件超过 %d MB", maxSize/1024/1024)
+	}
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(io.LimitReader(r, maxSize))
+}
@@ -0,0 +1,172 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrChatModelDisabled 未配置大模型时返回的错误
+var ErrChatModelDisabled = errors.New("未配置AI对话模型")
+
+// ChatMessage 对话消息
+type ChatMessage struct {
+	Role    string `json:"role"` // system, user, assistant
+	Content string `json:"content"`
+}
+
+// ChatClient OpenAI兼容的对话接口客户端
+type ChatClient struct {
+	BaseURL    string
+	APIKey     string
+	Model      string
+	HTTPClient *http.Client
+}
+
+// NewChatClient 创建对话接口客户端
+func NewChatClient(baseURL, apiKey, model string) *ChatClient {
+	return &ChatClient{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		APIKey:     apiKey,
+		Model:      model,
+		HTTPClient: &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+// Enabled 是否已配置可用的大模型
+func (c *ChatClient) Enabled() bool {
+	return c != nil && c.BaseURL != "" && c.APIKey != ""
+}
+
+// chatRequest 对话接口请求体
+type chatRequest struct {
+	Model       string        `json:"model"`
+	Messages    []ChatMessage `json:"messages"`
+	Stream      bool          `json:"stream"`
+	Temperature float64       `json:"temperature"`
+}
+
+// chatResponse 对话接口响应体（兼容流式与非流式）
+type chatResponse struct {
+	Choices []struct {
+		Message ChatMessage `json:"message"`
+		Delta   ChatMessage `json:"delta"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Complete 发送对话请求并返回完整回答
+func (c *ChatClient) Complete(ctx context.Context, messages []ChatMessage) (string, error) {
+	resp, err := c.do(ctx, messages, false)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result chatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("解析模型响应失败: %v", err)
+	}
+	if len(result.Choices) == 0 {
+		return "", errors.New("模型没有返回内容")
+	}
+
+	return result.Choices[0].Message.Content, nil
+}
+
+// Stream 以流式方式发送对话请求，每收到一段内容调用一次onDelta，返回完整回答
+func (c *ChatClient) Stream(ctx context.Context, messages []ChatMessage, onDelta func(delta string) error) (string, error) {
+	resp, err := c.do(ctx, messages, true)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var answer strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk chatResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return answer.String(), fmt.Errorf("解析模型流式响应失败: %v", err)
+		}
+		if chunk.Error != nil {
+			return answer.String(), errors.New(chunk.Error.Message)
+		}
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+
+		delta := chunk.Choices[0].Delta.Content
+		answer.WriteString(delta)
+		if err := onDelta(delta); err != nil {
+			return answer.String(), err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return answer.String(), fmt.Errorf("读取模型流式响应失败: %v", err)
+	}
+
+	return answer.String(), nil
+}
+
+// do 发送对话请求，非2xx响应转换为错误
+func (c *ChatClient) do(ctx context.Context, messages []ChatMessage, stream bool) (*http.Response, error) {
+	if !c.Enabled() {
+		return nil, ErrChatModelDisabled
+	}
+
+	body, err := json.Marshal(chatRequest{
+		Model:       c.Model,
+		Messages:    messages,
+		Stream:      stream,
+		Temperature: 0.2,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	if stream {
+		req.Header.Set("Accept", "text/event-stream")
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求模型接口失败: %v", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("模型接口返回错误(%d): %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	return resp, nil
+}
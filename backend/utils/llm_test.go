@@ -0,0 +1,194 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newChatServer 启动模拟的对话接口，校验请求后交给handler返回响应
+func newChatServer(t *testing.T, handler func(w http.ResponseWriter, req chatRequest)) *ChatClient {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer test-key" {
+			t.Errorf("Authorization = %q", got)
+		}
+		var req chatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		if req.Model != "test-model" || len(req.Messages) != 2 || req.Messages[1].Content != "问题" {
+			t.Errorf("request = %+v", req)
+		}
+		handler(w, req)
+	}))
+	t.Cleanup(server.Close)
+	return NewChatClient(server.URL+"/v1/", "test-key", "test-model")
+}
+
+var testMessages = []ChatMessage{
+	{Role: "system", Content: "系统提示"},
+	{Role: "user", Content: "问题"},
+}
+
+func TestChatClientComplete(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		want    string
+		wantErr string
+	}{
+		{
+			name:   "返回回答",
+			status: http.StatusOK,
+			body:   `{"choices":[{"message":{"role":"assistant","content":"回答[1]"}}]}`,
+			want:   "回答[1]",
+		},
+		{
+			name:    "没有内容",
+			status:  http.StatusOK,
+			body:    `{"choices":[]}`,
+			wantErr: "模型没有返回内容",
+		},
+		{
+			name:    "无法解析的响应",
+			status:  http.StatusOK,
+			body:    `not json`,
+			wantErr: "解析模型响应失败",
+		},
+		{
+			name:    "接口错误",
+			status:  http.StatusTooManyRequests,
+			body:    `{"error":{"message":"rate limited"}}`,
+			wantErr: "模型接口返回错误(429)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newChatServer(t, func(w http.ResponseWriter, req chatRequest) {
+				if req.Stream {
+					t.Error("Complete sent a streaming request")
+				}
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			})
+
+			got, err := client.Complete(context.Background(), testMessages)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Complete error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Complete = %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestChatClientStream(t *testing.T) {
+	tests := []struct {
+		name    string
+		events  []string
+		want    string
+		deltas  []string
+		wantErr string
+	}{
+		{
+			name: "逐段返回",
+			events: []string{
+				`{"choices":[{"delta":{"role":"assistant"}}]}`,
+				`{"choices":[{"delta":{"content":"根据笔记"}}]}`,
+				`{"choices":[{"delta":{"content":"，答案是[1]"}}]}`,
+				`[DONE]`,
+				`{"choices":[{"delta":{"content":"DONE之后的内容"}}]}`,
+			},
+			want:   "根据笔记，答案是[1]",
+			deltas: []string{"根据笔记", "，答案是[1]"},
+		},
+		{
+			name: "流中返回错误",
+			events: []string{
+				`{"choices":[{"delta":{"content":"部分"}}]}`,
+				`{"error":{"message":"upstream overloaded"}}`,
+			},
+			want:    "部分",
+			deltas:  []string{"部分"},
+			wantErr: "upstream overloaded",
+		},
+		{
+			name:    "无法解析的数据",
+			events:  []string{`{bad`},
+			wantErr: "解析模型流式响应失败",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newChatServer(t, func(w http.ResponseWriter, req chatRequest) {
+				if !req.Stream {
+					t.Error("Stream sent a non-streaming request")
+				}
+				w.Header().Set("Content-Type", "text/event-stream")
+				// 注释和空行会被忽略
+				fmt.Fprint(w, ": keep-alive\n\n")
+				for _, event := range tt.events {
+					fmt.Fprintf(w, "data: %s\n\n", event)
+				}
+			})
+
+			var deltas []string
+			got, err := client.Stream(context.Background(), testMessages, func(delta string) error {
+				deltas = append(deltas, delta)
+				return nil
+			})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Stream error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("Stream: %v", err)
+			}
+			if got != tt.want || strings.Join(deltas, "|") != strings.Join(tt.deltas, "|") {
+				t.Errorf("Stream = %q, deltas %q; want %q, %q", got, deltas, tt.want, tt.deltas)
+			}
+		})
+	}
+}
+
+func TestChatClientStreamStopsOnCallbackError(t *testing.T) {
+	client := newChatServer(t, func(w http.ResponseWriter, req chatRequest) {
+		for _, content := range []string{"a", "b", "c"} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", content)
+		}
+	})
+
+	stop := errors.New("client gone")
+	got, err := client.Stream(context.Background(), testMessages, func(delta string) error {
+		return stop
+	})
+	if !errors.Is(err, stop) || got != "a" {
+		t.Errorf("Stream = %q, %v; want \"a\", %v", got, err, stop)
+	}
+}
+
+func TestChatClientDisabled(t *testing.T) {
+	client := NewChatClient("https://api.example.com/v1", "", "model")
+	if client.Enabled() {
+		t.Error("client without API key is enabled")
+	}
+	if _, err := client.Complete(context.Background(), testMessages); !errors.Is(err, ErrChatModelDisabled) {
+		t.Errorf("Complete error = %v, want ErrChatModelDisabled", err)
+	}
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ExportAssetDir 导出的ZIP中保存附件的目录
+const ExportAssetDir = "assets"
+
+// ExportFrontMatter 导出的笔记的YAML front matter，可以通过Markdown导入还原标题、标签、创建时间和是否公开
+type ExportFrontMatter struct {
+	ID        uint      `yaml:"id"`
+	Title     string    `yaml:"title"`
+	Tags      []string  `yaml:"tags"`
+	CreatedAt time.Time `yaml:"created_at"`
+	UpdatedAt time.Time `yaml:"updated_at"`
+	IsPublic  bool      `yaml:"is_public"`
+	Summary   string    `yaml:"summary"`
+}
+
+// exportPathEscaper 转义Markdown链接地址中会截断链接或被当作锚点、查询参数的字符
+var exportPathEscaper = strings.NewReplacer("%", "%25", " ", "%20", "(", "%28", ")", "%29", "<", "%3C", ">", "%3E", "#", "%23", "?", "%3F")
+
+// MarkdownWithFrontMatter 返回带有YAML front matter的Markdown内容
+func MarkdownWithFrontMatter(meta ExportFrontMatter, content string) (string, error) {
+	if meta.Tags == nil {
+		meta.Tags = []string{}
+	}
+	var b strings.Builder
+	encoder := yaml.NewEncoder(&b)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(meta); err != nil {
+		return "", err
+	}
+	if err := encoder.Close(); err != nil {
+		return "", err
+	}
+	return "---\n" + b.String() + "---\n\n" + content, nil
+}
+
+// ExportAssetLink 笔记中引用导出的附件的相对地址
+func ExportAssetLink(name string) string {
+	return ExportAssetDir + "/" + exportPathEscaper.Replace(name)
+}
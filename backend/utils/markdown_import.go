@@ -0,0 +1,413 @@
+package utils
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrNothingToImport 导入文件中没有可以导入的笔记
+var ErrNothingToImport = errors.New("没有找到可以导入的笔记")
+
+// maxImportMarkdownSize 单个Markdown文件的最大大小
+const maxImportMarkdownSize = 10 * 1024 * 1024
+
+var (
+	// markdownLinkPattern Markdown链接和图片：[文本](地址 "标题")、![替代文本](<带空格的地址>)
+	markdownLinkPattern = regexp.MustCompile(`(!?)\[([^\]\n]*)\]\(\s*(<[^>\n]*>|[^\s()]+(?:\([^\s()]*\)[^\s()]*)*)(\s+(?:"[^"\n]*"|'[^'\n]*'))?\s*\)`)
+	// obsidianEmbedPattern Obsidian的嵌入语法：![[图片.png]]、![[图片.png|300]]
+	obsidianEmbedPattern = regexp.MustCompile(`!\[\[([^\]\n]+)\]\]`)
+	// urlSchemePattern 带协议的地址，例如 https:、mailto:、data:
+	urlSchemePattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*:`)
+	// imageSizePattern Obsidian嵌入图片时指定的尺寸，例如 300、300x200
+	imageSizePattern = regexp.MustCompile(`^\d+(x\d+)?$`)
+)
+
+// frontMatterTimeLayouts front matter中created字段支持的时间格式
+var frontMatterTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/01/02 15:04:05",
+	"2006/01/02 15:04",
+	"2006/01/02",
+}
+
+// markdownArchive 正在解析的Markdown文件夹
+type markdownArchive struct {
+	files      map[string]*zip.File // 去掉共同的顶层目录后的路径 -> 条目
+	byName     map[string][]string  // 小写的文件名 -> 路径，用于按Obsidian的方式只凭文件名查找
+	referenced map[string]bool      // 被笔记引用的文件
+}
+
+// newMarkdownArchive 索引ZIP（可以是同一导出的多个分卷）中的文件，忽略隐藏文件和目录，返回按ZIP中顺序排列的路径
+func newMarkdownArchive(readers ...*zip.Reader) (*markdownArchive, []string) {
+	archive := &markdownArchive{
+		files:      make(map[string]*zip.File),
+		byName:     make(map[string][]string),
+		referenced: make(map[string]bool),
+	}
+
+	var names []string
+	entries := make(map[string]*zip.File)
+	for _, zr := range readers {
+		for _, f := range zr.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			name := zipEntryName(f)
+			if _, exists := entries[name]; exists || name == "" || isHiddenImportPath(name) {
+				continue
+			}
+			names = append(names, name)
+			entries[name] = f
+		}
+	}
+
+	// 压缩整个文件夹时所有文件都在同一个顶层目录下，该目录不作为标签
+	root := commonImportRoot(names)
+	for i, name := range names {
+		f := entries[name]
+		names[i] = strings.TrimPrefix(name, root)
+		archive.files[names[i]] = f
+		base := strings.ToLower(path.Base(names[i]))
+		archive.byName[base] = append(archive.byName[base], names[i])
+	}
+	return archive, names
+}
+
+// unreferencedIssues 没有被任何笔记引用的非Markdown文件，skip返回true的文件不列出
+func (a *markdownArchive) unreferencedIssues(names []string, skip func(name string) bool) []ImportIssue {
+	var issues []ImportIssue
+	for _, name := range names {
+		if !isMarkdownFile(name) && !a.referenced[name] && (skip == nil || !skip(name)) {
+			issues = append(issues, ImportIssue{Path: name, Reason: "没有被笔记引用，已忽略"})
+		}
+	}
+	return issues
+}
+
+// ParseMarkdownArchive 解析包含Markdown文件的ZIP（普通文件夹或Obsidian库）
+// 每个 .md 文件导入为一篇笔记：YAML front matter 中的 title、tags、created（或 created_at）、public 作为标题、标签、创建时间和是否公开，
+// 没有标题时使用文件名，没有创建时间时使用文件的修改时间；所在文件夹的路径作为标签；
+// 内容中以相对路径引用的本地文件（包括 Obsidian 的 ![[...]] 嵌入）作为笔记的附件导入
+// 隐藏文件和目录（例如 .obsidian）会被忽略
+func ParseMarkdownArchive(zr *zip.Reader) ([]ImportedNote, []ImportIssue, error) {
+	archive, names := newMarkdownArchive(zr)
+
+	var notes []ImportedNote
+	var issues []ImportIssue
+	for _, name := range names {
+		if !isMarkdownFile(name) {
+			continue
+		}
+		f := archive.files[name]
+		data, err := readZipFile(f, maxImportMarkdownSize)
+		if err != nil {
+			issues = append(issues, ImportIssue{Path: name, Reason: "读取文件失败: " + err.Error()})
+			continue
+		}
+		note, noteIssues := archive.parseNote(name, string(data), f.Modified)
+		notes = append(notes, note)
+		issues = append(issues, noteIssues...)
+	}
+	if len(notes) == 0 {
+		return nil, issues, ErrNothingToImport
+	}
+
+	return notes, append(issues, archive.unreferencedIssues(names, nil)...), nil
+}
+
+// parseNote 解析一个Markdown文件
+func (a *markdownArchive) parseNote(name, content string, modified time.Time) (ImportedNote, []ImportIssue) {
+	var issues []ImportIssue
+	content = strings.ReplaceAll(strings.TrimPrefix(content, "\ufeff"), "\r\n", "\n")
+
+	note := ImportedNote{Path: name, CreatedAt: modified}
+	meta, body, err := splitFrontMatter(content)
+	if err != nil {
+		issues = append(issues, ImportIssue{Path: name, Reason: "无法解析front matter，按正文导入: " + err.Error()})
+	}
+
+	note.Title = NormalizeImportTitle(frontMatterString(meta["title"]), strings.TrimSuffix(path.Base(name), path.Ext(name)))
+	if created, ok := frontMatterTime(firstValue(meta, "created", "created_at", "date")); ok {
+		note.CreatedAt = created
+	}
+	note.IsPublic = frontMatterBool(firstValue(meta, "public", "is_public"))
+
+	for _, tag := range frontMatterTags(firstValue(meta, "tags", "tag")) {
+		note.addTag(tag)
+	}
+	if dir := path.Dir(name); dir != "." {
+		note.addTag(dir)
+	}
+
+	note.Content, issues = a.rewriteLinks(&note, body, issues)
+	return note, issues
+}
+
+// rewriteLinks 将内容中引用的本地文件添加到笔记的Files中，并把链接替换为占位符，返回替换后的内容
+// 找不到的文件保留原来的链接并记录到issues
+func (a *markdownArchive) rewriteLinks(note *ImportedNote, body string, issues []ImportIssue) (string, []ImportIssue) {
+	dir := path.Dir(note.Path)
+	content := rewriteMarkdownLines(body, func(line string) string {
+		line = obsidianEmbedPattern.ReplaceAllStringFunc(line, func(match string) string {
+			target, alias, _ := strings.Cut(obsidianEmbedPattern.FindStringSubmatch(match)[1], "|")
+			target, _, _ = strings.Cut(target, "#")
+			if path.Ext(target) == "" || isMarkdownFile(target) {
+				// 嵌入其他笔记，保持原样
+				return match
+			}
+			original := target
+			if strings.ContainsAny(original, " \t") {
+				original = "<" + original + ">"
+			}
+			file := a.resolve(strings.TrimSpace(target), dir, original)
+			if file == nil {
+				issues = append(issues, ImportIssue{Path: note.Path, Reason: "未找到引用的文件 " + target})
+				return match
+			}
+
+			text := strings.TrimSpace(alias)
+			if text == "" || imageSizePattern.MatchString(text) {
+				text = file.Name
+			}
+			ref := ImportFileRef(note.addFile(file))
+			if isImageFile(file.Name) {
+				return "![" + text + "](" + ref + ")"
+			}
+			return "[" + text + "](" + ref + ")"
+		})
+
+		return markdownLinkPattern.ReplaceAllStringFunc(line, func(match string) string {
+			m := markdownLinkPattern.FindStringSubmatch(match)
+			target := strings.TrimSuffix(strings.TrimPrefix(m[3], "<"), ">")
+			if !isLocalReference(target) || isMarkdownFile(strings.SplitN(target, "#", 2)[0]) {
+				return match
+			}
+			file := a.resolve(target, dir, m[3])
+			if file == nil {
+				issues = append(issues, ImportIssue{Path: note.Path, Reason: "未找到引用的文件 " + target})
+				return match
+			}
+			return m[1] + "[" + m[2] + "](" + ImportFileRef(note.addFile(file)) + m[4] + ")"
+		})
+	})
+	return content, issues
+}
+
+// resolve 查找笔记引用的文件：先按相对于笔记所在目录的路径，再按相对于库根目录的路径，最后只按文件名查找
+// 引用的是其他Markdown文件或找不到时返回nil
+func (a *markdownArchive) resolve(target, dir, original string) *ImportedFile {
+	if i := strings.IndexAny(target, "?#"); i >= 0 {
+		target = target[:i]
+	}
+	if unescaped, err := url.PathUnescape(target); err == nil {
+		target = unescaped
+	}
+	if target == "" || isMarkdownFile(target) {
+		return nil
+	}
+
+	candidates := []string{strings.TrimPrefix(path.Clean("/"+target), "/")}
+	if !strings.HasPrefix(target, "/") {
+		candidates = append([]string{strings.TrimPrefix(path.Join("/", dir, target), "/")}, candidates...)
+	}
+	if paths := a.byName[strings.ToLower(path.Base(target))]; len(paths) > 0 {
+		candidates = append(candidates, paths[0])
+	}
+
+	for _, candidate := range candidates {
+		f, ok := a.files[candidate]
+		if !ok || isMarkdownFile(candidate) {
+			continue
+		}
+		a.referenced[candidate] = true
+		return &ImportedFile{
+			Path:     candidate,
+			Name:     path.Base(candidate),
+			Size:     int64(f.UncompressedSize64),
+			Original: original,
+			Open:     zipFileOpener(f),
+		}
+	}
+	return nil
+}
+
+// rewriteMarkdownLines 对代码块以外的每一行应用rewrite
+func rewriteMarkdownLines(content string, rewrite func(line string) string) string {
+	lines := strings.Split(content, "\n")
+	fence := ""
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			continue
+		}
+		lines[i] = rewrite(line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// splitFrontMatter 拆分开头的YAML front matter和正文，没有front matter时返回nil
+// front matter无法解析时返回错误，正文为完整内容
+func splitFrontMatter(content string) (map[string]interface{}, string, error) {
+	if !strings.HasPrefix(content, "---\n") {
+		return nil, content, nil
+	}
+
+	rest := content[len("---\n"):]
+	offset := 0
+	for offset <= len(rest) {
+		end := strings.IndexByte(rest[offset:], '\n')
+		line := rest[offset:]
+		if end >= 0 {
+			line = rest[offset : offset+end]
+		}
+		if trimmed := strings.TrimRight(line, " \t"); trimmed == "---" || trimmed == "..." {
+			var meta map[string]interface{}
+			if err := yaml.Unmarshal([]byte(rest[:offset]), &meta); err != nil {
+				return nil, content, err
+			}
+
+			// 字段名不区分大小写
+			normalized := make(map[string]interface{}, len(meta))
+			for key, value := range meta {
+				normalized[strings.ToLower(key)] = value
+			}
+			body := ""
+			if end >= 0 {
+				body = rest[offset+end+1:]
+			}
+			return normalized, strings.TrimLeft(body, "\n"), nil
+		}
+		if end < 0 {
+			break
+		}
+		offset += end + 1
+	}
+	return nil, content, nil
+}
+
+// firstValue 返回第一个存在的字段的值
+func firstValue(meta map[string]interface{}, keys ...string) interface{} {
+	for _, key := range keys {
+		if value, ok := meta[key]; ok && value != nil {
+			return value
+		}
+	}
+	return nil
+}
+
+// frontMatterString 将front matter的值转换为字符串
+func frontMatterString(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	return strings.TrimSpace(fmt.Sprint(value))
+}
+
+// frontMatterTags 解析front matter中的标签，支持列表和以逗号或空白分隔的字符串
+func frontMatterTags(value interface{}) []string {
+	switch v := value.(type) {
+	case []interface{}:
+		tags := make([]string, 0, len(v))
+		for _, item := range v {
+			tags = append(tags, frontMatterString(item))
+		}
+		return tags
+	case string:
+		return strings.FieldsFunc(v, func(r rune) bool {
+			return r == ',' || r == '，' || r == ' ' || r == '\t'
+		})
+	case nil:
+		return nil
+	default:
+		return []string{frontMatterString(v)}
+	}
+}
+
+// frontMatterTime 解析front matter中的时间，没有时区的时间按服务器时区解析
+func frontMatterTime(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, !v.IsZero()
+	case string:
+		v = strings.TrimSpace(v)
+		for _, layout := range frontMatterTimeLayouts {
+			if t, err := time.ParseInLocation(layout, v, time.Local); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// frontMatterBool 解析front matter中的布尔值，支持 true/false、yes/no 和 1/0
+func frontMatterBool(value interface{}) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case int:
+		return v != 0
+	case string:
+		v = strings.ToLower(strings.TrimSpace(v))
+		if v == "yes" || v == "y" || v == "on" {
+			return true
+		}
+		b, _ := strconv.ParseBool(v)
+		return b
+	}
+	return false
+}
+
+// commonImportRoot 所有路径共同的顶层目录（以/结尾），没有时返回空字符串
+func commonImportRoot(names []string) string {
+	root := ""
+	for i, name := range names {
+		dir, _, found := strings.Cut(name, "/")
+		if !found || (i > 0 && dir+"/" != root) {
+			return ""
+		}
+		root = dir + "/"
+	}
+	return root
+}
+
+// isLocalReference 检查链接地址是否指向导入文件中的本地文件，而不是网址、页内锚点或已替换的占位符
+func isLocalReference(target string) bool {
+	return target != "" && !strings.HasPrefix(target, "#") && !strings.HasPrefix(target, "{{import:") &&
+		!urlSchemePattern.MatchString(target)
+}
+
+// isMarkdownFile 根据扩展名判断是否为Markdown文件
+func isMarkdownFile(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	return ext == ".md" || ext == ".markdown"
+}
+
+// isImageFile 根据扩展名判断是否为图片
+func isImageFile(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".png", ".jpg", ".jpeg", ".gif", ".webp", ".bmp", ".svg", ".avif":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+)
+
+// markdownHighlightStyle 代码高亮使用的配色
+const markdownHighlightStyle = "github"
+
+// markdownRenderer 服务端Markdown渲染器：GFM（表格、任务列表、删除线、自动链接）、脚注、标题锚点和代码高亮
+// 代码高亮输出 CSS 类名，样式表由 MarkdownHighlightCSS 提供；笔记中的原始HTML会保留，渲染后统一由 SanitizeHTML 清理
+var markdownRenderer = goldmark.New(
+	goldmark.WithExtensions(
+		extension.GFM,
+		extension.Footnote,
+		highlighting.NewHighlighting(
+			highlighting.WithStyle(markdownHighlightStyle),
+			highlighting.WithFormatOptions(chromahtml.WithClasses(true)),
+		),
+	),
+	goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+	goldmark.WithRendererOptions(html.WithUnsafe()),
+)
+
+// highlightCSS 代码高亮的样式表，第一次使用时生成
+var highlightCSS = struct {
+	once sync.Once
+	css  string
+}{}
+
+// ImageAltText 返回附件图片的替代文本，没有时返回空字符串
+type ImageAltText func(attachmentID uint) string
+
+// RenderMarkdown 将Markdown渲染为经过清理的HTML片段，可以直接插入页面
+// altText 不为nil时，没有写替代文本的附件图片（例如 ![](/api/attachments/12)）使用它返回的文本作为alt
+func RenderMarkdown(source string, altText ImageAltText) (string, error) {
+	src := []byte(source)
+	context := parser.NewContext(parser.WithIDs(&headingIDs{used: make(map[string]bool)}))
+	doc := markdownRenderer.Parser().Parse(text.NewReader(src), parser.WithContext(context))
+	if altText != nil {
+		fillImageAltText(doc, altText)
+	}
+
+	var buf bytes.Buffer
+	if err := markdownRenderer.Renderer().Render(&buf, src, doc); err != nil {
+		return "", err
+	}
+	return SanitizeHTML(buf.String()), nil
+}
+
+// fillImageAltText 为没有替代文本的附件图片补全alt
+func fillImageAltText(doc ast.Node, altText ImageAltText) {
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		image, ok := n.(*ast.Image)
+		if !entering || !ok || image.HasChildren() {
+			return ast.WalkContinue, nil
+		}
+		if ids := ParseAttachmentReferences(string(image.Destination)); len(ids) == 1 {
+			if alt := altText(ids[0]); alt != "" {
+				image.AppendChild(image, ast.NewString([]byte(alt)))
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+// headingIDs 生成标题锚点，保留中文等Unicode字母，重复时添加序号
+type headingIDs struct {
+	used map[string]bool
+}
+
+// Generate 根据标题文本生成锚点
+func (ids *headingIDs) Generate(value []byte, kind ast.NodeKind) []byte {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(string(value)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsNumber(r) || r == '_':
+			b.WriteRune(r)
+			dash = false
+		case (unicode.IsSpace(r) || r == '-') && b.Len() > 0 && !dash:
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	id := strings.TrimSuffix(b.String(), "-")
+	if id == "" {
+		id = "heading"
+	}
+	if ids.used[id] {
+		for i := 1; ; i++ {
+			if candidate := id + "-" + strconv.Itoa(i); !ids.used[candidate] {
+				id = candidate
+				break
+			}
+		}
+	}
+	ids.used[id] = true
+	return []byte(id)
+}
+
+// Put 记录已使用的锚点（标题中显式指定的ID）
+func (ids *headingIDs) Put(value []byte) {
+	ids.used[string(value)] = true
+}
+
+// MarkdownHighlightCSS 返回渲染结果中代码高亮所需的样式表
+func MarkdownHighlightCSS() string {
+	highlightCSS.once.Do(func() {
+		var b strings.Builder
+		formatter := chromahtml.New(chromahtml.WithClasses(true))
+		if err := formatter.WriteCSS(&b, styles.Get(markdownHighlightStyle)); err == nil {
+			highlightCSS.css = b.String()
+		}
+	})
+	return highlightCSS.css
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderMarkdownImageAltText(t *testing.T) {
+	altTexts := map[uint]string{1: `日落 "海边"`, 2: ""}
+	altText := func(id uint) string {
+		return altTexts[id]
+	}
+
+	tests := []struct {
+		name     string
+		markdown string
+		want     string
+	}{
+		{"补全缺省的alt", "![](/api/attachments/1?size=thumb)", `<img src="/api/attachments/1?size=thumb" alt="日落 &#34;海边&#34;"/>`},
+		{"保留笔记中写的alt", "![自定义](/api/attachments/1)", `<img src="/api/attachments/1" alt="自定义"/>`},
+		{"附件没有替代文本", "![](/api/attachments/2)", `<img src="/api/attachments/2" alt=""/>`},
+		{"不是附件的图片", "![](https://example.com/a.png)", `<img src="https://example.com/a.png" alt=""/>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RenderMarkdown(tt.markdown, altText)
+			if err != nil {
+				t.Fatalf("RenderMarkdown: %v", err)
+			}
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("RenderMarkdown(%q) = %q, want %q", tt.markdown, got, tt.want)
+			}
+		})
+	}
+
+	if got, _ := RenderMarkdown("![](/api/attachments/1)", nil); !strings.Contains(got, `alt=""`) {
+		t.Errorf("RenderMarkdown without altText = %q", got)
+	}
+}
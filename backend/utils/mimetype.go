@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path/filepath"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// ErrFileTypeNotAllowed 文件类型不允许上传
+var ErrFileTypeNotAllowed = errors.New("不允许上传此类型的文件")
+
+// ErrFileTooLarge 文件超过该类型允许的最大大小
+var ErrFileTooLarge = errors.New("文件大小超过限制")
+
+// inlineSafeTypes 可以在浏览器中直接显示的文件类型
+// SVG、HTML等可以执行脚本的类型不在其中，始终作为附件下载
+var inlineSafeTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+	"image/bmp":  true,
+	"image/avif": true,
+}
+
+// textExtensionTypes 无法通过文件内容区分、只能根据扩展名判断的文本类型
+var textExtensionTypes = map[string]string{
+	".md":       "text/markdown",
+	".markdown": "text/markdown",
+}
+
+// DetectContentType 根据文件内容的魔数检测文件类型，并与文件扩展名核对
+// 返回检测到的类型，以及与类型一致的文件名：扩展名与内容不符时替换为该类型的标准扩展名
+// 检测后将读取位置恢复到文件开头
+func DetectContentType(file io.ReadSeeker, filename string) (string, string, error) {
+	detected, err := mimetype.DetectReader(file)
+	if err != nil {
+		return "", "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", "", err
+	}
+
+	contentType := baseContentType(detected.String())
+	ext := strings.ToLower(filepath.Ext(filename))
+
+	// 纯文本内容可以使用扩展名提供的更具体的文本类型（例如Markdown）
+	if textType, ok := textExtensionTypes[ext]; ok && contentType == "text/plain" {
+		return textType, filename, nil
+	}
+
+	// 内容可以识别为具体格式，且与扩展名声明的类型不符时（例如内容为HTML的.png文件），改为检测到的类型的扩展名
+	// 纯文本和无法识别的二进制内容保留原扩展名
+	if contentType == "text/plain" || contentType == "application/octet-stream" || detected.Extension() == "" {
+		return contentType, filename, nil
+	}
+	extType := baseContentType(mime.TypeByExtension(ext))
+	if extType != "" && ext != detected.Extension() && !detected.Is(extType) {
+		filename = strings.TrimSuffix(filename, filepath.Ext(filename)) + detected.Extension()
+	}
+	return contentType, filename, nil
+}
+
+// baseContentType 去掉文件类型中的参数，例如 text/plain; charset=utf-8 -> text/plain
+func baseContentType(contentType string) string {
+	if idx := strings.Index(contentType, ";"); idx != -1 {
+		contentType = contentType[:idx]
+	}
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
+
+// IsInlineSafe 检查文件类型是否可以在浏览器中直接显示
+func IsInlineSafe(contentType string) bool {
+	return inlineSafeTypes[baseContentType(contentType)]
+}
+
+// UploadPolicy 上传文件的类型和大小限制
+// 类型可以使用 image/* 形式的通配符
+type UploadPolicy struct {
+	Allowed  []string         // 允许的类型，为空时允许所有未被禁止的类型
+	Denied   []string         // 禁止的类型，优先于Allowed
+	MaxSizes map[string]int64 // 按类型限制的最大大小（字节）
+	MaxSize  int64            // 未单独限制的类型的最大大小（字节），0表示不限制
+}
+
+// Check 检查文件类型和大小是否符合上传限制
+func (p *UploadPolicy) Check(contentType string, size int64) error {
+	contentType = baseContentType(contentType)
+
+	if matchContentType(p.Denied, contentType) {
+		return ErrFileTypeNotAllowed
+	}
+	if len(p.Allowed) > 0 && !matchContentType(p.Allowed, contentType) {
+		return ErrFileTypeNotAllowed
+	}
+
+	if limit := p.maxSizeFor(contentType); limit > 0 && size > limit {
+		return fmt.Errorf("%w：%s 类型的文件不能超过 %d MB", ErrFileTooLarge, contentType, limit/1024/1024)
+	}
+	return nil
+}
+
+// maxSizeFor 获取类型的最大大小，精确匹配优先于通配符
+func (p *UploadPolicy) maxSizeFor(contentType string) int64 {
+	if limit, ok := p.MaxSizes[contentType]; ok {
+		return limit
+	}
+	if idx := strings.Index(contentType, "/"); idx != -1 {
+		if limit, ok := p.MaxSizes[contentType[:idx]+"/*"]; ok {
+			return limit
+		}
+	}
+	return p.MaxSize
+}
+
+// matchContentType 检查类型是否匹配列表中的任意一项
+func matchContentType(patterns []string, contentType string) bool {
+	for _, pattern := range patterns {
+		if pattern == "*" || pattern == "*/*" || pattern == contentType {
+			return true
+		}
+		if strings.HasSuffix(pattern, "/*") && strings.HasPrefix(contentType, strings.TrimSuffix(pattern, "*")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"html/template"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// NoteDocument 导出的单篇笔记
+type NoteDocument struct {
+	Title     string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Tags      []string
+	Body      string // 渲染后的HTML片段，图片已内联为data URI
+}
+
+// Meta 笔记的时间和标签说明，显示在标题下方
+func (d *NoteDocument) Meta() string {
+	parts := []string{
+		"创建于 " + d.CreatedAt.Format("2006-01-02 15:04"),
+		"更新于 " + d.UpdatedAt.Format("2006-01-02 15:04"),
+	}
+	if len(d.Tags) > 0 {
+		parts = append(parts, "标签："+strings.Join(d.Tags, "、"))
+	}
+	return strings.Join(parts, " · ")
+}
+
+// noteHTMLStyle 导出的HTML文档的样式
+const noteHTMLStyle = `
+body { margin: 0; background: #fff; color: #24292f; font: 16px/1.7 -apple-system, "Segoe UI", "PingFang SC", "Microsoft YaHei", "Noto Sans CJK SC", sans-serif; }
+article { max-width: 820px; margin: 0 auto; padding: 40px 24px; }
+.note-title { margin: 0 0 8px; font-size: 2em; line-height: 1.3; }
+.note-meta { margin: 0 0 24px; padding-bottom: 16px; border-bottom: 1px solid #d0d7de; color: #57606a; font-size: 14px; }
+h1, h2, h3, h4, h5, h6 { margin: 1.5em 0 .6em; line-height: 1.3; }
+h1, h2 { padding-bottom: .3em; border-bottom: 1px solid #d0d7de; }
+a { color: #0969da; }
+img { max-width: 100%; }
+blockquote { margin: 0 0 1em; padding: 0 1em; border-left: 4px solid #d0d7de; color: #57606a; }
+code, pre { font-family: ui-monospace, SFMono-Regular, Consolas, "Liberation Mono", monospace; font-size: 85%; }
+code { padding: .2em .4em; border-radius: 6px; background: #f6f8fa; }
+pre { padding: 16px; overflow: auto; border-radius: 6px; background: #f6f8fa; line-height: 1.45; }
+pre code { padding: 0; background: none; font-size: 100%; }
+table { border-collapse: collapse; margin: 0 0 1em; display: block; overflow: auto; }
+th, td { padding: 6px 13px; border: 1px solid #d0d7de; }
+th { background: #f6f8fa; }
+li > input[type=checkbox] { margin-right: .4em; }
+.footnotes { margin-top: 2em; color: #57606a; font-size: 14px; }
+hr { border: 0; border-top: 1px solid #d0d7de; }
+@media print { article { padding: 0; } pre, table { break-inside: avoid; } }
+`
+
+// noteHTMLTemplate 导出的独立HTML文档
+var noteHTMLTemplate = template.Must(template.New("note").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>{{.Style}}{{.HighlightStyle}}</style>
+</head>
+<body>
+<article>
+<h1 class="note-title">{{.Title}}</h1>
+<p class="note-meta">{{.Meta}}</p>
+{{.Body}}
+</article>
+</body>
+</html>
+`))
+
+// NoteHTML 生成可以独立打开的HTML文档，样式和图片都包含在文档中
+func NoteHTML(doc *NoteDocument) ([]byte, error) {
+	var buf bytes.Buffer
+	err := noteHTMLTemplate.Execute(&buf, map[string]interface{}{
+		"Title":          doc.Title,
+		"Meta":           doc.Meta(),
+		"Style":          template.CSS(noteHTMLStyle),
+		"HighlightStyle": template.CSS(MarkdownHighlightCSS()),
+		"Body":           template.HTML(doc.Body),
+	})
+	return buf.Bytes(), err
+}
+
+// InlineImages 将HTML片段中的图片替换为data URI
+// load 返回图片的内容和类型，返回false时保留原地址
+func InlineImages(fragment string, load func(src string) ([]byte, string, bool)) (string, error) {
+	context := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(fragment), context)
+	if err != nil {
+		return "", err
+	}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Img {
+			for i := range n.Attr {
+				if n.Attr[i].Key != "src" || strings.HasPrefix(n.Attr[i].Val, "data:") {
+					continue
+				}
+				if data, contentType, ok := load(n.Attr[i].Val); ok {
+					n.Attr[i].Val = "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(data)
+				}
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+
+	var b strings.Builder
+	for _, n := range nodes {
+		walk(n)
+		if err := html.Render(&b, n); err != nil {
+			return "", err
+		}
+	}
+	return b.String(), nil
+}
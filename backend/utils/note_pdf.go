@@ -0,0 +1,846 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// PDF排版参数（单位为点）
+const (
+	pdfMargin         = 56.0
+	pdfBodySize       = 10.5
+	pdfCodeSize       = 9.0
+	pdfLineHeight     = 1.6
+	pdfBlockSpacing   = 8.0
+	pdfListIndent     = 18.0
+	pdfQuoteIndent    = 14.0
+	pdfCodePadding    = 6.0
+	pdfCellPadding    = 5.0
+	pdfImageMaxPixels = 1600
+)
+
+// pdfHeadingSizes 各级标题的字号
+var pdfHeadingSizes = map[string]float64{"h1": 20, "h2": 16, "h3": 14, "h4": 12, "h5": 11, "h6": 10.5}
+
+// PDF中使用的颜色
+var (
+	pdfTextColor   = pdfColor{0.14, 0.16, 0.18}
+	pdfMutedColor  = pdfColor{0.34, 0.38, 0.42}
+	pdfLinkColor   = pdfColor{0.04, 0.41, 0.85}
+	pdfBorderColor = pdfColor{0.82, 0.84, 0.87}
+	pdfCodeBg      = pdfColor{0.96, 0.97, 0.98}
+)
+
+// pdfStyle 文本样式
+type pdfStyle struct {
+	size   float64
+	bold   bool
+	italic bool
+	mono   bool
+	code   bool // 行内代码，绘制背景
+	strike bool
+	color  pdfColor
+	link   string
+}
+
+// font 返回显示字符使用的字体，标准字体无法编码的字符使用中文字体
+func (s pdfStyle) font(r rune) pdfFont {
+	if _, ok := winAnsiByte(r); !ok {
+		return pdfCJK
+	}
+	switch {
+	case s.mono:
+		return pdfCourier
+	case s.bold && s.italic:
+		return pdfHelveticaBoldOblique
+	case s.bold:
+		return pdfHelveticaBold
+	case s.italic:
+		return pdfHelveticaOblique
+	}
+	return pdfHelvetica
+}
+
+// pdfSpan 行内内容：文本、图片或任务列表的复选框
+type pdfSpan struct {
+	text     string
+	style    pdfStyle
+	image    string // 图片地址
+	alt      string
+	checkbox int // 0 非复选框，1 未勾选，2 已勾选
+}
+
+// pdfWord 排版的最小单位：西文单词、单个中文字符、空白或换行
+type pdfWord struct {
+	text     string
+	style    pdfStyle
+	font     pdfFont
+	width    float64
+	space    bool
+	newline  bool
+	checkbox int
+}
+
+// pdfQuote 未结束的引用块，用于在换页时绘制左侧竖线
+type pdfQuote struct {
+	x   float64
+	top float64
+}
+
+// pdfPlacedImage 已添加到文档的图片
+type pdfPlacedImage struct {
+	index         int
+	width, height float64
+}
+
+// pdfLayout 将渲染后的HTML排版到PDF页面
+type pdfLayout struct {
+	doc    *pdfDocument
+	page   *pdfPage
+	y      float64 // 下一行顶部的位置
+	left   float64
+	right  float64
+	marker *pdfSpan // 等待绘制的列表标记，绘制在下一行的左侧
+	quotes []pdfQuote
+	images map[string]*pdfPlacedImage
+}
+
+// NotePDF 将导出的笔记排版为PDF，包括标题、时间和标签以及渲染后的正文
+func NotePDF(doc *NoteDocument) ([]byte, error) {
+	context := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(doc.Body), context)
+	if err != nil {
+		return nil, err
+	}
+	root := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+	for _, n := range nodes {
+		root.AppendChild(n)
+	}
+
+	l := &pdfLayout{
+		doc:    &pdfDocument{title: doc.Title},
+		left:   pdfMargin,
+		right:  pdfPageWidth - pdfMargin,
+		images: make(map[string]*pdfPlacedImage),
+	}
+	l.newPage()
+
+	base := pdfStyle{size: pdfBodySize, color: pdfTextColor}
+	title := base
+	title.size, title.bold = 20, true
+	l.text([]pdfSpan{{text: doc.Title, style: title}}, title.size)
+	meta := base
+	meta.size, meta.color = 9, pdfMutedColor
+	l.text([]pdfSpan{{text: doc.Meta(), style: meta}}, meta.size)
+	l.space(6)
+	l.rule()
+	l.space(12)
+
+	l.blocks(root, base)
+
+	// 页码
+	for i, page := range l.doc.pages {
+		number := fmt.Sprintf("%d / %d", i+1, len(l.doc.pages))
+		width := pdfTextWidth(pdfHelvetica, 8, number)
+		page.text((pdfPageWidth-width)/2, pdfMargin/2, pdfHelvetica, 8, pdfMutedColor, number, false)
+	}
+
+	var buf bytes.Buffer
+	if err := l.doc.write(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// newPage 换页，未结束的引用块在两页分别绘制竖线
+func (l *pdfLayout) newPage() {
+	if l.page != nil {
+		for _, quote := range l.quotes {
+			l.quoteBar(quote, pdfMargin)
+		}
+	}
+	l.page = l.doc.addPage()
+	l.y = pdfPageHeight - pdfMargin
+	for i := range l.quotes {
+		l.quotes[i].top = l.y
+	}
+}
+
+// atTop 是否位于页面顶部
+func (l *pdfLayout) atTop() bool {
+	return l.y >= pdfPageHeight-pdfMargin-0.1
+}
+
+// ensure 剩余空间不足height时换页
+func (l *pdfLayout) ensure(height float64) {
+	if l.y-height < pdfMargin && !l.atTop() {
+		l.newPage()
+	}
+}
+
+// space 添加垂直间距，页面顶部不添加
+func (l *pdfLayout) space(height float64) {
+	if !l.atTop() {
+		l.y -= height
+	}
+}
+
+// rule 绘制水平分隔线
+func (l *pdfLayout) rule() {
+	l.ensure(1)
+	l.page.line(l.left, l.y, l.right, l.y, 0.75, pdfBorderColor)
+	l.y -= 1
+}
+
+// quoteBar 绘制引用块左侧的竖线
+func (l *pdfLayout) quoteBar(quote pdfQuote, bottom float64) {
+	if quote.top > bottom {
+		l.page.rect(quote.x, bottom, 3, quote.top-bottom, pdfBorderColor)
+	}
+}
+
+// blocks 排版元素的子节点，连续的行内内容作为一个段落
+func (l *pdfLayout) blocks(n *html.Node, style pdfStyle) {
+	var spans []pdfSpan
+	flush := func() {
+		if len(spans) > 0 {
+			l.paragraph(spans, style.size)
+			spans = nil
+		}
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode && markdownBlockElements[child.Data] {
+			flush()
+			l.block(child, style)
+			continue
+		}
+		spans = l.inline(child, style, spans)
+	}
+	flush()
+}
+
+// block 排版块级元素
+func (l *pdfLayout) block(n *html.Node, style pdfStyle) {
+	switch n.Data {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		heading := style
+		heading.size, heading.bold = pdfHeadingSizes[n.Data], true
+		l.space(heading.size * 0.6)
+		l.paragraph(l.inlineChildren(n, heading), heading.size)
+		if n.Data == "h1" || n.Data == "h2" {
+			l.space(2)
+			l.rule()
+		}
+		l.space(pdfBlockSpacing * 0.75)
+	case "p":
+		l.paragraph(l.inlineChildren(n, style), style.size)
+		l.space(pdfBlockSpacing)
+	case "ul", "ol":
+		l.list(n, style)
+		if n.Parent == nil || n.Parent.Data != "li" {
+			l.space(pdfBlockSpacing)
+		}
+	case "blockquote":
+		quote := style
+		quote.color = pdfMutedColor
+		l.quotes = append(l.quotes, pdfQuote{x: l.left, top: l.y})
+		l.left += pdfQuoteIndent
+		l.blocks(n, quote)
+		l.left -= pdfQuoteIndent
+		l.quoteBar(l.quotes[len(l.quotes)-1], l.y)
+		l.quotes = l.quotes[:len(l.quotes)-1]
+		l.space(pdfBlockSpacing)
+	case "pre":
+		l.pre(n, style)
+		l.space(pdfBlockSpacing)
+	case "table":
+		l.table(n, style)
+		l.space(pdfBlockSpacing)
+	case "hr":
+		l.space(pdfBlockSpacing)
+		l.rule()
+		l.space(pdfBlockSpacing)
+	default:
+		l.blocks(n, style)
+	}
+}
+
+// inlineChildren 收集元素的行内内容
+func (l *pdfLayout) inlineChildren(n *html.Node, style pdfStyle) []pdfSpan {
+	var spans []pdfSpan
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		spans = l.inline(child, style, spans)
+	}
+	return spans
+}
+
+// inline 收集行内内容
+func (l *pdfLayout) inline(n *html.Node, style pdfStyle, spans []pdfSpan) []pdfSpan {
+	if n.Type == html.TextNode {
+		return append(spans, pdfSpan{text: collapseWhitespace(n.Data), style: style})
+	}
+	if n.Type != html.ElementNode || markdownSkippedElements[n.Data] {
+		return spans
+	}
+
+	switch n.Data {
+	case "br":
+		return append(spans, pdfSpan{text: "\n", style: style})
+	case "img":
+		return append(spans, pdfSpan{image: attr(n, "src"), alt: attr(n, "alt"), style: style})
+	case "input":
+		if attr(n, "type") != "checkbox" {
+			return spans
+		}
+		checkbox := 1
+		for _, a := range n.Attr {
+			if a.Key == "checked" {
+				checkbox = 2
+			}
+		}
+		return append(spans, pdfSpan{checkbox: checkbox, style: style})
+	case "strong", "b":
+		style.bold = true
+	case "em", "i":
+		style.italic = true
+	case "code", "kbd", "samp":
+		style.mono, style.code = true, true
+	case "del", "s", "strike":
+		style.strike = true
+	case "sup", "sub":
+		style.size *= 0.8
+	case "a":
+		// 脚注的返回链接在PDF中没有意义
+		if strings.Contains(attr(n, "class"), "footnote-backref") {
+			return spans
+		}
+		href := attr(n, "href")
+		lower := strings.ToLower(href)
+		if strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "mailto:") {
+			style.link = href
+			style.color = pdfLinkColor
+		}
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		spans = l.inline(child, style, spans)
+	}
+	return spans
+}
+
+// paragraph 排版段落，图片单独占据一行
+func (l *pdfLayout) paragraph(spans []pdfSpan, size float64) {
+	var run []pdfSpan
+	for _, span := range spans {
+		if span.image != "" || span.alt != "" {
+			l.text(run, size)
+			run = nil
+			l.image(span)
+			continue
+		}
+		run = append(run, span)
+	}
+	l.text(run, size)
+}
+
+// text 按页面宽度折行并绘制文本
+func (l *pdfLayout) text(spans []pdfSpan, size float64) {
+	words := pdfTokenize(spans, false)
+	if !pdfHasContent(words) {
+		return
+	}
+	for _, line := range pdfWrap(words, l.right-l.left, false) {
+		lineSize := pdfLineSize(line, size)
+		height := lineSize * pdfLineHeight
+		l.ensure(height)
+		baseline := l.y - (height-lineSize)/2 - lineSize*0.8
+		if l.marker != nil {
+			width := pdfTextWidth(l.marker.style.font(' '), l.marker.style.size, l.marker.text)
+			l.drawWords([]pdfWord{pdfWordOf(l.marker.text, l.marker.style)}, l.left-width-5, baseline)
+			l.marker = nil
+		}
+		l.drawWords(line, l.left, baseline)
+		l.y -= height
+	}
+}
+
+// drawWords 在基线位置绘制一行，相同样式的相邻单词合并绘制
+func (l *pdfLayout) drawWords(line []pdfWord, x, baseline float64) {
+	for i := 0; i < len(line); {
+		word := line[i]
+		if word.checkbox != 0 {
+			size := word.style.size * 0.85
+			l.page.strokeRect(x+0.5, baseline-word.style.size*0.1, size, size, 0.75, pdfMutedColor)
+			if word.checkbox == 2 {
+				l.page.check(x+0.5, baseline-word.style.size*0.1, size, pdfTextColor)
+			}
+			x += word.width
+			i++
+			continue
+		}
+
+		var text strings.Builder
+		width := 0.0
+		j := i
+		for ; j < len(line) && line[j].checkbox == 0 && line[j].font == word.font && line[j].style == word.style; j++ {
+			text.WriteString(line[j].text)
+			width += line[j].width
+		}
+		style := word.style
+		if style.code {
+			l.page.rect(x, baseline-style.size*0.25, width, style.size*1.15, pdfCodeBg)
+		}
+		l.page.text(x, baseline, word.font, style.size, style.color, text.String(), style.bold && word.font == pdfCJK)
+		if style.strike {
+			l.page.line(x, baseline+style.size*0.3, x+width, baseline+style.size*0.3, style.size*0.06, style.color)
+		}
+		if style.link != "" {
+			l.page.line(x, baseline-style.size*0.12, x+width, baseline-style.size*0.12, style.size*0.05, style.color)
+			l.page.link(x, baseline-style.size*0.25, width, style.size*1.2, style.link)
+		}
+		x += width
+		i = j
+	}
+}
+
+// list 排版有序或无序列表
+func (l *pdfLayout) list(n *html.Node, style pdfStyle) {
+	number := 1
+	if start, err := strconv.Atoi(attr(n, "start")); err == nil {
+		number = start
+	}
+	for item := n.FirstChild; item != nil; item = item.NextSibling {
+		if item.Type != html.ElementNode || item.Data != "li" {
+			continue
+		}
+		marker := "•"
+		if n.Data == "ol" {
+			marker = strconv.Itoa(number) + "."
+			number++
+		}
+		if pdfIsTaskItem(item) {
+			l.marker = nil
+		} else {
+			l.marker = &pdfSpan{text: marker, style: style}
+		}
+		l.left += pdfListIndent
+		l.blocks(item, style)
+		l.left -= pdfListIndent
+		l.marker = nil
+	}
+}
+
+// pdfIsTaskItem 检查列表项是否以复选框开头
+func pdfIsTaskItem(item *html.Node) bool {
+	for child := item.FirstChild; child != nil; child = child.NextSibling {
+		switch {
+		case child.Type == html.TextNode && strings.TrimSpace(child.Data) == "":
+			continue
+		case child.Type == html.ElementNode && child.Data == "p":
+			return pdfIsTaskItem(child)
+		case child.Type == html.ElementNode && child.Data == "input":
+			return attr(child, "type") == "checkbox"
+		}
+		return false
+	}
+	return false
+}
+
+// pre 排版代码块，保留空白并在超出宽度时按字符折行
+func (l *pdfLayout) pre(n *html.Node, style pdfStyle) {
+	code := pdfStyle{size: pdfCodeSize, mono: true, color: pdfTextColor}
+	words := pdfTokenize([]pdfSpan{{text: textContent(n), style: code}}, true)
+	lines := pdfWrap(words, l.right-l.left-2*pdfCodePadding, true)
+	lineHeight := code.size * 1.45
+	for i, line := range lines {
+		height, top := lineHeight, 0.0
+		if i == 0 {
+			height += pdfCodePadding
+			top = pdfCodePadding
+		}
+		if i == len(lines)-1 {
+			height += pdfCodePadding
+		}
+		l.ensure(height)
+		l.page.rect(l.left, l.y-height, l.right-l.left, height, pdfCodeBg)
+		baseline := l.y - top - (lineHeight-code.size)/2 - code.size*0.8
+		l.drawWords(line, l.left+pdfCodePadding, baseline)
+		l.y -= height
+	}
+}
+
+// pdfCell 表格单元格
+type pdfCell struct {
+	words  []pdfWord
+	header bool
+	align  string
+}
+
+// table 排版表格，列宽按内容宽度分配
+func (l *pdfLayout) table(n *html.Node, style pdfStyle) {
+	var rows [][]pdfCell
+	var walk func(node *html.Node)
+	walk = func(node *html.Node) {
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != html.ElementNode {
+				continue
+			}
+			if child.Data != "tr" {
+				walk(child)
+				continue
+			}
+			var row []pdfCell
+			for cell := child.FirstChild; cell != nil; cell = cell.NextSibling {
+				if cell.Type != html.ElementNode || (cell.Data != "td" && cell.Data != "th") {
+					continue
+				}
+				cellStyle := style
+				cellStyle.bold = cell.Data == "th"
+				row = append(row, pdfCell{
+					words:  pdfTokenize(l.inlineChildren(cell, cellStyle), false),
+					header: cell.Data == "th",
+					align:  pdfCellAlign(cell),
+				})
+			}
+			rows = append(rows, row)
+		}
+	}
+	walk(n)
+
+	columns := 0
+	for _, row := range rows {
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+	if columns == 0 {
+		return
+	}
+
+	// 按各列内容的宽度分配，每列至少分得平均宽度的40%
+	available := l.right - l.left
+	natural := make([]float64, columns)
+	total := 0.0
+	for _, row := range rows {
+		for i, cell := range row {
+			width := 0.0
+			for _, word := range cell.words {
+				width += word.width
+			}
+			if width > natural[i] {
+				natural[i] = width
+			}
+		}
+	}
+	for _, width := range natural {
+		total += width + 2*pdfCellPadding
+	}
+	widths := make([]float64, columns)
+	for i := range widths {
+		switch {
+		case total <= available:
+			widths[i] = natural[i] + 2*pdfCellPadding
+		default:
+			base := available / float64(columns) * 0.4
+			widths[i] = base + (available-base*float64(columns))*(natural[i]+2*pdfCellPadding)/total
+		}
+	}
+
+	for _, row := range rows {
+		lines := make([][][]pdfWord, columns)
+		height := 0.0
+		for i, cell := range row {
+			lines[i] = pdfWrap(cell.words, widths[i]-2*pdfCellPadding, false)
+			cellHeight := 0.0
+			for _, line := range lines[i] {
+				cellHeight += pdfLineSize(line, style.size) * 1.45
+			}
+			if cellHeight > height {
+				height = cellHeight
+			}
+		}
+		if height == 0 {
+			height = style.size * 1.45
+		}
+		height += 2 * pdfCellPadding
+		l.ensure(height)
+
+		x := l.left
+		for i := 0; i < columns; i++ {
+			if i < len(row) && row[i].header {
+				l.page.rect(x, l.y-height, widths[i], height, pdfCodeBg)
+			}
+			if i < len(row) {
+				y := l.y - pdfCellPadding
+				for _, line := range lines[i] {
+					lineSize := pdfLineSize(line, style.size)
+					lineHeight := lineSize * 1.45
+					offset := 0.0
+					if free := widths[i] - 2*pdfCellPadding - pdfLineWidth(line); free > 0 {
+						switch row[i].align {
+						case "center":
+							offset = free / 2
+						case "right":
+							offset = free
+						}
+					}
+					l.drawWords(line, x+pdfCellPadding+offset, y-(lineHeight-lineSize)/2-lineSize*0.8)
+					y -= lineHeight
+				}
+			}
+			l.page.strokeRect(x, l.y-height, widths[i], height, 0.5, pdfBorderColor)
+			x += widths[i]
+		}
+		l.y -= height
+	}
+}
+
+// pdfCellAlign 单元格的对齐方式，支持 align 属性和 text-align 样式
+func pdfCellAlign(cell *html.Node) string {
+	if align := attr(cell, "align"); align != "" {
+		return strings.ToLower(align)
+	}
+	style := strings.ReplaceAll(strings.ToLower(attr(cell, "style")), " ", "")
+	for _, align := range []string{"center", "right"} {
+		if strings.Contains(style, "text-align:"+align) {
+			return align
+		}
+	}
+	return ""
+}
+
+// image 绘制图片，无法加载的图片显示替代文本
+func (l *pdfLayout) image(span pdfSpan) {
+	placed, ok := l.images[span.image]
+	if !ok {
+		if img, err := pdfImageFromDataURI(span.image); err == nil {
+			placed = &pdfPlacedImage{
+				index: l.doc.addImage(img),
+				// 按96dpi换算为点
+				width:  float64(img.width) * 0.75,
+				height: float64(img.height) * 0.75,
+			}
+		}
+		l.images[span.image] = placed
+	}
+	if placed == nil {
+		alt := span.style
+		alt.color = pdfMutedColor
+		text := "[图片]"
+		if span.alt != "" {
+			text = "[图片：" + span.alt + "]"
+		}
+		l.text([]pdfSpan{{text: text, style: alt}}, alt.size)
+		return
+	}
+
+	width, height := placed.width, placed.height
+	if maxWidth := l.right - l.left; width > maxWidth {
+		width, height = maxWidth, height*maxWidth/width
+	}
+	if maxHeight := (pdfPageHeight - 2*pdfMargin) * 0.9; height > maxHeight {
+		width, height = width*maxHeight/height, maxHeight
+	}
+	l.space(4)
+	l.ensure(height)
+	l.page.image(placed.index, l.left, l.y-height, width, height)
+	l.y -= height + 4
+}
+
+// pdfImageFromDataURI 解码data URI中的图片，缩小后合成到白色背景上并编码为JPEG
+func pdfImageFromDataURI(src string) (*pdfImage, error) {
+	comma := strings.IndexByte(src, ',')
+	if !strings.HasPrefix(src, "data:") || comma < 0 || !strings.HasSuffix(src[:comma], ";base64") {
+		return nil, errors.New("不支持的图片地址")
+	}
+	data, err := base64.StdEncoding.DecodeString(src[comma+1:])
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := DecodeImage(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	img = ResizeImage(img, pdfImageMaxPixels)
+
+	// JPEG不支持透明，透明部分显示为白色
+	bounds := img.Bounds()
+	canvas := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(canvas, canvas.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(canvas, canvas.Bounds(), img, bounds.Min, draw.Over)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, canvas, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, err
+	}
+	return &pdfImage{width: bounds.Dx(), height: bounds.Dy(), data: buf.Bytes()}, nil
+}
+
+// pdfWordOf 生成单个单词
+func pdfWordOf(text string, style pdfStyle) pdfWord {
+	font := style.font(' ')
+	for _, r := range text {
+		font = style.font(r)
+		break
+	}
+	return pdfWord{text: text, style: style, font: font, width: pdfTextWidth(font, style.size, text)}
+}
+
+// pdfTokenize 将行内内容拆分为单词；pre为true时保留所有空白
+func pdfTokenize(spans []pdfSpan, pre bool) []pdfWord {
+	var words []pdfWord
+	for _, span := range spans {
+		if span.checkbox != 0 {
+			words = append(words, pdfWord{checkbox: span.checkbox, style: span.style, width: span.style.size * 1.3})
+			continue
+		}
+
+		var buf strings.Builder
+		font := pdfHelvetica
+		flush := func() {
+			if buf.Len() > 0 {
+				text := buf.String()
+				words = append(words, pdfWord{text: text, style: span.style, font: font, width: pdfTextWidth(font, span.style.size, text)})
+				buf.Reset()
+			}
+		}
+		for _, r := range span.text {
+			switch {
+			case r == '\n':
+				flush()
+				words = append(words, pdfWord{newline: true, style: span.style})
+			case unicode.IsSpace(r):
+				flush()
+				if !pre && (len(words) == 0 || words[len(words)-1].space || words[len(words)-1].newline) {
+					continue
+				}
+				space := " "
+				if r == '\t' && pre {
+					space = "    "
+				}
+				word := pdfWordOf(space, span.style)
+				word.space = true
+				words = append(words, word)
+			default:
+				runeFont := span.style.font(r)
+				if buf.Len() > 0 && runeFont != font {
+					flush()
+				}
+				font = runeFont
+				buf.WriteRune(r)
+				// 中文在任意字符之间都可以折行
+				if font == pdfCJK && !pre {
+					flush()
+				}
+			}
+		}
+		flush()
+	}
+	return words
+}
+
+// pdfWrap 按宽度折行；pre为true时保留行首空白，只有自动折行的行去掉行首空白
+func pdfWrap(words []pdfWord, width float64, pre bool) [][]pdfWord {
+	var lines [][]pdfWord
+	var line []pdfWord
+	lineWidth := 0.0
+	wrapped := false
+	breakLine := func() {
+		lines = append(lines, pdfTrimSpaces(line))
+		line, lineWidth = nil, 0
+	}
+
+	for _, word := range words {
+		switch {
+		case word.newline:
+			breakLine()
+			wrapped = false
+			continue
+		case word.space:
+			if len(line) == 0 && (!pre || wrapped) {
+				continue
+			}
+			line = append(line, word)
+			lineWidth += word.width
+			continue
+		}
+
+		if lineWidth+word.width > width && pdfHasContent(line) {
+			breakLine()
+			wrapped = true
+		}
+		// 超过整行宽度的单词按字符拆分
+		for word.width > width && len([]rune(word.text)) > 1 {
+			runes := []rune(word.text)
+			n := 1
+			for n < len(runes) && pdfTextWidth(word.font, word.style.size, string(runes[:n+1]))+lineWidth <= width {
+				n++
+			}
+			head := word
+			head.text = string(runes[:n])
+			head.width = pdfTextWidth(word.font, word.style.size, head.text)
+			line = append(line, head)
+			breakLine()
+			wrapped = true
+			word.text = string(runes[n:])
+			word.width = pdfTextWidth(word.font, word.style.size, word.text)
+		}
+		line = append(line, word)
+		lineWidth += word.width
+	}
+	if len(line) > 0 {
+		lines = append(lines, pdfTrimSpaces(line))
+	}
+	return lines
+}
+
+// pdfTrimSpaces 去掉行尾的空白
+func pdfTrimSpaces(line []pdfWord) []pdfWord {
+	for len(line) > 0 && line[len(line)-1].space {
+		line = line[:len(line)-1]
+	}
+	return line
+}
+
+// pdfHasContent 检查是否包含空白以外的内容
+func pdfHasContent(words []pdfWord) bool {
+	for _, word := range words {
+		if !word.space && !word.newline {
+			return true
+		}
+	}
+	return false
+}
+
+// pdfLineSize 行中最大的字号，空行使用默认字号
+func pdfLineSize(line []pdfWord, size float64) float64 {
+	max := 0.0
+	for _, word := range line {
+		if word.style.size > max {
+			max = word.style.size
+		}
+	}
+	if max == 0 {
+		return size
+	}
+	return max
+}
+
+// pdfLineWidth 行的宽度
+func pdfLineWidth(line []pdfWord) float64 {
+	width := 0.0
+	for _, word := range line {
+		width += word.width
+	}
+	return width
+}
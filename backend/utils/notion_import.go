@@ -0,0 +1,333 @@
+package utils
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	// notionIDPattern Notion导出的文件名和目录名末尾的页面ID
+	notionIDPattern = regexp.MustCompile(`\s+[0-9a-f]{32}$`)
+	// notionPropertyPattern 页面标题下方的属性行，例如 Tags: a, b
+	notionPropertyPattern = regexp.MustCompile(`^([^:：\n]{1,40})[:：]\s*(.*)$`)
+)
+
+// notionTagProperties、notionCreatedProperties 作为标签和创建时间的属性名（小写）
+var (
+	notionTagProperties     = map[string]bool{"tags": true, "tag": true, "labels": true, "标签": true}
+	notionCreatedProperties = map[string]bool{"created": true, "created time": true, "created at": true, "date": true, "创建时间": true, "日期": true}
+)
+
+// notionTimeLayouts Notion导出的日期格式
+var notionTimeLayouts = append([]string{
+	"January 2, 2006 3:04 PM",
+	"January 2, 2006",
+	"2006年1月2日 15:04",
+	"2006年1月2日",
+}, frontMatterTimeLayouts...)
+
+// NotionExport Notion导出的ZIP（Markdown & CSV格式）
+// 较大的工作区导出为包含多个分卷ZIP的ZIP，打开时解压到临时目录一起解析
+type NotionExport struct {
+	readers []*zip.Reader
+	files   []*os.File
+}
+
+// OpenNotionExport 打开Notion导出的ZIP，嵌套的分卷ZIP解压到dir中，maxSize限制分卷解压后的总大小（0表示不限制）
+func OpenNotionExport(zr *zip.Reader, dir string, maxSize int64) (*NotionExport, error) {
+	export := &NotionExport{}
+
+	var nested []*zip.File
+	for _, f := range zr.File {
+		name := zipEntryName(f)
+		if isHiddenImportPath(name) || f.FileInfo().IsDir() {
+			continue
+		}
+		if strings.ToLower(path.Ext(name)) != ".zip" {
+			// 包含页面文件时不是分卷导出
+			export.readers = []*zip.Reader{zr}
+			return export, nil
+		}
+		nested = append(nested, f)
+	}
+
+	var total uint64
+	for _, f := range nested {
+		reader, err := export.openNested(f, dir)
+		if err != nil {
+			export.Close()
+			return nil, fmt.Errorf("打开 %s 失败: %v", zipEntryName(f), err)
+		}
+		for _, entry := range reader.File {
+			total += entry.UncompressedSize64
+		}
+		if maxSize > 0 && total > uint64(maxSize) {
+			export.Close()
+			return nil, fmt.Errorf("导入文件解压后不能超过 %d MB", maxSize/1024/1024)
+		}
+		export.readers = append(export.readers, reader)
+	}
+	return export, nil
+}
+
+// openNested 将分卷ZIP解压到dir中并打开
+func (e *NotionExport) openNested(f *zip.File, dir string) (*zip.Reader, error) {
+	src, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	temp, err := os.CreateTemp(dir, "notion_*.zip")
+	if err != nil {
+		return nil, err
+	}
+	e.files = append(e.files, temp)
+	size, err := io.Copy(temp, src)
+	if err != nil {
+		return nil, err
+	}
+	return zip.NewReader(temp, size)
+}
+
+// Close 关闭解压的分卷ZIP
+func (e *NotionExport) Close() error {
+	for _, f := range e.files {
+		f.Close()
+	}
+	return nil
+}
+
+// Parse 解析导出的页面和数据库
+// 每个Markdown页面导入为一篇笔记：第一行的一级标题作为笔记标题，标题下方的 Tags、Created 等属性作为标签和创建时间，
+// 父页面的路径（去掉页面ID）作为标签；页面中引用的图片和文件作为附件导入
+// 数据库（CSV）中的行补充对应页面缺少的标签和创建时间，没有对应页面的行导入为以属性列表为内容的笔记
+func (e *NotionExport) Parse() ([]ImportedNote, []ImportIssue, error) {
+	archive, names := newMarkdownArchive(e.readers...)
+
+	var notes []ImportedNote
+	var issues []ImportIssue
+	pages := make(map[string]int) // 去掉页面ID的路径（不含扩展名）-> notes中的下标
+	for _, name := range names {
+		if !isMarkdownFile(name) {
+			continue
+		}
+		f := archive.files[name]
+		data, err := readZipFile(f, maxImportMarkdownSize)
+		if err != nil {
+			issues = append(issues, ImportIssue{Path: name, Reason: "读取文件失败: " + err.Error()})
+			continue
+		}
+		note, noteIssues := archive.parseNotionPage(name, string(data))
+		pages[strings.ToLower(notionPath(strings.TrimSuffix(name, path.Ext(name))))] = len(notes)
+		notes = append(notes, note)
+		issues = append(issues, noteIssues...)
+	}
+
+	for _, name := range notionDatabases(names) {
+		data, err := readZipFile(archive.files[name], maxImportMarkdownSize)
+		if err != nil {
+			issues = append(issues, ImportIssue{Path: name, Reason: "读取文件失败: " + err.Error()})
+			continue
+		}
+		rows, err := parseNotionDatabase(name, string(data))
+		if err != nil {
+			issues = append(issues, ImportIssue{Path: name, Reason: "无法解析数据库: " + err.Error()})
+			continue
+		}
+
+		// 数据库中的页面保存在与CSV同名的目录中
+		dir := notionPath(strings.TrimSuffix(strings.TrimSuffix(name, path.Ext(name)), "_all"))
+		for _, row := range rows {
+			if i, ok := pages[strings.ToLower(dir+"/"+row.Title)]; ok {
+				note := &notes[i]
+				for _, tag := range row.Tags {
+					note.addTag(tag)
+				}
+				if note.CreatedAt.IsZero() {
+					note.CreatedAt = row.CreatedAt
+				}
+				continue
+			}
+
+			note := ImportedNote{
+				Path:      name + "#" + row.Title,
+				Title:     NormalizeImportTitle(row.Title, ""),
+				Content:   row.Content,
+				CreatedAt: row.CreatedAt,
+			}
+			for _, tag := range row.Tags {
+				note.addTag(tag)
+			}
+			note.addTag(dir)
+			notes = append(notes, note)
+		}
+	}
+
+	if len(notes) == 0 {
+		return nil, issues, ErrNothingToImport
+	}
+	issues = append(issues, archive.unreferencedIssues(names, func(name string) bool {
+		return strings.ToLower(path.Ext(name)) == ".csv"
+	})...)
+	return notes, issues, nil
+}
+
+// parseNotionPage 解析一个Notion页面
+func (a *markdownArchive) parseNotionPage(name, content string) (ImportedNote, []ImportIssue) {
+	content = strings.ReplaceAll(strings.TrimPrefix(content, "\ufeff"), "\r\n", "\n")
+	note := ImportedNote{Path: name}
+
+	lines := strings.Split(content, "\n")
+	title := ""
+	if len(lines) > 0 && strings.HasPrefix(lines[0], "# ") {
+		title = strings.TrimSpace(lines[0][2:])
+		lines = lines[1:]
+	}
+	note.Title = NormalizeImportTitle(title, notionName(strings.TrimSuffix(path.Base(name), path.Ext(name))))
+
+	// 标题下方连续的属性行，只移除作为标签和创建时间的属性
+	start := 0
+	for start < len(lines) && strings.TrimSpace(lines[start]) == "" {
+		start++
+	}
+	end := start
+	for end < len(lines) && notionPropertyPattern.MatchString(lines[end]) {
+		end++
+	}
+	if end > start && (end == len(lines) || strings.TrimSpace(lines[end]) == "") {
+		var kept []string
+		for _, line := range lines[start:end] {
+			m := notionPropertyPattern.FindStringSubmatch(line)
+			key := strings.ToLower(strings.TrimSpace(m[1]))
+			switch {
+			case notionTagProperties[key]:
+				for _, tag := range strings.Split(m[2], ",") {
+					note.addTag(tag)
+				}
+			case notionCreatedProperties[key]:
+				if created, ok := parseNotionTime(m[2]); ok {
+					note.CreatedAt = created
+				} else {
+					kept = append(kept, line)
+				}
+			default:
+				kept = append(kept, line)
+			}
+		}
+		lines = append(append(lines[:start:start], kept...), lines[end:]...)
+	}
+
+	if dir := notionPath(path.Dir(name)); dir != "." {
+		note.addTag(dir)
+	}
+
+	body := strings.Trim(strings.Join(lines, "\n"), "\n") + "\n"
+	var issues []ImportIssue
+	note.Content, issues = a.rewriteLinks(&note, body, issues)
+	return note, issues
+}
+
+// notionDatabaseRow 数据库中的一行
+type notionDatabaseRow struct {
+	Title     string
+	Tags      []string
+	CreatedAt time.Time
+	Content   string // 其余属性的列表
+}
+
+// parseNotionDatabase 解析Notion数据库导出的CSV，第一列为页面标题
+func parseNotionDatabase(name, data string) ([]notionDatabaseRow, error) {
+	reader := csv.NewReader(strings.NewReader(strings.TrimPrefix(data, "\ufeff")))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) < 2 {
+		return nil, nil
+	}
+
+	header := records[0]
+	var rows []notionDatabaseRow
+	for _, record := range records[1:] {
+		if len(record) == 0 || strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+		row := notionDatabaseRow{Title: strings.TrimSpace(record[0])}
+		var properties []string
+		for i := 1; i < len(record) && i < len(header); i++ {
+			key, value := strings.TrimSpace(header[i]), strings.TrimSpace(record[i])
+			if value == "" {
+				continue
+			}
+			switch lower := strings.ToLower(key); {
+			case notionTagProperties[lower]:
+				row.Tags = append(row.Tags, strings.Split(value, ",")...)
+			case notionCreatedProperties[lower] && row.CreatedAt.IsZero():
+				if created, ok := parseNotionTime(value); ok {
+					row.CreatedAt = created
+					continue
+				}
+				fallthrough
+			default:
+				properties = append(properties, "- **"+markdownEscapePattern.ReplaceAllString(key, `\$1`)+"**: "+value)
+			}
+		}
+		row.Content = strings.Join(properties, "\n") + "\n"
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// notionDatabases 返回要解析的数据库CSV；新版导出同时包含 X.csv 和包含所有行的 X_all.csv，此时只解析后者
+func notionDatabases(names []string) []string {
+	exists := make(map[string]bool, len(names))
+	for _, name := range names {
+		exists[name] = true
+	}
+	var databases []string
+	for _, name := range names {
+		if strings.ToLower(path.Ext(name)) != ".csv" {
+			continue
+		}
+		if exists[strings.TrimSuffix(name, path.Ext(name))+"_all"+path.Ext(name)] {
+			continue
+		}
+		databases = append(databases, name)
+	}
+	return databases
+}
+
+// parseNotionTime 解析Notion的日期属性，日期范围只取开始日期
+func parseNotionTime(value string) (time.Time, bool) {
+	value, _, _ = strings.Cut(value, "→")
+	value = strings.TrimSpace(value)
+	for _, layout := range notionTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// notionName 去掉Notion文件名或目录名末尾的页面ID
+func notionName(name string) string {
+	return notionIDPattern.ReplaceAllString(name, "")
+}
+
+// notionPath 去掉路径中每一级的页面ID
+func notionPath(p string) string {
+	parts := strings.Split(p, "/")
+	for i, part := range parts {
+		parts[i] = notionName(part)
+	}
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,408 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// PDF页面尺寸（A4，单位为点）
+const (
+	pdfPageWidth  = 595.28
+	pdfPageHeight = 841.89
+)
+
+// pdfFont PDF中使用的字体
+// 西文使用标准14字体，阅读器都内置这些字体；中文等其他字符使用Adobe-GB1字符集的 STSong-Light，
+// 该字体不嵌入PDF，由阅读器使用系统中的中文字体显示，因此生成PDF不需要字体文件
+type pdfFont int
+
+const (
+	pdfHelvetica pdfFont = iota
+	pdfHelveticaBold
+	pdfHelveticaOblique
+	pdfHelveticaBoldOblique
+	pdfCourier
+	pdfCJK
+)
+
+// pdfBaseFonts 字体名称，下标与 pdfFont 对应
+var pdfBaseFonts = [...]string{"Helvetica", "Helvetica-Bold", "Helvetica-Oblique", "Helvetica-BoldOblique", "Courier", "STSong-Light"}
+
+// helveticaWidths、helveticaBoldWidths ASCII 32-126 的字符宽度（1/1000 em），来自标准字体的AFM
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+var helveticaBoldWidths = [95]int{
+	278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+	975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+	333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+	611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+}
+
+// winAnsiSpecials WinAnsiEncoding中 0x80-0x9F 对应的字符
+var winAnsiSpecials = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87, 'ˆ': 0x88,
+	'‰': 0x89, 'Š': 0x8A, '‹': 0x8B, 'Œ': 0x8C, 'Ž': 0x8E, '‘': 0x91, '’': 0x92, '“': 0x93,
+	'”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '˜': 0x98, '™': 0x99, 'š': 0x9A, '›': 0x9B,
+	'œ': 0x9C, 'ž': 0x9E, 'Ÿ': 0x9F,
+}
+
+// winAnsiWidths 常用的非ASCII字符的宽度，其余按数字宽度计算
+var winAnsiWidths = map[rune]int{'…': 1000, '—': 1000, '•': 350, '‘': 222, '’': 222, '“': 333, '”': 333, '‚': 222, '„': 333}
+
+// winAnsiByte 返回字符在WinAnsiEncoding中的编码，无法编码时返回false
+func winAnsiByte(r rune) (byte, bool) {
+	switch {
+	case r >= 0x20 && r < 0x7F, r >= 0xA0 && r <= 0xFF:
+		return byte(r), true
+	}
+	b, ok := winAnsiSpecials[r]
+	return b, ok
+}
+
+// pdfCharWidth 字符在字体中的宽度（1/1000 em）
+func pdfCharWidth(font pdfFont, r rune) int {
+	switch font {
+	case pdfCourier:
+		return 600
+	case pdfCJK:
+		return 1000
+	}
+	if r >= 0x20 && r < 0x7F {
+		if font == pdfHelveticaBold || font == pdfHelveticaBoldOblique {
+			return helveticaBoldWidths[r-0x20]
+		}
+		return helveticaWidths[r-0x20]
+	}
+	if w, ok := winAnsiWidths[r]; ok {
+		return w
+	}
+	return 556
+}
+
+// pdfTextWidth 文本在字体和字号下的宽度（点）
+func pdfTextWidth(font pdfFont, size float64, text string) float64 {
+	total := 0
+	for _, r := range text {
+		total += pdfCharWidth(font, r)
+	}
+	return float64(total) * size / 1000
+}
+
+// pdfColor RGB颜色，各分量为0-1
+type pdfColor struct{ r, g, b float64 }
+
+// pdfImage 嵌入的JPEG图片
+type pdfImage struct {
+	width, height int
+	data          []byte
+}
+
+// pdfLink 页面中的链接区域
+type pdfLink struct {
+	x, y, w, h float64
+	uri        string
+}
+
+// pdfPage 页面内容
+type pdfPage struct {
+	content bytes.Buffer
+	links   []pdfLink
+}
+
+// pdfDocument 最小的PDF文档生成器
+type pdfDocument struct {
+	title  string
+	pages  []*pdfPage
+	images []*pdfImage
+}
+
+// addPage 添加新页面
+func (d *pdfDocument) addPage() *pdfPage {
+	page := &pdfPage{}
+	d.pages = append(d.pages, page)
+	return page
+}
+
+// addImage 添加图片，返回图片的下标
+func (d *pdfDocument) addImage(img *pdfImage) int {
+	d.images = append(d.images, img)
+	return len(d.images) - 1
+}
+
+// text 在(x, y)处绘制文本，y为基线位置；fakeBold为true时描边加粗（用于没有粗体的中文字体）
+func (p *pdfPage) text(x, y float64, font pdfFont, size float64, color pdfColor, text string, fakeBold bool) {
+	// 描边模式和线宽属于图形状态，加粗时保存并恢复图形状态，避免影响之后的内容
+	if fakeBold {
+		fmt.Fprintf(&p.content, "q %.3f %.3f %.3f RG %.2f w BT 2 Tr ", color.r, color.g, color.b, size*0.03)
+	} else {
+		p.content.WriteString("BT ")
+	}
+	fmt.Fprintf(&p.content, "%.3f %.3f %.3f rg /F%d %.2f Tf %.2f %.2f Td %s Tj ET", color.r, color.g, color.b, font, size, x, y, pdfEncodeText(font, text))
+	if fakeBold {
+		p.content.WriteString(" Q")
+	}
+	p.content.WriteByte('\n')
+}
+
+// rect 绘制填充的矩形，(x, y)为左下角
+func (p *pdfPage) rect(x, y, w, h float64, color pdfColor) {
+	fmt.Fprintf(&p.content, "%.3f %.3f %.3f rg %.2f %.2f %.2f %.2f re f\n", color.r, color.g, color.b, x, y, w, h)
+}
+
+// strokeRect 绘制矩形边框
+func (p *pdfPage) strokeRect(x, y, w, h, width float64, color pdfColor) {
+	fmt.Fprintf(&p.content, "%.3f %.3f %.3f RG %.2f w %.2f %.2f %.2f %.2f re S\n", color.r, color.g, color.b, width, x, y, w, h)
+}
+
+// line 绘制线段
+func (p *pdfPage) line(x1, y1, x2, y2, width float64, color pdfColor) {
+	fmt.Fprintf(&p.content, "%.3f %.3f %.3f RG %.2f w %.2f %.2f m %.2f %.2f l S\n", color.r, color.g, color.b, width, x1, y1, x2, y2)
+}
+
+// check 绘制勾选标记
+func (p *pdfPage) check(x, y, size float64, color pdfColor) {
+	fmt.Fprintf(&p.content, "%.3f %.3f %.3f RG %.2f w %.2f %.2f m %.2f %.2f l %.2f %.2f l S\n",
+		color.r, color.g, color.b, size*0.12,
+		x+size*0.2, y+size*0.5, x+size*0.42, y+size*0.25, x+size*0.82, y+size*0.78)
+}
+
+// image 在(x, y)处绘制图片，(x, y)为左下角
+func (p *pdfPage) image(index int, x, y, w, h float64) {
+	fmt.Fprintf(&p.content, "q %.2f 0 0 %.2f %.2f %.2f cm /Im%d Do Q\n", w, h, x, y, index)
+}
+
+// link 添加链接区域
+func (p *pdfPage) link(x, y, w, h float64, uri string) {
+	p.links = append(p.links, pdfLink{x: x, y: y, w: w, h: h, uri: uri})
+}
+
+// pdfEncodeText 将文本编码为PDF字符串：标准字体使用WinAnsiEncoding，中文字体使用UCS-2编码的十六进制字符串
+func pdfEncodeText(font pdfFont, text string) string {
+	if font == pdfCJK {
+		var b strings.Builder
+		b.WriteByte('<')
+		for _, r := range text {
+			if r > 0xFFFF {
+				r = '?'
+			}
+			fmt.Fprintf(&b, "%04X", r)
+		}
+		b.WriteByte('>')
+		return b.String()
+	}
+
+	var b strings.Builder
+	b.WriteByte('(')
+	for _, r := range text {
+		c, ok := winAnsiByte(r)
+		if !ok {
+			c = '?'
+		}
+		if c == '(' || c == ')' || c == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(c)
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// pdfLiteral 将ASCII字符串编码为PDF字符串
+func pdfLiteral(s string) string {
+	return "(" + strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`, "\r", "", "\n", " ").Replace(s) + ")"
+}
+
+// pdfUnicodeString 将文本编码为UTF-16BE的十六进制字符串，用于文档信息
+func pdfUnicodeString(s string) string {
+	var b strings.Builder
+	b.WriteString("<FEFF")
+	for _, u := range utf16.Encode([]rune(s)) {
+		fmt.Fprintf(&b, "%04X", u)
+	}
+	b.WriteByte('>')
+	return b.String()
+}
+
+// pdfUCS2ToUnicode 中文字体的ToUnicode CMap
+// 文本按UCS-2编码，编码即Unicode码点，用于在阅读器中复制和搜索文本
+func pdfUCS2ToUnicode() string {
+	var b strings.Builder
+	b.WriteString("/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n" +
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n" +
+		"/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n" +
+		"1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n")
+	// 每个 bfrange 只能改变最后一个字节，且每段最多100项
+	for start := 0; start < 256; start += 100 {
+		end := start + 100
+		if end > 256 {
+			end = 256
+		}
+		fmt.Fprintf(&b, "%d beginbfrange\n", end-start)
+		for high := start; high < end; high++ {
+			fmt.Fprintf(&b, "<%02X00> <%02XFF> <%02X00>\n", high, high, high)
+		}
+		b.WriteString("endbfrange\n")
+	}
+	b.WriteString("endcmap\nCMapName currentdict /CMap defineresource pop\nend\nend\n")
+	return b.String()
+}
+
+// pdfWriter 写入PDF对象并记录偏移量
+type pdfWriter struct {
+	w       *bufio.Writer
+	offset  int64
+	offsets []int64 // 对象编号-1 -> 偏移量
+}
+
+// printf 写入格式化的内容
+func (pw *pdfWriter) printf(format string, args ...interface{}) {
+	n, _ := fmt.Fprintf(pw.w, format, args...)
+	pw.offset += int64(n)
+}
+
+// write 写入原始字节
+func (pw *pdfWriter) write(data []byte) {
+	n, _ := pw.w.Write(data)
+	pw.offset += int64(n)
+}
+
+// object 写入编号为id的对象
+func (pw *pdfWriter) object(id int, body string) {
+	pw.begin(id)
+	pw.printf("%s\nendobj\n", body)
+}
+
+// begin 开始写入编号为id的对象
+func (pw *pdfWriter) begin(id int) {
+	for len(pw.offsets) < id {
+		pw.offsets = append(pw.offsets, 0)
+	}
+	pw.offsets[id-1] = pw.offset
+	pw.printf("%d 0 obj\n", id)
+}
+
+// stream 写入压缩的流对象
+func (pw *pdfWriter) stream(id int, dict string, data []byte, compress bool) error {
+	if compress {
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		data = buf.Bytes()
+		dict += " /Filter /FlateDecode"
+	}
+	pw.begin(id)
+	pw.printf("<< %s /Length %d >>\nstream\n", dict, len(data))
+	pw.write(data)
+	pw.printf("\nendstream\nendobj\n")
+	return nil
+}
+
+// write 输出PDF文件
+func (d *pdfDocument) write(w io.Writer) error {
+	if len(d.pages) == 0 {
+		d.addPage()
+	}
+	pw := &pdfWriter{w: bufio.NewWriter(w)}
+	pw.printf("%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+
+	// 对象编号：1 目录，2 页面树，3 文档信息，4-8 标准字体，9-12 中文字体，之后为图片和页面
+	const (
+		catalogID = 1
+		pagesID   = 2
+		infoID    = 3
+		fontID    = 4
+		cjkID     = 9
+		imageID   = 13
+	)
+	pageID := imageID + len(d.images)
+
+	pw.object(catalogID, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pagesID))
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", pageID+i*2)
+	}
+	pw.object(pagesID, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	pw.object(infoID, fmt.Sprintf("<< /Title %s /Producer (cyi-note) /CreationDate (D:%s) >>",
+		pdfUnicodeString(d.title), time.Now().UTC().Format("20060102150405Z")))
+
+	for font := pdfHelvetica; font <= pdfCourier; font++ {
+		pw.object(fontID+int(font), fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", pdfBaseFonts[font]))
+	}
+	pw.object(cjkID, fmt.Sprintf("<< /Type /Font /Subtype /Type0 /BaseFont /STSong-Light /Encoding /UniGB-UCS2-H /DescendantFonts [%d 0 R] /ToUnicode %d 0 R >>", cjkID+1, cjkID+3))
+	pw.object(cjkID+1, fmt.Sprintf("<< /Type /Font /Subtype /CIDFontType0 /BaseFont /STSong-Light "+
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (GB1) /Supplement 2 >> /FontDescriptor %d 0 R /DW 1000 >>", cjkID+2))
+	pw.object(cjkID+2, "<< /Type /FontDescriptor /FontName /STSong-Light /Flags 6 /FontBBox [-25 -254 1000 880] "+
+		"/ItalicAngle 0 /Ascent 880 /Descent -120 /CapHeight 880 /StemV 93 >>")
+	if err := pw.stream(cjkID+3, "", []byte(pdfUCS2ToUnicode()), true); err != nil {
+		return err
+	}
+
+	for i, img := range d.images {
+		dict := fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /DCTDecode",
+			img.width, img.height)
+		if err := pw.stream(imageID+i, dict, img.data, false); err != nil {
+			return err
+		}
+	}
+
+	var resources strings.Builder
+	resources.WriteString("<< /Font <<")
+	for font := pdfHelvetica; font <= pdfCourier; font++ {
+		fmt.Fprintf(&resources, " /F%d %d 0 R", font, fontID+int(font))
+	}
+	fmt.Fprintf(&resources, " /F%d %d 0 R >>", pdfCJK, cjkID)
+	if len(d.images) > 0 {
+		resources.WriteString(" /XObject <<")
+		for i := range d.images {
+			fmt.Fprintf(&resources, " /Im%d %d 0 R", i, imageID+i)
+		}
+		resources.WriteString(" >>")
+	}
+	resources.WriteString(" >>")
+
+	for i, page := range d.pages {
+		id := pageID + i*2
+		var annots string
+		if len(page.links) > 0 {
+			items := make([]string, len(page.links))
+			for j, link := range page.links {
+				items[j] = fmt.Sprintf("<< /Type /Annot /Subtype /Link /Rect [%.2f %.2f %.2f %.2f] /Border [0 0 0] /A << /S /URI /URI %s >> >>",
+					link.x, link.y, link.x+link.w, link.y+link.h, pdfLiteral(link.uri))
+			}
+			annots = " /Annots [" + strings.Join(items, " ") + "]"
+		}
+		pw.object(id, fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.2f %.2f] /Resources %s /Contents %d 0 R%s >>",
+			pagesID, pdfPageWidth, pdfPageHeight, resources.String(), id+1, annots))
+		if err := pw.stream(id+1, "", page.content.Bytes(), true); err != nil {
+			return err
+		}
+	}
+
+	xref := pw.offset
+	pw.printf("xref\n0 %d\n0000000000 65535 f \n", len(pw.offsets)+1)
+	for _, offset := range pw.offsets {
+		pw.printf("%010d 00000 n \n", offset)
+	}
+	pw.printf("trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(pw.offsets)+1, catalogID, infoID, xref)
+	return pw.w.Flush()
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// attachmentReferencePattern 笔记内容中的附件链接，例如 ![](/api/attachments/12?size=thumb)
+// 不匹配 /api/attachments/12/url 等其他接口
+var attachmentReferencePattern = regexp.MustCompile(`/api/attachments/(\d+)(?:[^\d/]|$)`)
+
+// ParseAttachmentReferences 解析内容中引用的附件ID，按首次出现的顺序返回且不重复
+func ParseAttachmentReferences(content string) []uint {
+	var ids []uint
+	seen := make(map[uint]bool)
+	for _, match := range attachmentReferencePattern.FindAllStringSubmatch(content, -1) {
+		id, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil || id == 0 || seen[uint(id)] {
+			continue
+		}
+		seen[uint(id)] = true
+		ids = append(ids, uint(id))
+	}
+	return ids
+}
+
+// attachmentLinkPattern 笔记内容中完整的附件地址，包括可选的域名和查询参数
+var attachmentLinkPattern = regexp.MustCompile(`(?:https?://[^\s/()<>"']+)?/api/attachments/(\d+)(/[^\s()<>"']*)?(?:\?[^\s()<>"'\]]*)?`)
+
+// ReplaceAttachmentLinks 将内容中的附件地址替换为replace返回的地址，replace返回false时保留原地址
+// /api/attachments/12/url 等其他接口的地址不会被替换
+func ReplaceAttachmentLinks(content string, replace func(id uint) (string, bool)) string {
+	return attachmentLinkPattern.ReplaceAllStringFunc(content, func(link string) string {
+		match := attachmentLinkPattern.FindStringSubmatch(link)
+		if match[2] != "" {
+			return link
+		}
+		id, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil || id == 0 {
+			return link
+		}
+		if replacement, ok := replace(uint(id)); ok {
+			return replacement
+		}
+		return link
+	})
+}
@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestParseAttachmentReferences(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []uint
+	}{
+		{
+			name:    "图片和链接",
+			content: "![图](/api/attachments/12)\n[文件](/api/attachments/3)",
+			want:    []uint{12, 3},
+		},
+		{
+			name:    "带域名和查询参数",
+			content: `<img src="https://note.example.com/api/attachments/5?size=thumb">`,
+			want:    []uint{5},
+		},
+		{
+			name:    "去重并保持首次出现的顺序",
+			content: "/api/attachments/2 /api/attachments/1 /api/attachments/2?size=thumb",
+			want:    []uint{2, 1},
+		},
+		{
+			name:    "内容末尾的地址",
+			content: "见 /api/attachments/7",
+			want:    []uint{7},
+		},
+		{
+			name:    "忽略其他接口和无效ID",
+			content: "/api/attachments/4/url /api/attachments/0 /api/attachments/ /api/attachments/blob/abc",
+			want:    nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseAttachmentReferences(tt.content); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseAttachmentReferences = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplaceAttachmentLinks(t *testing.T) {
+	// 只替换ID为1和2的附件
+	replace := func(id uint) (string, bool) {
+		if id > 2 {
+			return "", false
+		}
+		return fmt.Sprintf("attachments/%d.png", id), true
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "Markdown图片",
+			content: "![图](/api/attachments/1)",
+			want:    "![图](attachments/1.png)",
+		},
+		{
+			name:    "连同域名和查询参数一起替换",
+			content: `<img src="https://note.example.com/api/attachments/2?size=thumb&expires=1">`,
+			want:    `<img src="attachments/2.png">`,
+		},
+		{
+			name:    "带标题的链接",
+			content: `[文件](/api/attachments/1 "标题")`,
+			want:    `[文件](attachments/1.png "标题")`,
+		},
+		{
+			name:    "引用链接中的方括号",
+			content: "[![图](/api/attachments/1?size=thumb)](/api/attachments/2)",
+			want:    "[![图](attachments/1.png)](attachments/2.png)",
+		},
+		{
+			name:    "replace返回false时保留原地址",
+			content: "![图](/api/attachments/3?size=thumb)",
+			want:    "![图](/api/attachments/3?size=thumb)",
+		},
+		{
+			name:    "不替换其他接口",
+			content: "/api/attachments/1/url /api/attachments/0",
+			want:    "/api/attachments/1/url /api/attachments/0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ReplaceAttachmentLinks(tt.content, replace); got != tt.want {
+				t.Errorf("ReplaceAttachmentLinks(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+		})
+	}
+}
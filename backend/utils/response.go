@@ -41,6 +41,11 @@ func CreatedResponse(c *gin.Context, data interface{}, message string) {
 	SuccessResponse(c, http.StatusCreated, data, message)
 }
 
+// AcceptedResponse 返回202已受理响应（异步处理）
+func AcceptedResponse(c *gin.Context, data interface{}, message string) {
+	SuccessResponse(c, http.StatusAccepted, data, message)
+}
+
 // BadRequestResponse 返回400错误响应
 func BadRequestResponse(c *gin.Context, err string) {
 	ErrorResponse(c, http.StatusBadRequest, err)
@@ -61,6 +66,11 @@ func NotFoundResponse(c *gin.Context, err string) {
 	ErrorResponse(c, http.StatusNotFound, err)
 }
 
+// TooManyRequestsResponse 返回429请求过多响应
+func TooManyRequestsResponse(c *gin.Context, err string) {
+	ErrorResponse(c, http.StatusTooManyRequests, err)
+}
+
 // ServerErrorResponse 返回500服务器错误响应
 func ServerErrorResponse(c *gin.Context, err string) {
 	ErrorResponse(c, http.StatusInternalServerError, err)
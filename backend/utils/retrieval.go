@@ -0,0 +1,225 @@
+package utils
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TextChunk 笔记内容切分后的片段
+type TextChunk struct {
+	NoteID uint   `json:"note_id"`
+	Title  string `json:"title"`
+	Text   string `json:"text"`
+	Start  int    `json:"start"` // 片段在笔记内容中的起始位置（按字符计）
+	End    int    `json:"end"`   // 片段在笔记内容中的结束位置（按字符计，不含）
+}
+
+// ScoredChunk 带相关度得分的片段
+type ScoredChunk struct {
+	TextChunk
+	Score float64 `json:"score"`
+}
+
+// BM25参数
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Tokenize 将文本分词并标准化，过滤标点和单字符词
+func Tokenize(text string) []string {
+	var tokens []string
+	for _, word := range segmenter.Cut(strings.ToLower(text), true) {
+		word = strings.TrimSpace(word)
+		if utf8.RuneCountInString(word) < 2 {
+			continue
+		}
+
+		// 过滤不含字母和数字的词（标点、符号等）
+		hasLetter := false
+		for _, r := range word {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				hasLetter = true
+				break
+			}
+		}
+		if hasLetter {
+			tokens = append(tokens, word)
+		}
+	}
+	return tokens
+}
+
+// SplitChunks 按段落切分笔记内容，相邻的短段落合并，过长的段落按maxRunes截断
+func SplitChunks(noteID uint, title, content string, maxRunes int) []TextChunk {
+	if maxRunes <= 0 {
+		maxRunes = 500
+	}
+
+	runes := []rune(content)
+	var chunks []TextChunk
+	start, end := -1, 0
+
+	flush := func() {
+		if start >= 0 {
+			// 去掉首尾空白，保证位置指向实际文本
+			s, e := start, end
+			for s < e && unicode.IsSpace(runes[s]) {
+				s++
+			}
+			for e > s && unicode.IsSpace(runes[e-1]) {
+				e--
+			}
+			if s < e {
+				chunks = append(chunks, TextChunk{NoteID: noteID, Title: title, Text: string(runes[s:e]), Start: s, End: e})
+			}
+		}
+		start = -1
+	}
+
+	// 逐段扫描，段落以空行分隔
+	pos := 0
+	for pos < len(runes) {
+		paraEnd := pos
+		for paraEnd < len(runes) && !(runes[paraEnd] == '\n' && paraEnd+1 < len(runes) && runes[paraEnd+1] == '\n') {
+			paraEnd++
+		}
+
+		if start >= 0 && paraEnd-start > maxRunes {
+			flush()
+		}
+
+		// 段落本身过长时硬切分
+		for paraEnd-pos > maxRunes {
+			if start < 0 {
+				start = pos
+			}
+			end = start + maxRunes
+			pos = end
+			flush()
+		}
+
+		if start < 0 {
+			start = pos
+		}
+		end = paraEnd
+
+		// 跳过段落间的空行
+		pos = paraEnd
+		for pos < len(runes) && runes[pos] == '\n' {
+			pos++
+		}
+	}
+	flush()
+
+	return chunks
+}
+
+// RankChunks 使用BM25算法计算片段与问题的相关度，返回得分最高的topK个片段
+func RankChunks(query string, chunks []TextChunk, topK int) []ScoredChunk {
+	queryTokens := Tokenize(query)
+	if len(queryTokens) == 0 || len(chunks) == 0 {
+		return nil
+	}
+
+	// 统计每个片段的词频与文档频率，标题词计入每个片段
+	termFreqs := make([]map[string]int, len(chunks))
+	docFreq := make(map[string]int)
+	totalLen := 0
+	for i, chunk := range chunks {
+		tf := make(map[string]int)
+		tokens := append(Tokenize(chunk.Title), Tokenize(chunk.Text)...)
+		for _, token := range tokens {
+			tf[token]++
+		}
+		for token := range tf {
+			docFreq[token]++
+		}
+		termFreqs[i] = tf
+		totalLen += len(tokens)
+	}
+	avgLen := float64(totalLen) / float64(len(chunks))
+	if avgLen == 0 {
+		avgLen = 1
+	}
+
+	n := float64(len(chunks))
+	var scored []ScoredChunk
+	for i, chunk := range chunks {
+		docLen := 0
+		for _, count := range termFreqs[i] {
+			docLen += count
+		}
+
+		score := 0.0
+		for _, token := range queryTokens {
+			tf := float64(termFreqs[i][token])
+			if tf == 0 {
+				continue
+			}
+			df := float64(docFreq[token])
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			score += idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*float64(docLen)/avgLen))
+		}
+
+		if score > 0 {
+			scored = append(scored, ScoredChunk{TextChunk: chunk, Score: score})
+		}
+	}
+
+	sort.SliceStable(scored, func(i, j int) bool {
+		return scored[i].Score > scored[j].Score
+	})
+	if topK > 0 && len(scored) > topK {
+		scored = scored[:topK]
+	}
+
+	return scored
+}
+
+// QuoteSpan 从片段中选出与问题最相关的一句作为引用，返回引用文本及其在笔记内容中的位置
+func QuoteSpan(chunk TextChunk, query string) (string, int, int) {
+	queryTokens := make(map[string]bool)
+	for _, token := range Tokenize(query) {
+		queryTokens[token] = true
+	}
+
+	runes := []rune(chunk.Text)
+	bestStart, bestEnd, bestHits := 0, len(runes), 0
+
+	// 按句末标点和换行切分句子
+	sentStart := 0
+	for i := 0; i <= len(runes); i++ {
+		if i < len(runes) && !strings.ContainsRune("。！？!?\n", runes[i]) && !(runes[i] == '.' && (i+1 == len(runes) || unicode.IsSpace(runes[i+1]))) {
+			continue
+		}
+
+		sentEnd := i
+		if i < len(runes) {
+			sentEnd = i + 1
+		}
+		hits := 0
+		for _, token := range Tokenize(string(runes[sentStart:sentEnd])) {
+			if queryTokens[token] {
+				hits++
+			}
+		}
+		if hits > bestHits {
+			bestStart, bestEnd, bestHits = sentStart, sentEnd, hits
+		}
+		sentStart = sentEnd
+	}
+
+	// 去掉首尾空白
+	for bestStart < bestEnd && unicode.IsSpace(runes[bestStart]) {
+		bestStart++
+	}
+	for bestEnd > bestStart && unicode.IsSpace(runes[bestEnd-1]) {
+		bestEnd--
+	}
+
+	return string(runes[bestStart:bestEnd]), chunk.Start + bestStart, chunk.Start + bestEnd
+}
@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitChunks(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		maxRunes int
+		want     []string
+	}{
+		{
+			name:     "短段落合并",
+			content:  "第一段。\n\n第二段。\n\n\n第三段。",
+			maxRunes: 500,
+			want:     []string{"第一段。\n\n第二段。\n\n\n第三段。"},
+		},
+		{
+			name:     "超出长度时在段落处切分",
+			content:  "第一段内容。\n\n第二段内容。\n\n第三段内容。",
+			maxRunes: 14,
+			want:     []string{"第一段内容。\n\n第二段内容。", "第三段内容。"},
+		},
+		{
+			name:     "过长的段落硬切分",
+			content:  "0123456789abcdefghij\n\n短段落",
+			maxRunes: 8,
+			want:     []string{"01234567", "89abcdef", "ghij", "短段落"},
+		},
+		{
+			name:     "去掉首尾空白",
+			content:  "\n\n  缩进的段落  \n\n",
+			maxRunes: 500,
+			want:     []string{"缩进的段落"},
+		},
+		{
+			name:     "空内容",
+			content:  " \n\n ",
+			maxRunes: 500,
+			want:     nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := SplitChunks(3, "标题", tt.content, tt.maxRunes)
+			var texts []string
+			runes := []rune(tt.content)
+			for _, chunk := range chunks {
+				texts = append(texts, chunk.Text)
+				if chunk.NoteID != 3 || chunk.Title != "标题" {
+					t.Errorf("chunk = %+v", chunk)
+				}
+				// 位置按字符计，必须指向笔记内容中的同一段文本
+				if got := string(runes[chunk.Start:chunk.End]); got != chunk.Text {
+					t.Errorf("content[%d:%d] = %q, want %q", chunk.Start, chunk.End, got, chunk.Text)
+				}
+			}
+			if !reflect.DeepEqual(texts, tt.want) {
+				t.Errorf("SplitChunks = %q, want %q", texts, tt.want)
+			}
+		})
+	}
+}
+
+func TestRankChunks(t *testing.T) {
+	content := "Go 语言笔记\n\nGoroutine 是轻量级线程，Channel 用于通信。\n\n" +
+		"数据库索引可以加快查询。B树是常见的索引结构。\n\n" +
+		"周末去公园散步。"
+	chunks := SplitChunks(1, "学习笔记", content, 30)
+	if len(chunks) != 4 {
+		t.Fatalf("SplitChunks returned %d chunks: %+v", len(chunks), chunks)
+	}
+
+	ranked := RankChunks("数据库索引是如何加快查询的？", chunks, 5)
+	if len(ranked) != 1 {
+		t.Fatalf("RankChunks = %+v, want only the matching chunk", ranked)
+	}
+	if ranked[0].Text != "数据库索引可以加快查询。B树是常见的索引结构。" || ranked[0].Score <= 0 {
+		t.Errorf("RankChunks[0] = %+v", ranked[0])
+	}
+
+	// 标题中的词计入每个片段
+	if got := RankChunks("学习笔记", chunks, 2); len(got) != 2 {
+		t.Errorf("RankChunks by title returned %d chunks, want 2 (topK)", len(got))
+	}
+
+	if got := RankChunks("？！", chunks, 5); got != nil {
+		t.Errorf("RankChunks without query tokens = %+v, want nil", got)
+	}
+	if got := RankChunks("数据库", nil, 5); got != nil {
+		t.Errorf("RankChunks without chunks = %+v, want nil", got)
+	}
+}
+
+func TestQuoteSpan(t *testing.T) {
+	content := "前言。\n\n数据库索引可以加快查询。B树是常见的索引结构! Hash index is fast. 其他内容"
+	runes := []rune(content)
+	chunk := SplitChunks(1, "", content, 500)[0]
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"B树是什么结构", "B树是常见的索引结构!"},
+		{"如何加快查询", "数据库索引可以加快查询。"},
+		{"hash index", "Hash index is fast."},
+		// 没有命中任何句子时引用整个片段
+		{"天气", content},
+	}
+
+	for _, tt := range tests {
+		quote, start, end := QuoteSpan(chunk, tt.query)
+		if quote != tt.want {
+			t.Errorf("QuoteSpan(%q) = %q, want %q", tt.query, quote, tt.want)
+		}
+		if got := string(runes[start:end]); got != quote {
+			t.Errorf("QuoteSpan(%q) position %d-%d points to %q", tt.query, start, end, got)
+		}
+	}
+
+	// 位置相对于笔记内容，而不是片段
+	chunks := SplitChunks(1, "", "第一段。\n\n第二段提到了缓存。", 10)
+	last := chunks[len(chunks)-1]
+	quote, start, end := QuoteSpan(last, "缓存")
+	if quote != "第二段提到了缓存。" || start != last.Start || end != last.End {
+		t.Errorf("QuoteSpan = %q %d-%d, chunk %+v", quote, start, end, last)
+	}
+}
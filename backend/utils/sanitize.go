@@ -0,0 +1,173 @@
+package utils
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// sanitizeAllowedElements 允许保留的元素及其允许的属性，不在列表中的元素去掉标签、保留内容
+var sanitizeAllowedElements = map[string][]string{
+	"a": {"href", "title", "id", "class", "role"}, "abbr": {"title"}, "b": nil, "blockquote": nil, "br": nil,
+	"caption": nil, "code": {"class"}, "dd": nil, "del": nil, "details": {"open"}, "div": {"class", "role"},
+	"dl": nil, "dt": nil, "em": nil, "figcaption": nil, "figure": nil, "hr": nil, "i": nil,
+	"img": {"src", "alt", "title", "width", "height"}, "input": {"type", "checked", "disabled"}, "ins": nil,
+	"kbd": nil, "li": {"id"}, "mark": nil, "ol": {"start"}, "p": nil, "pre": {"class"}, "q": nil, "s": nil,
+	"samp": nil, "small": nil, "span": {"class"}, "strong": nil, "sub": nil, "summary": nil, "sup": {"id"},
+	"table": nil, "tbody": nil, "td": {"style", "colspan", "rowspan"}, "tfoot": nil, "th": {"style", "colspan", "rowspan"},
+	"thead": nil, "tr": nil, "u": nil, "ul": nil,
+	"h1": {"id"}, "h2": {"id"}, "h3": {"id"}, "h4": {"id"}, "h5": {"id"}, "h6": {"id"},
+}
+
+// sanitizeDroppedElements 连同内容一起删除的元素
+var sanitizeDroppedElements = map[string]bool{
+	"script": true, "style": true, "iframe": true, "object": true, "embed": true, "frame": true, "frameset": true,
+	"noscript": true, "template": true, "textarea": true, "select": true, "button": true, "title": true,
+	"head": true, "meta": true, "link": true, "base": true, "applet": true, "noembed": true, "xmp": true,
+}
+
+// 属性值的格式限制
+var (
+	sanitizeClassPattern = regexp.MustCompile(`^[\w\- ]+$`)
+	sanitizeIDPattern    = regexp.MustCompile(`^[\p{L}\p{N}_:\-]+$`)
+	sanitizeAlignPattern = regexp.MustCompile(`^text-align: ?(left|center|right);?$`)
+	sanitizeImagePattern = regexp.MustCompile(`^data:image/(png|jpeg|gif|webp);base64,[A-Za-z0-9+/=]+$`)
+)
+
+// SanitizeHTML 按允许列表清理HTML片段
+// 删除脚本、样式、事件属性和注释，链接只允许 http、https、mailto 和相对地址，图片另外允许常见格式的data URI
+func SanitizeHTML(fragment string) string {
+	context := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(fragment), context)
+	if err != nil {
+		return html.EscapeString(fragment)
+	}
+
+	root := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+	for _, n := range nodes {
+		root.AppendChild(n)
+	}
+	sanitizeChildren(root)
+
+	var b strings.Builder
+	for n := root.FirstChild; n != nil; n = n.NextSibling {
+		if err := html.Render(&b, n); err != nil {
+			return ""
+		}
+	}
+	return b.String()
+}
+
+// sanitizeChildren 清理节点的子节点
+func sanitizeChildren(n *html.Node) {
+	for child := n.FirstChild; child != nil; {
+		next := child.NextSibling
+		switch child.Type {
+		case html.TextNode:
+		case html.ElementNode:
+			allowed, ok := sanitizeAllowedElements[child.Data]
+			switch {
+			case child.Namespace != "" || sanitizeDroppedElements[child.Data]:
+				// SVG、MathML 等外部命名空间的元素可以包含脚本，整个删除
+				n.RemoveChild(child)
+			case ok:
+				child.Attr = sanitizeAttributes(child, allowed)
+				if child.Data == "input" && attr(child, "type") != "checkbox" {
+					n.RemoveChild(child)
+					break
+				}
+				sanitizeChildren(child)
+			default:
+				// 去掉不允许的标签，内容移到原来的位置，并从移出的第一个节点继续清理
+				if child.FirstChild != nil {
+					next = child.FirstChild
+				}
+				for grandchild := child.FirstChild; grandchild != nil; {
+					following := grandchild.NextSibling
+					child.RemoveChild(grandchild)
+					n.InsertBefore(grandchild, child)
+					grandchild = following
+				}
+				n.RemoveChild(child)
+			}
+		default:
+			n.RemoveChild(child)
+		}
+		child = next
+	}
+}
+
+// sanitizeAttributes 只保留允许的属性，并检查链接地址和属性值的格式
+func sanitizeAttributes(n *html.Node, allowed []string) []html.Attribute {
+	var attrs []html.Attribute
+	external := false
+	for _, a := range n.Attr {
+		if a.Namespace != "" || !sanitizeAllowedAttribute(allowed, a.Key) {
+			continue
+		}
+		value := strings.TrimSpace(a.Val)
+		switch a.Key {
+		case "href":
+			if !sanitizeURL(value, false) {
+				continue
+			}
+			external = strings.HasPrefix(strings.ToLower(value), "http://") || strings.HasPrefix(strings.ToLower(value), "https://")
+		case "src":
+			if !sanitizeURL(value, true) {
+				continue
+			}
+		case "class":
+			if !sanitizeClassPattern.MatchString(value) {
+				continue
+			}
+		case "id":
+			if !sanitizeIDPattern.MatchString(value) {
+				continue
+			}
+		case "style":
+			if !sanitizeAlignPattern.MatchString(strings.ToLower(value)) {
+				continue
+			}
+		case "type":
+			value = strings.ToLower(value)
+		}
+		attrs = append(attrs, html.Attribute{Key: a.Key, Val: value})
+	}
+	// 外部链接不传递来源页面，也不允许目标页面访问 window.opener
+	if external {
+		attrs = append(attrs, html.Attribute{Key: "rel", Val: "nofollow noopener noreferrer"})
+	}
+	return attrs
+}
+
+// sanitizeAllowedAttribute 检查属性是否在允许列表中
+func sanitizeAllowedAttribute(allowed []string, key string) bool {
+	for _, name := range allowed {
+		if name == key {
+			return true
+		}
+	}
+	return false
+}
+
+// sanitizeURL 检查链接地址是否安全：允许相对地址、锚点以及 http、https、mailto，image为true时允许图片的data URI
+func sanitizeURL(value string, image bool) bool {
+	if image && strings.HasPrefix(strings.ToLower(value), "data:") {
+		return sanitizeImagePattern.MatchString(value)
+	}
+	// url.Parse 拒绝包含控制字符的地址，避免 "java\tscript:" 之类的绕过
+	u, err := url.Parse(value)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "", "http", "https":
+		return true
+	case "mailto":
+		return !image
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package utils
+
+import "testing"
+
+func TestSanitizeHTML(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "保留允许的元素",
+			input: `<h2 id="标题-1">标题</h2><p><strong>粗体</strong> <code class="language-go">x</code></p>`,
+			want:  `<h2 id="标题-1">标题</h2><p><strong>粗体</strong> <code class="language-go">x</code></p>`,
+		},
+		{
+			name:  "删除脚本和样式及其内容",
+			input: `<p>a<script>alert(1)</script><style>p{}</style>b</p>`,
+			want:  `<p>ab</p>`,
+		},
+		{
+			name:  "去掉不允许的标签保留内容",
+			input: `<p><font color="red">红<blink>闪</blink></font></p>`,
+			want:  `<p>红闪</p>`,
+		},
+		{
+			name:  "删除事件属性和注释",
+			input: `<p onclick="alert(1)">文本<!-- 注释 --></p>`,
+			want:  `<p>文本</p>`,
+		},
+		{
+			name:  "外部链接添加rel",
+			input: `<a href="https://example.com" target="_blank">链接</a>`,
+			want:  `<a href="https://example.com" rel="nofollow noopener noreferrer">链接</a>`,
+		},
+		{
+			name:  "相对地址和锚点",
+			input: `<a href="/api/attachments/1">附件</a><a href="#fn-1">1</a>`,
+			want:  `<a href="/api/attachments/1">附件</a><a href="#fn-1">1</a>`,
+		},
+		{
+			name:  "删除javascript链接",
+			input: `<a href="javascript:alert(1)">x</a><a href=" JavaScript:alert(1)">y</a>`,
+			want:  `<a>x</a><a>y</a>`,
+		},
+		{
+			name:  "删除包含控制字符的链接",
+			input: "<a href=\"java\tscript:alert(1)\">x</a>",
+			want:  `<a>x</a>`,
+		},
+		{
+			name:  "图片允许常见格式的data URI",
+			input: `<img src="data:image/png;base64,iVBORw0KGgo=" alt="图">`,
+			want:  `<img src="data:image/png;base64,iVBORw0KGgo=" alt="图"/>`,
+		},
+		{
+			name:  "图片不允许SVG的data URI和mailto",
+			input: `<img src="data:image/svg+xml;base64,PHN2Zz4="><img src="mailto:a@example.com">`,
+			want:  `<img/><img/>`,
+		},
+		{
+			name:  "链接不允许data URI",
+			input: `<a href="data:text/html;base64,PHNjcmlwdD4=">x</a>`,
+			want:  `<a>x</a>`,
+		},
+		{
+			name:  "删除SVG",
+			input: `<p>前<svg><script>alert(1)</script></svg>后</p>`,
+			want:  `<p>前后</p>`,
+		},
+		{
+			name:  "只保留复选框",
+			input: `<li><input type="CheckBox" checked disabled> 任务</li><input type="text" value="x">`,
+			want:  `<li><input type="checkbox" checked="" disabled=""/> 任务</li>`,
+		},
+		{
+			name:  "表格只允许对齐样式",
+			input: `<table><tr><td style="text-align: center">a</td><td style="background:url(x)">b</td></tr></table>`,
+			want:  `<table><tbody><tr><td style="text-align: center">a</td><td>b</td></tr></tbody></table>`,
+		},
+		{
+			name:  "删除格式不符的class和id",
+			input: `<span class="a&quot;b">x</span><h1 id="a b">y</h1>`,
+			want:  `<span>x</span><h1>y</h1>`,
+		},
+		{
+			name:  "转义文本",
+			input: `1 < 2 & "引号"`,
+			want:  `1 &lt; 2 &amp; &#34;引号&#34;`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SanitizeHTML(tt.input); got != tt.want {
+				t.Errorf("SanitizeHTML(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
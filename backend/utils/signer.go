@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// 附件URL签名密钥和默认有效期
+var (
+	urlSigningKey []byte
+	urlSigningTTL = time.Hour
+)
+
+// InitURLSigner 初始化附件URL签名
+func InitURLSigner(secret string, ttl time.Duration) {
+	// 从JWT密钥派生独立的签名密钥，避免两种用途共用同一个密钥
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("attachment-url-signing"))
+	urlSigningKey = mac.Sum(nil)
+
+	if ttl > 0 {
+		urlSigningTTL = ttl
+	}
+}
+
+// urlSignature 计算资源类型、ID和过期时间的签名
+func urlSignature(kind string, id uint, expires int64) string {
+	mac := hmac.New(sha256.New, urlSigningKey)
+	mac.Write([]byte(fmt.Sprintf("%s:%d:%d", kind, id, expires)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyURLSignature 校验URL签名，签名无效或已过期时返回false
+func verifyURLSignature(kind string, id uint, expires, signature string) bool {
+	if len(urlSigningKey) == 0 {
+		return false
+	}
+
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return false
+	}
+
+	expected := urlSignature(kind, id, expiresAt)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// SignAttachmentURL 生成带签名的附件访问URL，返回URL及其过期时间
+func SignAttachmentURL(id uint) (string, time.Time) {
+	expiresAt := time.Now().Add(urlSigningTTL)
+	expires := expiresAt.Unix()
+	url := fmt.Sprintf("/api/attachments/%d?expires=%d&signature=%s", id, expires, urlSignature("attachment", id, expires))
+	return url, expiresAt
+}
+
+// VerifyAttachmentSignature 校验附件URL签名，签名无效或已过期时返回false
+func VerifyAttachmentSignature(id uint, expires, signature string) bool {
+	return verifyURLSignature("attachment", id, expires, signature)
+}
+
+// SignExportURL 生成带签名的导出文件下载URL，返回URL及其过期时间
+func SignExportURL(jobID uint) (string, time.Time) {
+	expiresAt := time.Now().Add(urlSigningTTL)
+	expires := expiresAt.Unix()
+	url := fmt.Sprintf("/api/export/jobs/%d/download?expires=%d&signature=%s", jobID, expires, urlSignature("export", jobID, expires))
+	return url, expiresAt
+}
+
+// VerifyExportSignature 校验导出文件下载URL的签名，签名无效或已过期时返回false
+func VerifyExportSignature(jobID uint, expires, signature string) bool {
+	return verifyURLSignature("export", jobID, expires, signature)
+}
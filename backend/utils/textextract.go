@@ -0,0 +1,361 @@
+package utils
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+	"golang.org/x/net/html"
+)
+
+// ErrTextNotExtractable 文件类型不支持提取文本
+var ErrTextNotExtractable = errors.New("不支持从此类型的文件中提取文本")
+
+// OOXML文档类型
+const (
+	docxContentType = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	xlsxContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	pptxContentType = "application/vnd.openxmlformats-officedocument.presentationml.presentation"
+)
+
+// maxOOXMLPartSize OOXML文档中单个部件解压后的最大字节数，超出的部分不再读取，避免压缩炸弹
+const maxOOXMLPartSize = 64 << 20
+
+// errTextLimit 提取的文本已达到长度上限，停止解析
+var errTextLimit = errors.New("提取的文本已达到长度上限")
+
+// plainTextTypes 直接作为文本读取的类型
+var plainTextTypes = map[string]bool{
+	"text/plain":       true,
+	"text/markdown":    true,
+	"text/csv":         true,
+	"application/json": true,
+}
+
+// IsTextExtractable 检查是否可以从该类型的文件中提取文本
+func IsTextExtractable(contentType string) bool {
+	switch contentType = baseContentType(contentType); contentType {
+	case "text/html", "application/pdf", docxContentType, xlsxContentType, pptxContentType:
+		return true
+	default:
+		return plainTextTypes[contentType]
+	}
+}
+
+// ExtractText 从文件中提取纯文本，结果最多保留maxLength个字节（0表示不限制）
+// 达到长度上限后停止解析，返回的truncated表示文本是否被截断
+func ExtractText(r io.ReaderAt, size int64, contentType string, maxLength int) (text string, truncated bool, err error) {
+	contentType = baseContentType(contentType)
+	w := &textWriter{limit: maxLength}
+
+	switch {
+	case plainTextTypes[contentType]:
+		err = readPlainText(io.NewSectionReader(r, 0, size), w)
+	case contentType == "text/html":
+		err = extractHTMLText(io.NewSectionReader(r, 0, size), w)
+	case contentType == "application/pdf":
+		err = extractPDFText(r, size, w)
+	case contentType == docxContentType:
+		err = extractOOXMLText(r, size, w, "word/document.xml")
+	case contentType == xlsxContentType:
+		err = extractOOXMLText(r, size, w, "xl/sharedStrings.xml", "xl/worksheets/")
+	case contentType == pptxContentType:
+		err = extractOOXMLText(r, size, w, "ppt/slides/")
+	default:
+		return "", false, ErrTextNotExtractable
+	}
+	if errors.Is(err, errTextLimit) {
+		return w.String(), true, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return w.String(), false, nil
+}
+
+// textWriter 收集提取的文本，写入时合并多余的空白和空行，超过limit个字节时返回errTextLimit
+type textWriter struct {
+	b        strings.Builder
+	limit    int  // 0表示不限制
+	lineText bool // 当前行已有文本
+	space    bool // 当前行的文本后有待写入的空白
+	newlines int  // 上一段文本后的换行数量
+}
+
+// WriteString 写入文本
+func (w *textWriter) WriteString(s string) error {
+	for _, r := range s {
+		if err := w.writeRune(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write 写入UTF-8编码的文本
+func (w *textWriter) Write(p []byte) error {
+	for len(p) > 0 {
+		r, size := utf8.DecodeRune(p)
+		p = p[size:]
+		if err := w.writeRune(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeRune 写入一个字符：行内连续的空白合并为一个空格，多个空行合并为一个，去掉开头和结尾的空白
+func (w *textWriter) writeRune(r rune) error {
+	switch {
+	case r == '\n':
+		w.newlines++
+		w.lineText = false
+		w.space = false
+		return nil
+	case unicode.IsSpace(r):
+		w.space = w.lineText
+		return nil
+	}
+
+	separator := ""
+	switch {
+	case w.newlines == 1 && w.b.Len() > 0:
+		separator = "\n"
+	case w.newlines > 1 && w.b.Len() > 0:
+		separator = "\n\n"
+	case w.space:
+		separator = " "
+	}
+	if w.limit > 0 && w.b.Len()+len(separator)+utf8.RuneLen(r) > w.limit {
+		return errTextLimit
+	}
+
+	w.b.WriteString(separator)
+	w.b.WriteRune(r)
+	w.newlines = 0
+	w.space = false
+	w.lineText = true
+	return nil
+}
+
+// String 已提取的文本
+func (w *textWriter) String() string {
+	return w.b.String()
+}
+
+// readPlainText 读取文本文件，去掉无效的UTF-8字符
+func readPlainText(r io.Reader, w *textWriter) error {
+	reader := bufio.NewReader(r)
+	for {
+		c, size, err := reader.ReadRune()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if c == utf8.RuneError && size == 1 {
+			continue
+		}
+		if err := w.writeRune(c); err != nil {
+			return err
+		}
+	}
+}
+
+// htmlBlockElements 结束时需要换行的HTML元素
+var htmlBlockElements = map[string]bool{
+	"p": true, "div": true, "br": true, "li": true, "tr": true, "h1": true, "h2": true,
+	"h3": true, "h4": true, "h5": true, "h6": true, "pre": true, "blockquote": true, "table": true,
+}
+
+// extractHTMLText 提取HTML的可见文本，忽略脚本和样式
+func extractHTMLText(r io.Reader, w *textWriter) error {
+	tokenizer := html.NewTokenizer(r)
+	skip := 0
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			if err := tokenizer.Err(); err != io.EOF {
+				return err
+			}
+			return nil
+		case html.StartTagToken:
+			name, _ := tokenizer.TagName()
+			switch string(name) {
+			case "script", "style", "noscript", "template":
+				skip++
+			case "br":
+				w.writeRune('\n')
+			}
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			switch tag := string(name); {
+			case tag == "script" || tag == "style" || tag == "noscript" || tag == "template":
+				if skip > 0 {
+					skip--
+				}
+			case htmlBlockElements[tag]:
+				w.writeRune('\n')
+			}
+		case html.TextToken:
+			if skip == 0 {
+				if err := w.Write(tokenizer.Text()); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// extractPDFText 逐页提取PDF的文本，解析器对损坏的文件可能panic，转换为错误返回
+func extractPDFText(r io.ReaderAt, size int64, w *textWriter) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("解析PDF失败: %v", recovered)
+		}
+	}()
+
+	reader, err := pdf.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("解析PDF失败: %v", err)
+	}
+
+	for i := 1; i <= reader.NumPage(); i++ {
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+		pageText, err := page.GetPlainText(nil)
+		if err != nil {
+			return fmt.Errorf("读取PDF第 %d 页失败: %v", i, err)
+		}
+		if err := w.WriteString(pageText); err != nil {
+			return err
+		}
+		w.writeRune('\n')
+	}
+	return nil
+}
+
+// extractOOXMLText 提取OOXML文档（docx/xlsx/pptx）中的文本
+// parts 为要读取的部件名称，以 / 结尾时表示该目录下的所有XML部件（按文件名中的序号排序）
+func extractOOXMLText(r io.ReaderAt, size int64, w *textWriter, parts ...string) error {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("解析文档失败: %v", err)
+	}
+
+	var files []*zip.File
+	for _, part := range parts {
+		var matched []*zip.File
+		for _, file := range archive.File {
+			if file.Name == part || (strings.HasSuffix(part, "/") && path.Dir(file.Name)+"/" == part && strings.HasSuffix(file.Name, ".xml")) {
+				matched = append(matched, file)
+			}
+		}
+		sort.Slice(matched, func(i, j int) bool {
+			return partNumber(matched[i].Name) < partNumber(matched[j].Name)
+		})
+		files = append(files, matched...)
+	}
+
+	for _, file := range files {
+		err := extractXMLText(file, w)
+		if errors.Is(err, errTextLimit) {
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("解析文档部件 %s 失败: %v", file.Name, err)
+		}
+	}
+	return nil
+}
+
+// partNumber 部件文件名中的序号，例如 slide12.xml -> 12
+func partNumber(name string) int {
+	base := strings.TrimSuffix(path.Base(name), ".xml")
+	i := len(base)
+	for i > 0 && base[i-1] >= '0' && base[i-1] <= '9' {
+		i--
+	}
+	n, _ := strconv.Atoi(base[i:])
+	return n
+}
+
+// extractXMLText 读取XML部件中文本元素（w:t、a:t、t）和单元格值（v）的内容
+// 段落、表格行和工作表行结束时换行；解压后超过 maxOOXMLPartSize 的部分不再读取，已读取的文本按截断处理
+func extractXMLText(file *zip.File, w *textWriter) error {
+	rc, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	// 多读取一个字节，用来判断部件是否超出上限
+	limited := &io.LimitedReader{R: rc, N: maxOOXMLPartSize + 1}
+	decoder := xml.NewDecoder(limited)
+	inText := false
+	sharedString := false // 当前单元格的值是共享字符串的序号，文本已从sharedStrings.xml读取
+	for {
+		token, err := decoder.Token()
+		if limited.N <= 0 {
+			return errTextLimit
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "c":
+				sharedString = false
+				for _, attr := range t.Attr {
+					if attr.Name.Local == "t" && attr.Value == "s" {
+						sharedString = true
+					}
+				}
+			case "t":
+				inText = true
+			case "v":
+				inText = !sharedString
+			case "tab":
+				w.writeRune('\t')
+			case "br":
+				w.writeRune('\n')
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "v":
+				if inText {
+					w.writeRune('\t')
+				}
+				inText = false
+			case "p", "tr", "row", "si":
+				w.writeRune('\n')
+			}
+		case xml.CharData:
+			if inText {
+				if err := w.Write(t); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}